@@ -0,0 +1,159 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// versionPattern matches the leading dot-separated numbers of a version,
+// optionally prefixed with a "v".
+var versionPattern = regexp.MustCompile(`^v?([0-9]+(\.[0-9]+)*)`)
+
+// VersionShare is the share of the deployments active within the bucket
+// starting at Time that reported the version. A deployment running services
+// of several versions counts towards each of them, so the shares of a bucket
+// may add up to more than 1.
+type VersionShare struct {
+	Time          time.Time `json:"time"`
+	Version       string    `json:"version"`
+	NoDeployments int       `json:"number_of_deployments"`
+	Share         float64   `json:"share"`
+}
+
+// VersionTransition counts the deployments that upgraded from one version to
+// a newer one. MedianAdoption is the median time between the first report of
+// the To version by any deployment and its adoption by these deployments.
+type VersionTransition struct {
+	From           string
+	To             string
+	NoDeployments  int
+	MedianAdoption time.Duration
+}
+
+// TransitionReport lists the version transitions of deployments within a
+// window, most frequent first. NoDeployments counts the deployments with any
+// transition, and MedianAdoption is the median adoption time over all of
+// them.
+type TransitionReport struct {
+	Transitions    []VersionTransition
+	NoDeployments  int
+	MedianAdoption time.Duration
+}
+
+// Upgrade is a service of a deployment moving from one version to another.
+// Adoption is the time between the first report of the To version by any
+// deployment and the first report of the upgraded service on it.
+type Upgrade struct {
+	IpAddress string
+	From      string
+	To        string
+	Adoption  time.Duration
+}
+
+// Shares returns the share of the deployments of every bucket that reported
+// each version, given the series split by version and the unsplit series of
+// the same filters.
+func Shares(versions, totals []TimeseriesPoint) []VersionShare {
+	active := make(map[int64]int, len(totals))
+	for _, p := range totals {
+		active[p.Time.Unix()] = p.NoDeployments
+	}
+	shares := make([]VersionShare, 0, len(versions))
+	for _, p := range versions {
+		share := VersionShare{Time: p.Time, Version: p.Value, NoDeployments: p.NoDeployments}
+		if n := active[p.Time.Unix()]; n > 0 {
+			share.Share = float64(p.NoDeployments) / float64(n)
+		}
+		shares = append(shares, share)
+	}
+	return shares
+}
+
+// SummarizeUpgrades counts the deployments of every transition of the
+// upgrades, each deployment being counted once per transition with its
+// earliest adoption. It is the reference for repositories aggregating
+// upgrades in memory.
+func SummarizeUpgrades(upgrades []Upgrade) TransitionReport {
+	type transition struct{ from, to string }
+	adoptions := make(map[transition]map[string]time.Duration)
+	deployments := make(map[string]struct{})
+	for _, u := range upgrades {
+		t := transition{u.From, u.To}
+		if adoptions[t] == nil {
+			adoptions[t] = make(map[string]time.Duration)
+		}
+		if a, ok := adoptions[t][u.IpAddress]; !ok || u.Adoption < a {
+			adoptions[t][u.IpAddress] = u.Adoption
+		}
+		deployments[u.IpAddress] = struct{}{}
+	}
+
+	var report TransitionReport
+	var all []time.Duration
+	for t, byIP := range adoptions {
+		durations := make([]time.Duration, 0, len(byIP))
+		for _, a := range byIP {
+			durations = append(durations, a)
+		}
+		all = append(all, durations...)
+		report.Transitions = append(report.Transitions, VersionTransition{
+			From:           t.from,
+			To:             t.to,
+			NoDeployments:  len(byIP),
+			MedianAdoption: median(durations),
+		})
+	}
+	slices.SortFunc(report.Transitions, func(a, b VersionTransition) int {
+		if c := cmp.Compare(b.NoDeployments, a.NoDeployments); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.From, b.From); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.To, b.To)
+	})
+	report.NoDeployments = len(deployments)
+	report.MedianAdoption = median(all)
+	return report
+}
+
+// IsUpgrade tells whether the to version is newer than the from version,
+// comparing their leading dot-separated numbers, so that "0.14.1" is newer
+// than "v0.9" and "0.14" than "0.13.5". Versions that don't start with a
+// number are never upgrades.
+func IsUpgrade(from, to string) bool {
+	a, b := versionPattern.FindStringSubmatch(from), versionPattern.FindStringSubmatch(to)
+	if a == nil || b == nil {
+		return false
+	}
+	return slices.CompareFunc(strings.Split(a[1], "."), strings.Split(b[1], "."), compareNumbers) < 0
+}
+
+// compareNumbers compares decimal numbers of any length.
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if c := cmp.Compare(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// median returns the median of the durations, interpolating between the
+// middle two of an even number of them the way percentile_cont does.
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	slices.Sort(durations)
+	mid := len(durations) / 2
+	if len(durations)%2 == 1 {
+		return durations[mid]
+	}
+	return (durations[mid-1] + durations[mid]) / 2
+}
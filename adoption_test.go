@@ -0,0 +1,72 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShares(t *testing.T) {
+	day := time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC)
+	next := day.AddDate(0, 0, 1)
+	versions := []callhome.TimeseriesPoint{
+		{Time: day, Value: "0.14.0", NoDeployments: 3},
+		{Time: day, Value: "0.15.0", NoDeployments: 1},
+		{Time: next, Value: "0.15.0", NoDeployments: 2},
+	}
+	// Times of the totals may be in another location.
+	totals := []callhome.TimeseriesPoint{
+		{Time: day.In(time.FixedZone("UTC+1", 60*60)), NoDeployments: 4},
+		{Time: next, NoDeployments: 2},
+	}
+	assert.Equal(t, []callhome.VersionShare{
+		{Time: day, Version: "0.14.0", NoDeployments: 3, Share: 0.75},
+		{Time: day, Version: "0.15.0", NoDeployments: 1, Share: 0.25},
+		{Time: next, Version: "0.15.0", NoDeployments: 2, Share: 1},
+	}, callhome.Shares(versions, totals))
+}
+
+func TestSummarizeUpgrades(t *testing.T) {
+	upgrades := []callhome.Upgrade{
+		{IpAddress: "10.0.0.1", From: "0.14.0", To: "0.15.0", Adoption: 4 * time.Hour},
+		// The earliest adoption of a deployment counts.
+		{IpAddress: "10.0.0.1", From: "0.14.0", To: "0.15.0", Adoption: 5 * time.Hour},
+		{IpAddress: "10.0.0.2", From: "0.14.0", To: "0.15.0", Adoption: 2 * time.Hour},
+		{IpAddress: "10.0.0.2", From: "0.13.0", To: "0.14.0", Adoption: 9 * time.Hour},
+	}
+	assert.Equal(t, callhome.TransitionReport{
+		Transitions: []callhome.VersionTransition{
+			{From: "0.14.0", To: "0.15.0", NoDeployments: 2, MedianAdoption: 3 * time.Hour},
+			{From: "0.13.0", To: "0.14.0", NoDeployments: 1, MedianAdoption: 9 * time.Hour},
+		},
+		NoDeployments:  2,
+		MedianAdoption: 4 * time.Hour,
+	}, callhome.SummarizeUpgrades(upgrades))
+	assert.Equal(t, callhome.TransitionReport{}, callhome.SummarizeUpgrades(nil))
+}
+
+func TestIsUpgrade(t *testing.T) {
+	testCases := []struct {
+		from, to string
+		upgrade  bool
+	}{
+		{"0.14.0", "0.15.0", true},
+		{"0.9.1", "0.14.0", true},
+		{"v0.14.1", "0.15", true},
+		{"0.14", "0.14.0", true},
+		{"0.15.0", "0.14.1", false},
+		{"0.14.0", "0.14.0", false},
+		{"0.14.0", "v0.14.0-rc1", false},
+		{"0.14.0", "latest", false},
+		{"", "0.14.0", false},
+		{"0.99999999999999999999", "1.0", true},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.upgrade, callhome.IsUpgrade(tc.from, tc.to), "%s to %s", tc.from, tc.to)
+	}
+}
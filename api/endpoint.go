@@ -35,30 +35,66 @@ func saveEndpoint(svc callhome.Service) endpoint.Endpoint {
 func retrieveEndpoint(svc callhome.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(listTelemetryReq)
+		if err := req.validatePage(); err != nil {
+			return nil, err
+		}
 		if err := req.validate(); err != nil {
 			return nil, err
 		}
 		pm := callhome.PageMetadata{
-			Offset: req.offset,
-			Limit:  req.limit,
-		}
-		filter := callhome.TelemetryFilters{
-			From:    req.from,
-			To:      req.to,
-			Country: req.country,
-			City:    req.city,
-			Version: req.version,
-			Service: req.service,
-		}
-		tm, err := svc.Retrieve(ctx, pm, filter)
+			Offset:    req.offset,
+			Limit:     req.limit,
+			Cursor:    req.cursor,
+			SkipTotal: req.skipTotal,
+			Sort:      req.sort,
+			Dir:       req.dir,
+		}
+		tm, err := svc.Retrieve(ctx, req.token, pm, req.filters())
 		if err != nil {
 			return nil, err
 		}
 		res := telemetryPageRes{
 			pageRes: pageRes{
-				Total:  tm.Total,
-				Offset: tm.Offset,
-				Limit:  tm.Limit,
+				Total:      tm.Total,
+				Offset:     tm.Offset,
+				Limit:      tm.Limit,
+				Cursor:     tm.Cursor,
+				NextCursor: tm.NextCursor,
+			},
+			Telemetry: tm.Telemetry,
+		}
+		return res, nil
+	}
+}
+
+func retrieveChurnEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listTelemetryReq)
+		if err := req.validatePage(); err != nil {
+			return nil, err
+		}
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		pm := callhome.PageMetadata{
+			Offset:    req.offset,
+			Limit:     req.limit,
+			Cursor:    req.cursor,
+			SkipTotal: req.skipTotal,
+			Sort:      req.sort,
+			Dir:       req.dir,
+		}
+		tm, err := svc.RetrieveChurn(ctx, req.token, pm, req.filters())
+		if err != nil {
+			return nil, err
+		}
+		res := telemetryPageRes{
+			pageRes: pageRes{
+				Total:      tm.Total,
+				Offset:     tm.Offset,
+				Limit:      tm.Limit,
+				Cursor:     tm.Cursor,
+				NextCursor: tm.NextCursor,
 			},
 			Telemetry: tm.Telemetry,
 		}
@@ -72,15 +108,10 @@ func retrieveSummaryEndpoint(svc callhome.Service) endpoint.Endpoint {
 		if err := req.validate(); err != nil {
 			return nil, err
 		}
-		filter := callhome.TelemetryFilters{
-			From:    req.from,
-			To:      req.to,
-			Country: req.country,
-			City:    req.city,
-			Version: req.version,
-			Service: req.service,
+		if err := req.breakdowns.Validate(); err != nil {
+			return nil, err
 		}
-		summary, err := svc.RetrieveSummary(ctx, filter)
+		summary, err := svc.RetrieveSummary(ctx, req.token, req.filters(), req.breakdowns)
 		if err != nil {
 			return nil, err
 		}
@@ -89,26 +120,146 @@ func retrieveSummaryEndpoint(svc callhome.Service) endpoint.Endpoint {
 			Cities:           summary.Cities,
 			Services:         summary.Services,
 			Versions:         summary.Versions,
+			Providers:        summary.Providers,
+			Statuses:         summary.Statuses,
 			TotalDeployments: summary.TotalDeployments,
 		}, nil
 	}
 }
 
-func serveUI(svc callhome.Service) endpoint.Endpoint {
+func retrieveTimeseriesEndpoint(svc callhome.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(listTelemetryReq)
+		if err := req.validateUnclassified(); err != nil {
+			return nil, err
+		}
+		if err := callhome.ValidateTimeseries(req.interval, req.split); err != nil {
+			return nil, err
+		}
+		points, err := svc.RetrieveTimeseries(ctx, req.filters(), req.interval, req.split)
+		if err != nil {
+			return nil, err
+		}
+		return timeseriesRes{
+			Interval: req.interval,
+			Split:    req.split,
+			Points:   points,
+		}, nil
+	}
+}
+
+func retrieveAdoptionEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listTelemetryReq)
+		if err := req.validateUnclassified(); err != nil {
+			return nil, err
+		}
+		// Adoption isn't split, so only its interval is validated.
+		if err := callhome.ValidateTimeseries(req.interval, ""); err != nil {
+			return nil, err
+		}
+		shares, err := svc.RetrieveAdoption(ctx, req.filters(), req.interval)
+		if err != nil {
+			return nil, err
+		}
+		return adoptionRes{
+			Interval: req.interval,
+			Shares:   shares,
+		}, nil
+	}
+}
+
+func retrieveTransitionsEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listTelemetryReq)
+		if err := req.validateUnclassified(); err != nil {
+			return nil, err
+		}
+		report, err := svc.RetrieveTransitions(ctx, req.filters())
+		if err != nil {
+			return nil, err
+		}
+		res := transitionsRes{
+			NoDeployments:  report.NoDeployments,
+			MedianAdoption: report.MedianAdoption.Seconds(),
+			Transitions:    []transitionRes{},
+		}
+		for _, t := range report.Transitions {
+			res.Transitions = append(res.Transitions, transitionRes{
+				From:           t.From,
+				To:             t.To,
+				NoDeployments:  t.NoDeployments,
+				MedianAdoption: t.MedianAdoption.Seconds(),
+			})
+		}
+		return res, nil
+	}
+}
+
+func retrieveCohortsEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listTelemetryReq)
+		if err := req.validateUnclassified(); err != nil {
+			return nil, err
+		}
+		if err := callhome.ValidateCohortPeriod(req.period); err != nil {
+			return nil, err
+		}
+		cohorts, err := svc.RetrieveCohorts(ctx, req.filters(), req.period)
+		if err != nil {
+			return nil, err
+		}
+		return cohortsRes{
+			Period:  req.period,
+			Cohorts: cohorts,
+		}, nil
+	}
+}
+
+func retrieveCooccurrenceEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listTelemetryReq)
+		if err := req.validateUnclassified(); err != nil {
+			return nil, err
+		}
+		if !validLimit(req.limit) {
+			return nil, ErrLimitSize
+		}
+		report, err := svc.RetrieveCooccurrence(ctx, req.token, req.filters(), req.companionOf, req.limit)
+		if err != nil {
+			return nil, err
+		}
+		return cooccurrenceRes{report}, nil
+	}
+}
+
+func eraseEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(eraseReq)
 		if err := req.validate(); err != nil {
 			return nil, err
 		}
-		filter := callhome.TelemetryFilters{
-			From:    req.from,
-			To:      req.to,
-			Country: req.country,
-			City:    req.city,
-			Version: req.version,
-			Service: req.service,
+		er := callhome.ErasureRequest{
+			IpAddress:  req.IpAddress,
+			Deployment: req.Deployment,
+			Blocklist:  req.Blocklist,
+			Reason:     req.Reason,
+		}
+		receipt, err := svc.Erase(ctx, req.token, er)
+		if err != nil {
+			return nil, err
+		}
+		return eraseRes{ErasureReceipt: receipt}, nil
+	}
+}
+
+func serveUI(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listTelemetryReq)
+		if err := req.validateUnclassified(); err != nil {
+			return nil, err
 		}
-		res, err := svc.ServeUI(ctx, filter)
+		res, err := svc.ServeUI(ctx, req.filters())
 		return uiRes{
 			html: res,
 		}, err
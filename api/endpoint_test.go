@@ -4,7 +4,9 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/absmach/callhome"
 	"github.com/absmach/callhome/mocks"
+	"github.com/absmach/callhome/timescale"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.opentelemetry.io/otel/trace"
@@ -21,7 +24,8 @@ import (
 func TestEndpointsRetrieve(t *testing.T) {
 	svc := mocks.NewService(t)
 	svc.On("Retrieve", mock.Anything, callhome.PageMetadata{Limit: 10}).Return(callhome.TelemetryPage{}, nil)
-	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default())
+	svc.On("Retrieve", mock.Anything, callhome.PageMetadata{Limit: 5}).Return(callhome.TelemetryPage{}, timescale.ErrQueryTimeout)
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
 	server := httptest.NewServer(h)
 	client := server.Client()
 	testCases := []struct {
@@ -33,6 +37,7 @@ func TestEndpointsRetrieve(t *testing.T) {
 		{"successful req", 10, 0, http.StatusOK},
 		{"large-limit-size", maxLimitSize + 1, 0, http.StatusBadRequest},
 		{"negative-limit-size", -1, 0, http.StatusBadRequest},
+		{"query timeout", 5, 0, http.StatusGatewayTimeout},
 	}
 
 	for _, testCase := range testCases {
@@ -46,6 +51,38 @@ func TestEndpointsRetrieve(t *testing.T) {
 	}
 }
 
+func TestEndpointsRetrieveCursor(t *testing.T) {
+	// Cursors are sealed by the service and opaque to the API.
+	cursor := "c2VhbGVkIGN1cnNvcg"
+	svc := mocks.NewService(t)
+	svc.On("Retrieve", mock.Anything, callhome.PageMetadata{Limit: 10, Cursor: cursor, SkipTotal: true}).Return(callhome.TelemetryPage{}, nil)
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	testCases := []struct {
+		test       string
+		query      string
+		statuscode int
+	}{
+		{"successful req", "cursor=" + cursor + "&skip_total=true", http.StatusOK},
+		{"cursor with offset", "cursor=" + cursor + "&offset=10", http.StatusBadRequest},
+		{"invalid skip total", "skip_total=maybe", http.StatusBadRequest},
+		{"invalid sort", "sort=ip_address", http.StatusBadRequest},
+		{"invalid direction", "sort=last_seen&dir=up", http.StatusBadRequest},
+		{"unused parameters", "cursor=" + cursor + "&skip_total=true&interval=fortnight&period=day&breakdown=regions", http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.test, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statuscode, res.StatusCode)
+		})
+	}
+}
+
 func TestEndpointSave(t *testing.T) {
 	body := `{
 		"service": "ty",
@@ -55,7 +92,7 @@ func TestEndpointSave(t *testing.T) {
 		}`
 	svc := mocks.NewService(t)
 	svc.On("Save", mock.Anything, mock.AnythingOfType("callhome.Telemetry")).Return(nil)
-	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default())
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
 	server := httptest.NewServer(h)
 	client := server.Client()
 	testCases := []struct {
@@ -80,3 +117,320 @@ func TestEndpointSave(t *testing.T) {
 		})
 	}
 }
+
+func TestEndpointErase(t *testing.T) {
+	token := "admin-key"
+	svc := mocks.NewService(t)
+	svc.On("Erase", mock.Anything, token, callhome.ErasureRequest{IpAddress: "41.90.185.50", Blocklist: true}).
+		Return(callhome.ErasureReceipt{ID: "1", Subject: callhome.SubjectIPAddress, RecordsRemoved: 3, Blocklisted: true}, nil)
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	testCases := []struct {
+		test, body, token string
+		statuscode        int
+	}{
+		{"success", `{"ip_address": "41.90.185.50", "blocklist": true}`, token, http.StatusOK},
+		{"missing-token", `{"ip_address": "41.90.185.50"}`, "", http.StatusUnauthorized},
+		{"no-subject", `{}`, token, http.StatusBadRequest},
+		{"both-subjects", `{"ip_address": "41.90.185.50", "deployment": "h:01"}`, token, http.StatusBadRequest},
+		{"invalid-ip", `{"ip_address": "invalid"}`, token, http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.test, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/telemetry/erasures", server.URL), strings.NewReader(testCase.body))
+			assert.Nil(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if testCase.token != "" {
+				req.Header.Set("Authorization", BearerPrefix+testCase.token)
+			}
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statuscode, res.StatusCode)
+		})
+	}
+}
+
+func TestDecodeRetrieveFilters(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/telemetry?country=Kenya&country=France&country!=Spain&version=0.14.*&network_type=cloud&service=", nil)
+	req, err := decodeRetrieve(context.Background(), r)
+	assert.Nil(t, err)
+	lr := req.(listTelemetryReq)
+	assert.Equal(t, callhome.Filter{Values: []string{"Kenya", "France"}, Excluded: []string{"Spain"}}, lr.country)
+	assert.Equal(t, callhome.Match("0.14.*"), lr.version)
+	assert.Equal(t, callhome.Match(callhome.NetworkCloud), lr.networkType)
+	assert.True(t, lr.service.IsZero())
+
+	r = httptest.NewRequest(http.MethodGet, "/telemetry?network_type!=satellite", nil)
+	req, err = decodeRetrieve(context.Background(), r)
+	assert.Nil(t, err)
+	lr = req.(listTelemetryReq)
+	lr.limit = defLimit
+	assert.Equal(t, ErrInvalidNetworkType, lr.validate())
+}
+
+func TestEndpointRetrieveSummary(t *testing.T) {
+	svc := mocks.NewService(t)
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	testCases := []struct {
+		test       string
+		query      string
+		statuscode int
+	}{
+		{"all breakdowns", "", http.StatusOK},
+		{"selected breakdowns", "breakdown=cities&breakdown=versions", http.StatusOK},
+		{"invalid breakdown", "breakdown=regions", http.StatusBadRequest},
+		{"unused parameters", "interval=fortnight&period=day&limit=1000&sort=ip_address", http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.test, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/summary?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statuscode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointRetrieveTimeseries(t *testing.T) {
+	svc := mocks.NewService(t)
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	testCases := []struct {
+		test       string
+		query      string
+		statuscode int
+	}{
+		{"default interval", "", http.StatusOK},
+		{"split", "interval=week&split=version&country=Kenya", http.StatusOK},
+		{"invalid interval", "interval=fortnight", http.StatusBadRequest},
+		{"invalid split", "split=city", http.StatusBadRequest},
+		{"unused parameters", "period=day&breakdown=regions&limit=1000", http.StatusOK},
+		{"status", "status=active", http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.test, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/timeseries?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statuscode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointVersions(t *testing.T) {
+	svc := mocks.NewService(t)
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	testCases := []struct {
+		test       string
+		path       string
+		statuscode int
+	}{
+		{"adoption", "adoption?interval=week&country=Kenya", http.StatusOK},
+		{"adoption with invalid interval", "adoption?interval=fortnight", http.StatusBadRequest},
+		{"adoption with unused split", "adoption?interval=week&split=city", http.StatusOK},
+		{"transitions", "transitions?from=2024-01-01T00:00:00Z", http.StatusOK},
+		{"transitions with invalid filter", "transitions?network_type=satellite", http.StatusBadRequest},
+		{"adoption with status", "adoption?status=active", http.StatusBadRequest},
+		{"transitions with status", "transitions?status=churned", http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.test, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/versions/%s", server.URL, testCase.path), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statuscode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointRetrieveCohorts(t *testing.T) {
+	svc := mocks.NewService(t)
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	testCases := []struct {
+		test       string
+		query      string
+		statuscode int
+	}{
+		{"default period", "", http.StatusOK},
+		{"monthly", "period=month&country=Kenya", http.StatusOK},
+		{"invalid period", "period=day", http.StatusBadRequest},
+		{"unused parameters", "interval=fortnight&breakdown=regions&limit=1000", http.StatusOK},
+		{"status", "status=dormant", http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.test, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/cohorts?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statuscode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointRetrieveCooccurrence(t *testing.T) {
+	svc := mocks.NewService(t)
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	testCases := []struct {
+		test       string
+		query      string
+		statuscode int
+	}{
+		{"all services", "", http.StatusOK},
+		{"companions", "companions_of=users&country=Kenya&limit=5", http.StatusOK},
+		{"invalid limit", "limit=1000", http.StatusBadRequest},
+		{"unused parameters", "interval=fortnight&period=day&sort=ip_address", http.StatusOK},
+		{"status", "status=stale", http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.test, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/services/cooccurrence?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statuscode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointRetrieveChurn(t *testing.T) {
+	svc := mocks.NewService(t)
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), nil)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	testCases := []struct {
+		test       string
+		query      string
+		statuscode int
+	}{
+		{"all deployments", "", http.StatusOK},
+		{"window", "from=2024-01-01T00:00:00Z&country=Kenya", http.StatusOK},
+		{"invalid status", "status=gone", http.StatusBadRequest},
+		{"unused parameters", "interval=fortnight&period=day&breakdown=regions", http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.test, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/churn?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statuscode, res.StatusCode)
+		})
+	}
+}
+
+func TestDecodeRetrieveArea(t *testing.T) {
+	cases := []struct {
+		desc        string
+		query       string
+		boundingBox *callhome.BoundingBox
+		radius      *callhome.Radius
+		err         error
+	}{
+		{
+			desc:        "bounding box",
+			query:       "min_lat=40&min_lon=-5&max_lat=52&max_lon=10",
+			boundingBox: &callhome.BoundingBox{MinLat: 40, MinLon: -5, MaxLat: 52, MaxLon: 10},
+		},
+		{
+			desc:        "bounding box across the antimeridian",
+			query:       "min_lat=-50&min_lon=170&max_lat=-30&max_lon=-170",
+			boundingBox: &callhome.BoundingBox{MinLat: -50, MinLon: 170, MaxLat: -30, MaxLon: -170},
+		},
+		{
+			desc:   "radius",
+			query:  "lat=48.86&lon=2.35&radius=200",
+			radius: &callhome.Radius{Lat: 48.86, Lon: 2.35, Distance: 200},
+		},
+		{desc: "incomplete bounding box", query: "min_lat=40&max_lat=52", err: ErrInvalidBoundingBox},
+		{desc: "inverted latitudes", query: "min_lat=52&min_lon=-5&max_lat=40&max_lon=10", err: ErrInvalidBoundingBox},
+		{desc: "latitude out of range", query: "min_lat=-91&min_lon=-5&max_lat=40&max_lon=10", err: ErrInvalidBoundingBox},
+		{desc: "incomplete radius", query: "lat=48.86&lon=2.35", err: ErrInvalidRadius},
+		{desc: "negative radius", query: "lat=48.86&lon=2.35&radius=-1", err: ErrInvalidRadius},
+		{desc: "malformed coordinate", query: "lat=north&lon=2.35&radius=200", err: ErrInvalidQueryParams},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/telemetry?"+c.query, nil)
+			req, err := decodeRetrieve(context.Background(), r)
+			if err == nil {
+				lr := req.(listTelemetryReq)
+				lr.limit = defLimit
+				err = lr.validate()
+				if err == nil {
+					assert.Equal(t, c.boundingBox, lr.boundingBox)
+					assert.Equal(t, c.radius, lr.radius)
+				}
+			}
+			assert.Equal(t, c.err, err)
+		})
+	}
+}
+
+func TestReady(t *testing.T) {
+	svc := mocks.NewService(t)
+	testCases := []struct {
+		test       string
+		checks     map[string]ReadinessCheck
+		statuscode int
+		body       string
+	}{
+		{
+			test:       "no checks",
+			statuscode: http.StatusOK,
+			body:       `{"status":"ready"}`,
+		},
+		{
+			test: "all checks pass",
+			checks: map[string]ReadinessCheck{
+				"database":   func(context.Context) error { return nil },
+				"migrations": func(context.Context) error { return nil },
+			},
+			statuscode: http.StatusOK,
+			body:       `{"status":"ready","checks":{"database":"ok","migrations":"ok"}}`,
+		},
+		{
+			test: "failing check",
+			checks: map[string]ReadinessCheck{
+				"database":   func(context.Context) error { return fmt.Errorf("connection refused") },
+				"migrations": func(context.Context) error { return nil },
+			},
+			statuscode: http.StatusServiceUnavailable,
+			body:       `{"status":"unavailable","checks":{"database":"unavailable","migrations":"ok"}}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.test, func(t *testing.T) {
+			server := httptest.NewServer(MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), testCase.checks))
+			defer server.Close()
+			res, err := server.Client().Get(server.URL + "/ready")
+			assert.Nil(t, err)
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statuscode, res.StatusCode)
+			assert.JSONEq(t, testCase.body, string(body))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds the duration of all readiness checks of a request.
+const readinessTimeout = 5 * time.Second
+
+const (
+	statusReady       = "ready"
+	statusUnavailable = "unavailable"
+	checkOK           = "ok"
+)
+
+// ReadinessCheck reports whether a dependency of the service is ready to
+// serve requests.
+type ReadinessCheck func(ctx context.Context) error
+
+type readinessRes struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// readinessHandler runs the checks and responds with 503 Service Unavailable
+// if any of them fails. Check errors are logged rather than returned, as
+// they may reveal details of the deployment.
+func readinessHandler(checks map[string]ReadinessCheck, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		res := readinessRes{Status: statusReady, Checks: make(map[string]string, len(checks))}
+		code := http.StatusOK
+		for name, check := range checks {
+			if err := check(ctx); err != nil {
+				logger.Warn(fmt.Sprintf("readiness check %s failed: %s", name, err))
+				res.Checks[name] = statusUnavailable
+				res.Status = statusUnavailable
+				code = http.StatusServiceUnavailable
+				continue
+			}
+			res.Checks[name] = checkOK
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			logger.Error(fmt.Sprintf("failed to encode readiness response: %s", err))
+		}
+	}
+}
@@ -25,7 +25,7 @@ func LoggingMiddleware(svc callhome.Service, logger *slog.Logger) callhome.Servi
 }
 
 // Retrieve adds logging middleware to retrieve service.
-func (lm *loggingMiddleware) Retrieve(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (telemetryPage callhome.TelemetryPage, err error) {
+func (lm *loggingMiddleware) Retrieve(ctx context.Context, token string, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (telemetryPage callhome.TelemetryPage, err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method retrieve with took %s to complete", time.Since(begin))
 		if err != nil {
@@ -35,7 +35,21 @@ func (lm *loggingMiddleware) Retrieve(ctx context.Context, pm callhome.PageMetad
 		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
 	}(time.Now())
 
-	return lm.svc.Retrieve(ctx, pm, filters)
+	return lm.svc.Retrieve(ctx, token, pm, filters)
+}
+
+// RetrieveChurn adds logging middleware to retrieve churn service.
+func (lm *loggingMiddleware) RetrieveChurn(ctx context.Context, token string, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (page callhome.TelemetryPage, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve churn took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.RetrieveChurn(ctx, token, pm, filters)
 }
 
 // Save adds logging middleware to save service.
@@ -52,7 +66,7 @@ func (lm *loggingMiddleware) Save(ctx context.Context, t callhome.Telemetry) (er
 	return lm.svc.Save(ctx, t)
 }
 
-func (lm *loggingMiddleware) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (summary callhome.TelemetrySummary, err error) {
+func (lm *loggingMiddleware) RetrieveSummary(ctx context.Context, token string, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns) (summary callhome.TelemetrySummary, err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method retrieve summary event took %s to complete", time.Since(begin))
 		if err != nil {
@@ -62,7 +76,77 @@ func (lm *loggingMiddleware) RetrieveSummary(ctx context.Context, filters callho
 		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
 	}(time.Now())
 
-	return lm.svc.RetrieveSummary(ctx, filters)
+	return lm.svc.RetrieveSummary(ctx, token, filters, breakdowns)
+}
+
+// RetrieveTimeseries adds logging middleware to retrieve timeseries service.
+func (lm *loggingMiddleware) RetrieveTimeseries(ctx context.Context, filters callhome.TelemetryFilters, interval, split string) (points []callhome.TimeseriesPoint, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve timeseries by %s took %s to complete", interval, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.RetrieveTimeseries(ctx, filters, interval, split)
+}
+
+// RetrieveAdoption adds logging middleware to retrieve adoption service.
+func (lm *loggingMiddleware) RetrieveAdoption(ctx context.Context, filters callhome.TelemetryFilters, interval string) (shares []callhome.VersionShare, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve adoption by %s took %s to complete", interval, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.RetrieveAdoption(ctx, filters, interval)
+}
+
+// RetrieveTransitions adds logging middleware to retrieve transitions service.
+func (lm *loggingMiddleware) RetrieveTransitions(ctx context.Context, filters callhome.TelemetryFilters) (report callhome.TransitionReport, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve transitions took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.RetrieveTransitions(ctx, filters)
+}
+
+// RetrieveCohorts adds logging middleware to retrieve cohorts service.
+func (lm *loggingMiddleware) RetrieveCohorts(ctx context.Context, filters callhome.TelemetryFilters, period string) (cohorts []callhome.Cohort, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve cohorts by %s took %s to complete", period, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.RetrieveCohorts(ctx, filters, period)
+}
+
+// RetrieveCooccurrence adds logging middleware to retrieve co-occurrence service.
+func (lm *loggingMiddleware) RetrieveCooccurrence(ctx context.Context, token string, filters callhome.TelemetryFilters, service string, limit uint64) (report callhome.CooccurrenceReport, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve co-occurrence of %d deployments took %s to complete", report.NoDeployments, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.RetrieveCooccurrence(ctx, token, filters, service, limit)
 }
 
 // ServeUI implements callhome.Service.
@@ -78,3 +162,17 @@ func (lm *loggingMiddleware) ServeUI(ctx context.Context, filters callhome.Telem
 
 	return lm.svc.ServeUI(ctx, filters)
 }
+
+// Erase adds logging middleware to erase service.
+func (lm *loggingMiddleware) Erase(ctx context.Context, token string, req callhome.ErasureRequest) (receipt callhome.ErasureReceipt, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method erase took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors, erasure %s removed %d records.", message, receipt.ID, receipt.RecordsRemoved))
+	}(time.Now())
+
+	return lm.svc.Erase(ctx, token, req)
+}
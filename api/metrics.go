@@ -29,13 +29,23 @@ func MetricsMiddleware(svc callhome.Service, counter metrics.Counter, latency me
 }
 
 // Retrieve add metrics middleware to retrieve service.
-func (mm *metricsMiddleware) Retrieve(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+func (mm *metricsMiddleware) Retrieve(ctx context.Context, token string, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
 	defer func(begin time.Time) {
 		mm.counter.With("method", "retrieve").Add(1)
 		mm.latency.With("method", "retrieve").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return mm.svc.Retrieve(ctx, pm, filters)
+	return mm.svc.Retrieve(ctx, token, pm, filters)
+}
+
+// RetrieveChurn adds metrics middleware to retrieve churn service.
+func (mm *metricsMiddleware) RetrieveChurn(ctx context.Context, token string, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-churn").Add(1)
+		mm.latency.With("method", "retrieve-churn").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return mm.svc.RetrieveChurn(ctx, token, pm, filters)
 }
 
 // Save adds metrics middleware to save service.
@@ -49,12 +59,57 @@ func (mm *metricsMiddleware) Save(ctx context.Context, t callhome.Telemetry) err
 }
 
 // RetrieveSummary adds metrics middleware to retrieve summary service.
-func (mm *metricsMiddleware) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+func (mm *metricsMiddleware) RetrieveSummary(ctx context.Context, token string, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns) (callhome.TelemetrySummary, error) {
 	defer func(begin time.Time) {
 		mm.counter.With("method", "retrieve-summary").Add(1)
 		mm.latency.With("method", "retrieve-summary").Observe(time.Since(begin).Seconds())
 	}(time.Now())
-	return mm.svc.RetrieveSummary(ctx, filters)
+	return mm.svc.RetrieveSummary(ctx, token, filters, breakdowns)
+}
+
+// RetrieveTimeseries adds metrics middleware to retrieve timeseries service.
+func (mm *metricsMiddleware) RetrieveTimeseries(ctx context.Context, filters callhome.TelemetryFilters, interval, split string) ([]callhome.TimeseriesPoint, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-timeseries").Add(1)
+		mm.latency.With("method", "retrieve-timeseries").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveTimeseries(ctx, filters, interval, split)
+}
+
+// RetrieveAdoption adds metrics middleware to retrieve adoption service.
+func (mm *metricsMiddleware) RetrieveAdoption(ctx context.Context, filters callhome.TelemetryFilters, interval string) ([]callhome.VersionShare, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-adoption").Add(1)
+		mm.latency.With("method", "retrieve-adoption").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveAdoption(ctx, filters, interval)
+}
+
+// RetrieveTransitions adds metrics middleware to retrieve transitions service.
+func (mm *metricsMiddleware) RetrieveTransitions(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TransitionReport, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-transitions").Add(1)
+		mm.latency.With("method", "retrieve-transitions").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveTransitions(ctx, filters)
+}
+
+// RetrieveCohorts adds metrics middleware to retrieve cohorts service.
+func (mm *metricsMiddleware) RetrieveCohorts(ctx context.Context, filters callhome.TelemetryFilters, period string) ([]callhome.Cohort, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-cohorts").Add(1)
+		mm.latency.With("method", "retrieve-cohorts").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveCohorts(ctx, filters, period)
+}
+
+// RetrieveCooccurrence adds metrics middleware to retrieve co-occurrence service.
+func (mm *metricsMiddleware) RetrieveCooccurrence(ctx context.Context, token string, filters callhome.TelemetryFilters, service string, limit uint64) (callhome.CooccurrenceReport, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-cooccurrence").Add(1)
+		mm.latency.With("method", "retrieve-cooccurrence").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveCooccurrence(ctx, token, filters, service, limit)
 }
 
 // ServeUI implements callhome.Service.
@@ -65,3 +120,12 @@ func (mm *metricsMiddleware) ServeUI(ctx context.Context, filters callhome.Telem
 	}(time.Now())
 	return mm.svc.ServeUI(ctx, filters)
 }
+
+// Erase adds metrics middleware to erase service.
+func (mm *metricsMiddleware) Erase(ctx context.Context, token string, req callhome.ErasureRequest) (callhome.ErasureReceipt, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "erase").Add(1)
+		mm.latency.With("method", "erase").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.Erase(ctx, token, req)
+}
@@ -4,8 +4,10 @@
 package api
 
 import (
+	"net/netip"
 	"time"
 
+	"github.com/absmach/callhome"
 	"github.com/absmach/magistrala/pkg/errors"
 )
 
@@ -16,9 +18,26 @@ var (
 	ErrOffsetSize = errors.New("invalid offset size")
 	// ErrInvalidDateRange indicates date from and to are invalid.
 	ErrInvalidDateRange = errors.New("invalid date range")
+	// ErrInvalidNetworkType indicates an unknown network type filter.
+	ErrInvalidNetworkType = errors.New("invalid network type")
+	// ErrInvalidBoundingBox indicates an incomplete or out of range bounding box.
+	ErrInvalidBoundingBox = errors.New("invalid bounding box")
+	// ErrInvalidRadius indicates an incomplete or out of range radius filter.
+	ErrInvalidRadius = errors.New("invalid radius")
+	// ErrCursorWithOffset indicates both cursor and offset were provided.
+	ErrCursorWithOffset = errors.New("cursor and offset are mutually exclusive")
+	// ErrStatusNotSupported indicates a status filter on an endpoint that
+	// doesn't classify deployments.
+	ErrStatusNotSupported = errors.New("status filter is not supported")
 )
 
-const maxLimitSize = 100
+const (
+	maxLimitSize = 100
+	maxLatitude  = 90
+	maxLongitude = 180
+	// maxDistance is half the circumference of the Earth in kilometres.
+	maxDistance = 20038
+)
 
 type saveTelemetryReq struct {
 	Service   string    `json:"service"`
@@ -43,24 +62,147 @@ func (req saveTelemetryReq) validate() error {
 }
 
 type listTelemetryReq struct {
-	offset  uint64
-	limit   uint64
-	from    time.Time
-	to      time.Time
-	country string
-	city    string
-	version string
-	service string
+	token       string
+	offset      uint64
+	limit       uint64
+	cursor      string
+	skipTotal   bool
+	sort        string
+	dir         string
+	from        time.Time
+	to          time.Time
+	country     callhome.Filter
+	city        callhome.Filter
+	version     callhome.Filter
+	service     callhome.Filter
+	provider    callhome.Filter
+	networkType callhome.Filter
+	boundingBox *callhome.BoundingBox
+	radius      *callhome.Radius
+	breakdowns  callhome.Breakdowns
+	interval    string
+	split       string
+	period      string
+	companionOf string
+	status      string
+}
+
+// filters returns the telemetry filters of the request.
+func (req listTelemetryReq) filters() callhome.TelemetryFilters {
+	return callhome.TelemetryFilters{
+		From:        req.from,
+		To:          req.to,
+		Country:     req.country,
+		City:        req.city,
+		Version:     req.version,
+		Service:     req.service,
+		Provider:    req.provider,
+		NetworkType: req.networkType,
+		BoundingBox: req.boundingBox,
+		Radius:      req.radius,
+		Status:      req.status,
+	}
 }
 
+// validate validates the filters of the request. Parameters only some
+// endpoints use are validated by those endpoints.
 func (req listTelemetryReq) validate() error {
-	if req.limit > maxLimitSize || req.limit < 1 {
-		return ErrLimitSize
+	if err := callhome.ValidateStatus(req.status); err != nil {
+		return err
 	}
 
 	if !req.from.IsZero() && !req.to.IsZero() && req.to.Before(req.from) {
 		return ErrInvalidDateRange
 	}
 
+	if bb := req.boundingBox; bb != nil {
+		if !validLatitude(bb.MinLat) || !validLatitude(bb.MaxLat) || bb.MinLat > bb.MaxLat ||
+			!validLongitude(bb.MinLon) || !validLongitude(bb.MaxLon) {
+			return ErrInvalidBoundingBox
+		}
+	}
+
+	if rd := req.radius; rd != nil {
+		if !validLatitude(rd.Lat) || !validLongitude(rd.Lon) || rd.Distance <= 0 || rd.Distance > maxDistance {
+			return ErrInvalidRadius
+		}
+	}
+
+	for _, nt := range append(req.networkType.Values, req.networkType.Excluded...) {
+		switch nt {
+		case callhome.NetworkCloud, callhome.NetworkISP, callhome.NetworkUnknown:
+		default:
+			return ErrInvalidNetworkType
+		}
+	}
+
 	return nil
 }
+
+// validateUnclassified validates the request of an endpoint that doesn't
+// classify deployments by status, so can't filter them by it.
+func (req listTelemetryReq) validateUnclassified() error {
+	if req.status != "" {
+		return ErrStatusNotSupported
+	}
+	return req.validate()
+}
+
+// validatePage validates the paging of an endpoint listing telemetry.
+func (req listTelemetryReq) validatePage() error {
+	if !validLimit(req.limit) {
+		return ErrLimitSize
+	}
+
+	if err := callhome.ValidateSort(req.sort, req.dir); err != nil {
+		return err
+	}
+	if req.sort == callhome.SortDistance && req.radius == nil {
+		return callhome.ErrInvalidSort
+	}
+
+	// Cursors are sealed, so only the service can tell whether they're valid.
+	if req.cursor != "" && req.offset > 0 {
+		return ErrCursorWithOffset
+	}
+
+	return nil
+}
+
+type eraseReq struct {
+	token      string
+	IpAddress  string `json:"ip_address"`
+	Deployment string `json:"deployment"`
+	Blocklist  bool   `json:"blocklist"`
+	Reason     string `json:"reason"`
+}
+
+func (req eraseReq) validate() error {
+	if req.token == "" {
+		return errors.ErrAuthentication
+	}
+
+	if (req.IpAddress == "") == (req.Deployment == "") {
+		return errors.ErrMalformedEntity
+	}
+
+	if req.IpAddress != "" {
+		if _, err := netip.ParseAddr(req.IpAddress); err != nil {
+			return errors.ErrMalformedEntity
+		}
+	}
+
+	return nil
+}
+
+func validLimit(limit uint64) bool {
+	return limit >= 1 && limit <= maxLimitSize
+}
+
+func validLatitude(lat float64) bool {
+	return lat >= -maxLatitude && lat <= maxLatitude
+}
+
+func validLongitude(lon float64) bool {
+	return lon >= -maxLongitude && lon <= maxLongitude
+}
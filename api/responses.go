@@ -15,6 +15,12 @@ var (
 	_ magistrala.Response = (*saveTelemetryRes)(nil)
 	_ magistrala.Response = (*telemetryPageRes)(nil)
 	_ magistrala.Response = (*telemetrySummaryRes)(nil)
+	_ magistrala.Response = (*timeseriesRes)(nil)
+	_ magistrala.Response = (*adoptionRes)(nil)
+	_ magistrala.Response = (*transitionsRes)(nil)
+	_ magistrala.Response = (*cohortsRes)(nil)
+	_ magistrala.Response = (*cooccurrenceRes)(nil)
+	_ magistrala.Response = (*eraseRes)(nil)
 )
 
 type saveTelemetryRes struct {
@@ -42,9 +48,11 @@ func (res saveTelemetryRes) Empty() bool {
 }
 
 type pageRes struct {
-	Total  uint64 `json:"total"`
-	Offset uint64 `json:"offset"`
-	Limit  uint64 `json:"limit"`
+	Total      uint64 `json:"total"`
+	Offset     uint64 `json:"offset"`
+	Limit      uint64 `json:"limit"`
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type telemetryPageRes struct {
@@ -93,11 +101,13 @@ func (res uiRes) Headers() map[string]string {
 }
 
 type telemetrySummaryRes struct {
-	Countries        []callhome.CountrySummary `json:"countries,omitempty"`
-	Cities           []string                  `json:"cities,omitempty"`
-	Services         []string                  `json:"services,omitempty"`
-	Versions         []string                  `json:"versions,omitempty"`
-	TotalDeployments int                       `json:"total_deployments,omitempty"`
+	Countries        []callhome.CountrySummary  `json:"countries,omitempty"`
+	Cities           []callhome.CitySummary     `json:"cities,omitempty"`
+	Services         []callhome.ServiceSummary  `json:"services,omitempty"`
+	Versions         []callhome.VersionSummary  `json:"versions,omitempty"`
+	Providers        []callhome.ProviderSummary `json:"providers,omitempty"`
+	Statuses         []callhome.StatusSummary   `json:"statuses,omitempty"`
+	TotalDeployments int                        `json:"total_deployments,omitempty"`
 }
 
 // Code implements magistrala.Response.
@@ -114,3 +124,112 @@ func (*telemetrySummaryRes) Empty() bool {
 func (res *telemetrySummaryRes) Headers() map[string]string {
 	return map[string]string{}
 }
+
+type timeseriesRes struct {
+	Interval string                     `json:"interval"`
+	Split    string                     `json:"split,omitempty"`
+	Points   []callhome.TimeseriesPoint `json:"points"`
+}
+
+func (res timeseriesRes) Code() int {
+	return http.StatusOK
+}
+
+func (res timeseriesRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+func (res timeseriesRes) Empty() bool {
+	return false
+}
+
+type adoptionRes struct {
+	Interval string                  `json:"interval"`
+	Shares   []callhome.VersionShare `json:"shares"`
+}
+
+func (res adoptionRes) Code() int {
+	return http.StatusOK
+}
+
+func (res adoptionRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+func (res adoptionRes) Empty() bool {
+	return false
+}
+
+type transitionRes struct {
+	From           string  `json:"from"`
+	To             string  `json:"to"`
+	NoDeployments  int     `json:"number_of_deployments"`
+	MedianAdoption float64 `json:"median_adoption_seconds"`
+}
+
+type transitionsRes struct {
+	NoDeployments  int             `json:"number_of_deployments"`
+	MedianAdoption float64         `json:"median_adoption_seconds"`
+	Transitions    []transitionRes `json:"transitions"`
+}
+
+func (res transitionsRes) Code() int {
+	return http.StatusOK
+}
+
+func (res transitionsRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+func (res transitionsRes) Empty() bool {
+	return false
+}
+
+type cohortsRes struct {
+	Period  string            `json:"period"`
+	Cohorts []callhome.Cohort `json:"cohorts"`
+}
+
+func (res cohortsRes) Code() int {
+	return http.StatusOK
+}
+
+func (res cohortsRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+func (res cohortsRes) Empty() bool {
+	return false
+}
+
+type cooccurrenceRes struct {
+	callhome.CooccurrenceReport
+}
+
+func (res cooccurrenceRes) Code() int {
+	return http.StatusOK
+}
+
+func (res cooccurrenceRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+func (res cooccurrenceRes) Empty() bool {
+	return false
+}
+
+type eraseRes struct {
+	callhome.ErasureReceipt
+}
+
+func (res eraseRes) Code() int {
+	return http.StatusOK
+}
+
+func (res eraseRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+func (res eraseRes) Empty() bool {
+	return false
+}
@@ -24,22 +24,43 @@ import (
 )
 
 const (
-	contentType = "application/json"
-	offsetKey   = "offset"
-	limitKey    = "limit"
-	fromKey     = "from"
-	toKey       = "to"
-	countryKey  = "country"
-	cityKey     = "city"
-	versionKey  = "version"
-	serviceKey  = "service"
-	defOffset   = 0
-	defLimit    = 10
-	staticDir   = "./web/static"
+	contentType    = "application/json"
+	offsetKey      = "offset"
+	limitKey       = "limit"
+	cursorKey      = "cursor"
+	skipTotalKey   = "skip_total"
+	sortKey        = "sort"
+	dirKey         = "dir"
+	fromKey        = "from"
+	toKey          = "to"
+	countryKey     = "country"
+	cityKey        = "city"
+	versionKey     = "version"
+	serviceKey     = "service"
+	providerKey    = "provider"
+	networkTypeKey = "network_type"
+	minLatKey      = "min_lat"
+	minLonKey      = "min_lon"
+	maxLatKey      = "max_lat"
+	maxLonKey      = "max_lon"
+	latKey         = "lat"
+	lonKey         = "lon"
+	radiusKey      = "radius"
+	breakdownKey   = "breakdown"
+	intervalKey    = "interval"
+	splitKey       = "split"
+	periodKey      = "period"
+	companionsKey  = "companions_of"
+	statusKey      = "status"
+	notSuffix      = "!"
+	defOffset      = 0
+	defLimit       = 10
+	staticDir      = "./web/static"
 )
 
-// MakeHandler returns a HTTP handler for API endpoints.
-func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Logger) http.Handler {
+// MakeHandler returns a HTTP handler for API endpoints. The checks are run
+// by the readiness endpoint.
+func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Logger, checks map[string]ReadinessCheck) http.Handler {
 	opts := []kithttp.ServerOption{
 		kithttp.ServerErrorEncoder(LoggingErrorEncoder(logger, encodeError)),
 	}
@@ -60,6 +81,13 @@ func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Log
 		opts...,
 	))
 
+	mux.Get("/telemetry/churn", kithttp.NewServer(
+		otelkit.EndpointMiddleware(otelkit.WithOperation("retrieve-churn"), otelkit.WithTracerProvider(tp))(retrieveChurnEndpoint(svc)),
+		decodeRetrieve,
+		encodeResponse,
+		opts...,
+	))
+
 	mux.Get("/telemetry/summary", kithttp.NewServer(
 		otelkit.EndpointMiddleware(otelkit.WithOperation("retrieve-summary"), otelkit.WithTracerProvider(tp))(retrieveSummaryEndpoint(svc)),
 		decodeRetrieve,
@@ -67,6 +95,48 @@ func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Log
 		opts...,
 	))
 
+	mux.Get("/telemetry/timeseries", kithttp.NewServer(
+		otelkit.EndpointMiddleware(otelkit.WithOperation("retrieve-timeseries"), otelkit.WithTracerProvider(tp))(retrieveTimeseriesEndpoint(svc)),
+		decodeRetrieve,
+		encodeResponse,
+		opts...,
+	))
+
+	mux.Get("/telemetry/versions/adoption", kithttp.NewServer(
+		otelkit.EndpointMiddleware(otelkit.WithOperation("retrieve-adoption"), otelkit.WithTracerProvider(tp))(retrieveAdoptionEndpoint(svc)),
+		decodeRetrieve,
+		encodeResponse,
+		opts...,
+	))
+
+	mux.Get("/telemetry/versions/transitions", kithttp.NewServer(
+		otelkit.EndpointMiddleware(otelkit.WithOperation("retrieve-transitions"), otelkit.WithTracerProvider(tp))(retrieveTransitionsEndpoint(svc)),
+		decodeRetrieve,
+		encodeResponse,
+		opts...,
+	))
+
+	mux.Get("/telemetry/cohorts", kithttp.NewServer(
+		otelkit.EndpointMiddleware(otelkit.WithOperation("retrieve-cohorts"), otelkit.WithTracerProvider(tp))(retrieveCohortsEndpoint(svc)),
+		decodeRetrieve,
+		encodeResponse,
+		opts...,
+	))
+
+	mux.Get("/telemetry/services/cooccurrence", kithttp.NewServer(
+		otelkit.EndpointMiddleware(otelkit.WithOperation("retrieve-cooccurrence"), otelkit.WithTracerProvider(tp))(retrieveCooccurrenceEndpoint(svc)),
+		decodeRetrieve,
+		encodeResponse,
+		opts...,
+	))
+
+	mux.Post("/telemetry/erasures", kithttp.NewServer(
+		otelkit.EndpointMiddleware(otelkit.WithOperation("erase"), otelkit.WithTracerProvider(tp))(eraseEndpoint(svc)),
+		decodeEraseReq,
+		encodeResponse,
+		opts...,
+	))
+
 	mux.Get("/", kithttp.NewServer(
 		otelkit.EndpointMiddleware(otelkit.WithOperation("serve-ui"), otelkit.WithTracerProvider(tp))(serveUI(svc)),
 		decodeRetrieve,
@@ -75,6 +145,7 @@ func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Log
 	))
 
 	mux.GetFunc("/health", magistrala.Health("home", "telemetry"))
+	mux.GetFunc("/ready", readinessHandler(checks, logger))
 	mux.Handle("/metrics", promhttp.Handler())
 
 	// Static file handler
@@ -129,15 +200,34 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 		errors.Contains(err, ErrInvalidQueryParams),
 		errors.Contains(err, errors.ErrMalformedEntity),
 		err == ErrLimitSize,
-		err == ErrOffsetSize:
+		err == ErrOffsetSize,
+		err == ErrInvalidNetworkType,
+		err == ErrCursorWithOffset,
+		err == ErrStatusNotSupported,
+		err == ErrInvalidBoundingBox,
+		err == ErrInvalidRadius,
+		err == callhome.ErrAreaTooSmall,
+		err == callhome.ErrInvalidCursor,
+		err == callhome.ErrInvalidSort,
+		err == callhome.ErrInvalidDirection,
+		err == callhome.ErrInvalidBreakdown,
+		err == callhome.ErrInvalidInterval,
+		err == callhome.ErrInvalidSplit,
+		err == callhome.ErrInvalidPeriod,
+		err == callhome.ErrInvalidStatus:
 		w.WriteHeader(http.StatusBadRequest)
+	case errors.Contains(err, errors.ErrAuthentication):
+		w.WriteHeader(http.StatusUnauthorized)
 	case errors.Contains(err, timescale.ErrInvalidEvent):
 		w.WriteHeader(http.StatusForbidden)
 	case errors.Contains(err, errors.ErrUnsupportedContentType):
 		w.WriteHeader(http.StatusUnsupportedMediaType)
+	case errors.Contains(err, timescale.ErrQueryTimeout):
+		w.WriteHeader(http.StatusGatewayTimeout)
 	case errors.Contains(err, uuid.ErrGeneratingID):
 		w.WriteHeader(http.StatusInternalServerError)
 	case errors.Contains(err, timescale.ErrSaveEvent),
+		errors.Contains(err, timescale.ErrEraseEvents),
 		errors.Contains(err, timescale.ErrTransRollback):
 		w.WriteHeader(http.StatusInternalServerError)
 	default:
@@ -163,6 +253,26 @@ func decodeRetrieve(_ context.Context, r *http.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	cu, err := ReadStringQuery(r, cursorKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := ReadBoolQuery(r, skipTotalKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	so, err := ReadStringQuery(r, sortKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	di, err := ReadStringQuery(r, dirKey, "")
+	if err != nil {
+		return nil, err
+	}
+
 	fromString, err := ReadStringQuery(r, fromKey, "")
 	if err != nil {
 		return nil, err
@@ -187,39 +297,148 @@ func decodeRetrieve(_ context.Context, r *http.Request) (interface{}, error) {
 		}
 	}
 
-	co, err := ReadStringQuery(r, countryKey, "")
+	co := readFilter(r, countryKey)
+
+	ci := readFilter(r, cityKey)
+
+	ve := readFilter(r, versionKey)
+
+	se := readFilter(r, serviceKey)
+
+	pr := readFilter(r, providerKey)
+
+	nt := readFilter(r, networkTypeKey)
+
+	bb, err := readBoundingBox(r)
 	if err != nil {
 		return nil, err
 	}
 
-	ci, err := ReadStringQuery(r, cityKey, "")
+	rd, err := readRadius(r)
 	if err != nil {
 		return nil, err
 	}
 
-	ve, err := ReadStringQuery(r, versionKey, "")
+	bd := callhome.Breakdowns(ReadStringsQuery(r, breakdownKey))
+
+	in, err := ReadStringQuery(r, intervalKey, callhome.IntervalDay)
 	if err != nil {
 		return nil, err
 	}
 
-	se, err := ReadStringQuery(r, serviceKey, "")
+	sp, err := ReadStringQuery(r, splitKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	pe, err := ReadStringQuery(r, periodKey, callhome.IntervalWeek)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := ReadStringQuery(r, companionsKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	sa, err := ReadStringQuery(r, statusKey, "")
 	if err != nil {
 		return nil, err
 	}
 
 	req := listTelemetryReq{
-		offset:  o,
-		limit:   l,
-		from:    from,
-		to:      to,
-		country: co,
-		city:    ci,
-		version: ve,
-		service: se,
+		token:       ExtractBearerToken(r),
+		offset:      o,
+		limit:       l,
+		cursor:      cu,
+		skipTotal:   st,
+		sort:        so,
+		dir:         di,
+		from:        from,
+		to:          to,
+		country:     co,
+		city:        ci,
+		version:     ve,
+		service:     se,
+		provider:    pr,
+		networkType: nt,
+		boundingBox: bb,
+		radius:      rd,
+		breakdowns:  bd,
+		interval:    in,
+		split:       sp,
+		period:      pe,
+		companionOf: cs,
+		status:      sa,
 	}
 	return req, nil
 }
 
+// readFilter reads the values of a filter from the repeated key parameter,
+// and the excluded values from its negated form, e.g. country!=Kenya.
+func readFilter(r *http.Request, key string) callhome.Filter {
+	return callhome.Filter{
+		Values:   ReadStringsQuery(r, key),
+		Excluded: ReadStringsQuery(r, key+notSuffix),
+	}
+}
+
+// readBoundingBox reads the bounding box filter. All of its parameters are
+// required once any of them is given.
+func readBoundingBox(r *http.Request) (*callhome.BoundingBox, error) {
+	keys := []string{minLatKey, minLonKey, maxLatKey, maxLonKey}
+	vals, err := readFloats(r, keys...)
+	if err != nil || vals == nil {
+		return nil, err
+	}
+	if len(vals) != len(keys) {
+		return nil, ErrInvalidBoundingBox
+	}
+	return &callhome.BoundingBox{
+		MinLat: vals[minLatKey],
+		MinLon: vals[minLonKey],
+		MaxLat: vals[maxLatKey],
+		MaxLon: vals[maxLonKey],
+	}, nil
+}
+
+// readRadius reads the point-radius filter. All of its parameters are
+// required once any of them is given.
+func readRadius(r *http.Request) (*callhome.Radius, error) {
+	keys := []string{latKey, lonKey, radiusKey}
+	vals, err := readFloats(r, keys...)
+	if err != nil || vals == nil {
+		return nil, err
+	}
+	if len(vals) != len(keys) {
+		return nil, ErrInvalidRadius
+	}
+	return &callhome.Radius{
+		Lat:      vals[latKey],
+		Lon:      vals[lonKey],
+		Distance: vals[radiusKey],
+	}, nil
+}
+
+// readFloats reads the float parameters present in the request.
+func readFloats(r *http.Request, keys ...string) (map[string]float64, error) {
+	var vals map[string]float64
+	for _, key := range keys {
+		if len(bone.GetQuery(r, key)) == 0 {
+			continue
+		}
+		val, err := ReadFloatQuery(r, key, 0)
+		if err != nil {
+			return nil, err
+		}
+		if vals == nil {
+			vals = make(map[string]float64)
+		}
+		vals[key] = val
+	}
+	return vals, nil
+}
+
 func decodeSaveTelemetryReq(_ context.Context, r *http.Request) (interface{}, error) {
 	if !strings.Contains(r.Header.Get("Content-Type"), contentType) {
 		return nil, errors.ErrUnsupportedContentType
@@ -232,3 +451,16 @@ func decodeSaveTelemetryReq(_ context.Context, r *http.Request) (interface{}, er
 
 	return telemetry, nil
 }
+
+func decodeEraseReq(_ context.Context, r *http.Request) (interface{}, error) {
+	if !strings.Contains(r.Header.Get("Content-Type"), contentType) {
+		return nil, errors.ErrUnsupportedContentType
+	}
+
+	req := eraseReq{token: ExtractBearerToken(r)}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errors.Wrap(errors.ErrMalformedEntity, err)
+	}
+
+	return req, nil
+}
@@ -6,14 +6,19 @@ package api
 import (
 	"context"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/absmach/magistrala/pkg/errors"
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/go-zoo/bone"
 )
 
+// BearerPrefix represents the token prefix for Bearer authentication scheme.
+const BearerPrefix = "Bearer "
+
 // ErrorRes represents the HTTP error response body.
 type ErrorRes struct {
 	Err string `json:"error"`
@@ -49,6 +54,40 @@ func ReadUintQuery(r *http.Request, key string, def uint64) (uint64, error) {
 	return val, nil
 }
 
+// ReadFloatQuery reads the value of float64 http query parameters for a given key.
+func ReadFloatQuery(r *http.Request, key string, def float64) (float64, error) {
+	vals := bone.GetQuery(r, key)
+	if len(vals) > 1 {
+		return 0, ErrInvalidQueryParams
+	}
+	if len(vals) == 0 {
+		return def, nil
+	}
+	strval := vals[0]
+	val, err := strconv.ParseFloat(strval, 64)
+	if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+		return 0, ErrInvalidQueryParams
+	}
+	return val, nil
+}
+
+// ReadBoolQuery reads the value of boolean http query parameters for a given key.
+func ReadBoolQuery(r *http.Request, key string, def bool) (bool, error) {
+	vals := bone.GetQuery(r, key)
+	if len(vals) > 1 {
+		return false, ErrInvalidQueryParams
+	}
+	if len(vals) == 0 {
+		return def, nil
+	}
+	strval := vals[0]
+	val, err := strconv.ParseBool(strval)
+	if err != nil {
+		return false, ErrInvalidQueryParams
+	}
+	return val, nil
+}
+
 // ReadStringQuery reads the value of string http query parameters for a given key.
 func ReadStringQuery(r *http.Request, key string, def string) (string, error) {
 	vals := bone.GetQuery(r, key)
@@ -60,3 +99,26 @@ func ReadStringQuery(r *http.Request, key string, def string) (string, error) {
 	}
 	return vals[0], nil
 }
+
+// ReadStringsQuery reads all values of repeated string http query parameters
+// for a given key. Empty values are ignored.
+func ReadStringsQuery(r *http.Request, key string) []string {
+	var vals []string
+	for _, val := range bone.GetQuery(r, key) {
+		if val != "" {
+			vals = append(vals, val)
+		}
+	}
+	return vals
+}
+
+// ExtractBearerToken returns value of the bearer token. If there is no bearer token - an empty value is returned.
+func ExtractBearerToken(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(token, BearerPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(token, BearerPrefix)
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Network types a deployment can be classified as.
+const (
+	NetworkCloud   = "cloud"
+	NetworkISP     = "isp"
+	NetworkUnknown = "unknown"
+)
+
+// ErrInvalidASNRecord indicates a malformed line in the ASN database file.
+var ErrInvalidASNRecord = errors.New("invalid asn database record")
+
+// cloudASNs maps autonomous system numbers of well known cloud and hosting
+// providers to the provider name.
+var cloudASNs = map[uint32]string{
+	16509:  "AWS",
+	14618:  "AWS",
+	8987:   "AWS",
+	15169:  "GCP",
+	396982: "GCP",
+	19527:  "GCP",
+	8075:   "Azure",
+	8068:   "Azure",
+	8069:   "Azure",
+	24940:  "Hetzner",
+	213230: "Hetzner",
+	14061:  "DigitalOcean",
+	16276:  "OVH",
+	31898:  "Oracle",
+	45102:  "Alibaba",
+	63949:  "Linode",
+	12876:  "Scaleway",
+	20473:  "Vultr",
+}
+
+// cloudOrgs is used to classify networks whose ASN is not in cloudASNs by
+// their organisation name.
+var cloudOrgs = map[string]string{
+	"amazon":       "AWS",
+	"google cloud": "GCP",
+	"microsoft":    "Azure",
+	"hetzner":      "Hetzner",
+	"digitalocean": "DigitalOcean",
+	"ovh":          "OVH",
+	"oracle":       "Oracle",
+	"alibaba":      "Alibaba",
+	"linode":       "Linode",
+	"scaleway":     "Scaleway",
+	"vultr":        "Vultr",
+}
+
+var _ ASNService = (*asnService)(nil)
+
+// ASN represents the autonomous system an IP address belongs to and the
+// classification of its network.
+type ASN struct {
+	Number       uint32
+	Organization string
+	Provider     string
+	NetworkType  string
+}
+
+type asnEntry struct {
+	number uint32
+	org    string
+}
+
+type asnService struct {
+	// prefixes holds entries grouped by prefix length, longest first.
+	bits     []int
+	prefixes map[int]map[netip.Prefix]asnEntry
+}
+
+// ASNService provides a service for obtaining the autonomous system and
+// network classification of an IP address.
+type ASNService interface {
+	// GetASN returns the autonomous system information for a given IP address.
+	GetASN(ctx context.Context, ip string) (ASN, error)
+}
+
+// NewASNService creates a new ASNService from a CSV file. Both the
+// IP2Location LITE ASN format (ip_from, ip_to, cidr, asn, as) and a plain
+// CIDR range file (cidr, asn, as) are supported. An empty path yields a
+// service that classifies every address as unknown.
+func NewASNService(dbfilepath string) (ASNService, error) {
+	svc := &asnService{
+		prefixes: make(map[int]map[netip.Prefix]asnEntry),
+	}
+	if dbfilepath == "" {
+		return svc, nil
+	}
+
+	f, err := os.Open(dbfilepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) == 5 {
+			rec = rec[2:]
+		}
+		if len(rec) != 3 {
+			return nil, ErrInvalidASNRecord
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(rec[0]))
+		if err != nil {
+			// Skip the header line.
+			continue
+		}
+		num, err := strconv.ParseUint(strings.TrimSpace(rec[1]), 10, 32)
+		if err != nil {
+			// IP2Location marks unallocated ranges with "-".
+			continue
+		}
+		svc.add(prefix.Masked(), asnEntry{number: uint32(num), org: strings.TrimSpace(rec[2])})
+	}
+
+	return svc, nil
+}
+
+// GetASN returns the autonomous system information for a given IP address.
+func (as *asnService) GetASN(ctx context.Context, ip string) (ASN, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ASN{}, err
+	}
+	addr = addr.Unmap()
+	for _, bits := range as.bits {
+		if bits > addr.BitLen() {
+			continue
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if e, ok := as.prefixes[bits][prefix]; ok {
+			return Classify(e.number, e.org), nil
+		}
+	}
+	return Classify(0, ""), nil
+}
+
+func (as *asnService) add(prefix netip.Prefix, e asnEntry) {
+	bits := prefix.Bits()
+	if _, ok := as.prefixes[bits]; !ok {
+		as.prefixes[bits] = make(map[netip.Prefix]asnEntry)
+		i := 0
+		for i < len(as.bits) && as.bits[i] > bits {
+			i++
+		}
+		as.bits = append(as.bits[:i], append([]int{bits}, as.bits[i:]...)...)
+	}
+	as.prefixes[bits][prefix] = e
+}
+
+// Classify determines the network type and provider of an autonomous system.
+func Classify(number uint32, org string) ASN {
+	asn := ASN{
+		Number:       number,
+		Organization: org,
+		NetworkType:  NetworkUnknown,
+	}
+	if number == 0 {
+		return asn
+	}
+	if provider, ok := cloudASNs[number]; ok {
+		asn.Provider = provider
+		asn.NetworkType = NetworkCloud
+		return asn
+	}
+	lower := strings.ToLower(org)
+	for name, provider := range cloudOrgs {
+		if strings.Contains(lower, name) {
+			asn.Provider = provider
+			asn.NetworkType = NetworkCloud
+			return asn
+		}
+	}
+	asn.NetworkType = NetworkISP
+	return asn
+}
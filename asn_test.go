@@ -0,0 +1,59 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetASN(t *testing.T) {
+	ctx := context.TODO()
+	db := `"ip_from","ip_to","cidr","asn","as"
+"16777216","16777471","1.0.0.0/24","13335","CloudFlare Inc."
+"50331648","67108863","3.0.0.0/8","16509","Amazon.com Inc."
+"50331648","50331903","3.0.0.0/24","64512","Example Hosting GmbH"
+"83886080","83886335","5.0.0.0/24","-","-"
+"0","0","2a01:4f8::/32","24940","Hetzner Online GmbH"
+`
+	path := filepath.Join(t.TempDir(), "asn.csv")
+	assert.Nil(t, os.WriteFile(path, []byte(db), 0o600))
+
+	svc, err := callhome.NewASNService(path)
+	assert.Nil(t, err)
+
+	cases := []struct {
+		desc string
+		ip   string
+		asn  callhome.ASN
+		err  bool
+	}{
+		{"cloud by asn", "3.1.2.3", callhome.ASN{Number: 16509, Organization: "Amazon.com Inc.", Provider: "AWS", NetworkType: callhome.NetworkCloud}, false},
+		{"longest prefix match", "3.0.0.10", callhome.ASN{Number: 64512, Organization: "Example Hosting GmbH", NetworkType: callhome.NetworkISP}, false},
+		{"isp", "1.0.0.1", callhome.ASN{Number: 13335, Organization: "CloudFlare Inc.", NetworkType: callhome.NetworkISP}, false},
+		{"ipv6 cloud", "2a01:4f8:c17::1", callhome.ASN{Number: 24940, Organization: "Hetzner Online GmbH", Provider: "Hetzner", NetworkType: callhome.NetworkCloud}, false},
+		{"unallocated", "5.0.0.1", callhome.ASN{NetworkType: callhome.NetworkUnknown}, false},
+		{"not found", "8.8.8.8", callhome.ASN{NetworkType: callhome.NetworkUnknown}, false},
+		{"invalid ip", "invalid", callhome.ASN{}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			asn, err := svc.GetASN(ctx, c.ip)
+			assert.Equal(t, c.err, err != nil)
+			assert.Equal(t, c.asn, asn)
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	assert.Equal(t, callhome.NetworkCloud, callhome.Classify(1, "Microsoft Corporation").NetworkType)
+	assert.Equal(t, "Azure", callhome.Classify(1, "Microsoft Corporation").Provider)
+	assert.Equal(t, callhome.NetworkISP, callhome.Classify(1, "Deutsche Telekom AG").NetworkType)
+	assert.Equal(t, callhome.NetworkUnknown, callhome.Classify(0, "").NetworkType)
+}
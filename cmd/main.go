@@ -5,6 +5,8 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
@@ -20,10 +22,17 @@ import (
 	"github.com/absmach/callhome/internal/env"
 	"github.com/absmach/callhome/internal/server"
 	httpserver "github.com/absmach/callhome/internal/server/http"
+	"github.com/absmach/callhome/memory"
+	"github.com/absmach/callhome/sqlite"
 	"github.com/absmach/callhome/timescale"
 	"github.com/absmach/callhome/timescale/tracing"
 	stracing "github.com/absmach/callhome/tracing"
+	"github.com/absmach/magistrala/pkg/errors"
+	"github.com/absmach/magistrala/pkg/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	migrate "github.com/rubenv/sql-migrate"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
@@ -35,10 +44,70 @@ const (
 	defSvcHttpPort = "8855"
 )
 
+// Telemetry storage backends.
+const (
+	dbTimescale = "timescale"
+	dbSQLite    = "sqlite"
+	dbMemory    = "memory"
+)
+
+// Names of the readiness checks.
+const (
+	checkDatabase   = "database"
+	checkMigrations = "migrations"
+	checkGeo        = "geo_database"
+)
+
+// cursorKeyLen is the length of the random cursor key generated when none
+// is configured.
+const cursorKeyLen = 32
+
+// probeIP is looked up to check that the IP database is readable.
+const probeIP = "8.8.8.8"
+
+var (
+	errUnknownDB = errors.New("unknown telemetry database")
+	errRetention = errors.New("failed to apply retention policy")
+	errSpatial   = errors.New("failed to check spatial support")
+	errMigration = errors.New("failed to apply migrations")
+	errReplica   = errors.New("failed to connect to read replica")
+)
+
 type config struct {
-	LogLevel       string `env:"MG_CALLHOME_LOG_LEVEL"       envDefault:"info"`
-	JaegerURL      string `env:"MG_JAEGER_URL"               envDefault:"http://jaeger:14268/api/traces"`
-	IPDatabaseFile string `env:"MG_CALLHOME_IP_DB"           envDefault:"./IP2LOCATION-LITE-DB5.BIN"`
+	LogLevel        string        `env:"MG_CALLHOME_LOG_LEVEL"       envDefault:"info"`
+	JaegerURL       string        `env:"MG_JAEGER_URL"               envDefault:"http://jaeger:14268/api/traces"`
+	IPDatabaseFile  string        `env:"MG_CALLHOME_IP_DB"           envDefault:"./IP2LOCATION-LITE-DB5.BIN"`
+	ASNDatabaseFile string        `env:"MG_CALLHOME_ASN_DB"          envDefault:""`
+	AdminKey        string        `env:"MG_CALLHOME_ADMIN_KEY"       envDefault:""`
+	CursorKey       string        `env:"MG_CALLHOME_CURSOR_KEY"      envDefault:""`
+	Retention       time.Duration `env:"MG_CALLHOME_RETENTION"       envDefault:"2160h"`
+	DB              string        `env:"MG_CALLHOME_DB"              envDefault:"timescale"`
+	// MigrateOnStart applies pending migrations at startup. When it's unset,
+	// RequireMigrations refuses to start with pending migrations.
+	MigrateOnStart    bool `env:"MG_CALLHOME_MIGRATE_ON_START"   envDefault:"true"`
+	RequireMigrations bool `env:"MG_CALLHOME_REQUIRE_MIGRATIONS" envDefault:"false"`
+	// Statement timeouts of the TimescaleDB repository operations.
+	SaveTimeout     time.Duration `env:"MG_CALLHOME_SAVE_TIMEOUT"     envDefault:"5s"`
+	RetrieveTimeout time.Duration `env:"MG_CALLHOME_RETRIEVE_TIMEOUT" envDefault:"15s"`
+	SummaryTimeout  time.Duration `env:"MG_CALLHOME_SUMMARY_TIMEOUT"  envDefault:"30s"`
+}
+
+type precisionConfig struct {
+	Mode     string  `env:"MG_CALLHOME_COORDINATE_PRECISION" envDefault:"round"`
+	Decimals int     `env:"MG_CALLHOME_COORDINATE_DECIMALS"  envDefault:"1"`
+	GridSize float64 `env:"MG_CALLHOME_COORDINATE_GRID_SIZE" envDefault:"0.5"`
+}
+
+type statusConfig struct {
+	StaleAfter   time.Duration `env:"MG_CALLHOME_STALE_AFTER"   envDefault:"168h"`
+	DormantAfter time.Duration `env:"MG_CALLHOME_DORMANT_AFTER" envDefault:"720h"`
+	ChurnedAfter time.Duration `env:"MG_CALLHOME_CHURNED_AFTER" envDefault:"1440h"`
+}
+
+type privacyConfig struct {
+	Mode         string        `env:"MG_CALLHOME_PRIVACY_MODE"          envDefault:"keep"`
+	Key          string        `env:"MG_CALLHOME_PRIVACY_KEY"           envDefault:""`
+	SaltRotation time.Duration `env:"MG_CALLHOME_PRIVACY_SALT_ROTATION" envDefault:"720h"`
 }
 
 func main() {
@@ -50,13 +119,53 @@ func main() {
 		log.Fatalf("failed to load %s configuration : %s", svcName, err)
 	}
 
+	privCfg := privacyConfig{}
+	if err := env.Parse(&privCfg); err != nil {
+		log.Fatalf("failed to load %s privacy configuration : %s", svcName, err)
+	}
+
+	precCfg := precisionConfig{}
+	if err := env.Parse(&precCfg); err != nil {
+		log.Fatalf("failed to load %s coordinate precision configuration : %s", svcName, err)
+	}
+	if err := callhome.PrecisionConfig(precCfg).Validate(); err != nil {
+		log.Fatalf("invalid %s coordinate precision configuration : %s", svcName, err)
+	}
+
+	statusCfg := statusConfig{}
+	if err := env.Parse(&statusCfg); err != nil {
+		log.Fatalf("failed to load %s deployment status configuration : %s", svcName, err)
+	}
+	if err := callhome.StatusConfig(statusCfg).Validate(); err != nil {
+		log.Fatalf("invalid %s deployment status configuration : %s", svcName, err)
+	}
+	if err := callhome.StatusConfig(statusCfg).ValidateRetention(cfg.Retention); err != nil {
+		log.Fatalf("invalid %s deployment status configuration : %s", svcName, err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("failed to run migrations : %s", err)
+		}
+		return
+	}
+
 	logger, err := newLogger(os.Stdout, cfg.LogLevel)
 	if err != nil {
 		log.Fatalf("failed to init logger: %s", err.Error())
 	}
-	timescaleDB, err := postgres.Setup(envPrefix, timescale.Migration())
+	repo, checks, err := newRepo(ctx, logger, cfg)
 	if err != nil {
-		log.Fatalf("failed to setup timescale db : %s", err)
+		log.Fatalf("failed to setup %s db : %s", cfg.DB, err)
+	}
+
+	locSvc, err := callhome.NewLocationService(cfg.IPDatabaseFile)
+	if err != nil {
+		log.Fatalf("failed to load IP database : %s", err)
+	}
+	checks[checkGeo] = func(ctx context.Context) error {
+		_, err := locSvc.GetLocation(ctx, probeIP)
+		return err
 	}
 
 	tp, err := jaegerClient.NewProvider(svcName, cfg.JaegerURL)
@@ -65,7 +174,7 @@ func main() {
 	}
 	tracer := tp.Tracer(svcName)
 
-	svc, err := newService(ctx, logger, cfg.IPDatabaseFile, timescaleDB, tracer)
+	svc, err := newService(ctx, logger, cfg, callhome.PrivacyConfig(privCfg), callhome.PrecisionConfig(precCfg), callhome.StatusConfig(statusCfg), repo, locSvc, tracer)
 	if err != nil {
 		log.Fatalf("failed to initialize service: %s", err)
 	}
@@ -80,7 +189,7 @@ func main() {
 		logger.Error(fmt.Sprintf("failed to load %s HTTP server configuration : %s", svcName, err.Error()))
 		return
 	}
-	hs := httpserver.New(ctx, cancel, svcName, httpServerConfig, api.MakeHandler(svc, tp, logger), logger)
+	hs := httpserver.New(ctx, cancel, svcName, httpServerConfig, api.MakeHandler(svc, tp, logger, checks), logger)
 
 	g.Go(func() error {
 		return hs.Start()
@@ -95,15 +204,120 @@ func main() {
 	}
 }
 
-func newService(ctx context.Context, logger *slog.Logger, ipDB string, timescaleDB *sqlx.DB, tracer trace.Tracer) (callhome.Service, error) {
-	timescaleRepo := timescale.New(timescaleDB)
-	timescaleRepo = tracing.New(tracer, timescaleRepo)
-	locSvc, err := callhome.NewLocationService(ipDB)
+// newRepo sets up the telemetry repository of the configured backend along
+// with the readiness checks of its database. SQLite and the in-memory
+// repository are meant for development, and don't enforce the retention period.
+func newRepo(ctx context.Context, logger *slog.Logger, cfg config) (callhome.TelemetryRepo, map[string]api.ReadinessCheck, error) {
+	if cfg.DB == dbMemory {
+		return memory.New(), map[string]api.ReadinessCheck{}, nil
+	}
+
+	d, err := connect(cfg)
 	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case cfg.MigrateOnStart:
+		n, err := d.exec(migrate.Up, 0)
+		if err != nil {
+			return nil, nil, errors.Wrap(errMigration, err)
+		}
+		logger.Info(fmt.Sprintf("applied %d migrations", n))
+	case cfg.RequireMigrations:
+		if err := d.checkMigrations(); err != nil {
+			return nil, nil, err
+		}
+	}
+	checks := dbChecks(d)
+
+	db := d.db
+	switch cfg.DB {
+	case dbTimescale:
+		if err := timescale.ApplyRetention(ctx, db, cfg.Retention); err != nil {
+			return nil, nil, errors.Wrap(errRetention, err)
+		}
+		spatial, err := timescale.SpatialSupport(ctx, db)
+		if err != nil {
+			return nil, nil, errors.Wrap(errSpatial, err)
+		}
+		if !spatial {
+			logger.Warn("PostGIS is not installed, geographic filters use the coordinate columns")
+		}
+		reader, err := newReader(ctx, logger, db)
+		if err != nil {
+			return nil, nil, err
+		}
+		tsCfg := timescale.Config{
+			Retention:       cfg.Retention,
+			Spatial:         spatial,
+			Reader:          reader,
+			SaveTimeout:     cfg.SaveTimeout,
+			RetrieveTimeout: cfg.RetrieveTimeout,
+			SummaryTimeout:  cfg.SummaryTimeout,
+			Logger:          logger,
+		}
+		return timescale.New(db, tsCfg), checks, nil
+	default:
+		return sqlite.New(db), checks, nil
+	}
+}
+
+// dbChecks exports the statistics of the connection pool and returns the
+// readiness checks of the database.
+func dbChecks(d database) map[string]api.ReadinessCheck {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(d.db.DB, svcName))
+	return map[string]api.ReadinessCheck{
+		checkDatabase: d.db.PingContext,
+		checkMigrations: func(context.Context) error {
+			return d.checkMigrations()
+		},
+	}
+}
+
+// newReader connects to the configured read replica and returns the function
+// choosing the database reads are made from. It returns nil when no replica
+// is configured.
+func newReader(ctx context.Context, logger *slog.Logger, primary *sqlx.DB) (func() *sqlx.DB, error) {
+	replicaCfg := postgres.ReplicaConfig{}
+	if err := replicaCfg.LoadEnv(envPrefix); err != nil {
 		return nil, err
 	}
+	if replicaCfg.DSN == "" {
+		return nil, nil
+	}
+	db, err := postgres.ConnectReplica(replicaCfg)
+	if err != nil {
+		return nil, errors.Wrap(errReplica, err)
+	}
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db.DB, svcName+"_replica"))
+
+	replica := postgres.NewReplica(primary, db, logger)
+	go replica.Monitor(ctx, replicaCfg.CheckInterval)
+	return replica.Reader, nil
+}
+
+func newService(ctx context.Context, logger *slog.Logger, cfg config, privCfg callhome.PrivacyConfig, precCfg callhome.PrecisionConfig, statusCfg callhome.StatusConfig, repo callhome.TelemetryRepo, locSvc callhome.LocationService, tracer trace.Tracer) (callhome.Service, error) {
+	repo = tracing.New(tracer, repo)
 	locSvc = stracing.NewLocationService(tracer, locSvc)
-	svc := callhome.New(timescaleRepo, locSvc)
+	asnSvc, err := callhome.NewASNService(cfg.ASNDatabaseFile)
+	if err != nil {
+		return nil, err
+	}
+	asnSvc = stracing.NewASNService(tracer, asnSvc)
+	anon, err := callhome.NewAnonymizer(privCfg)
+	if err != nil {
+		return nil, err
+	}
+	cursorKey := cfg.CursorKey
+	if cursorKey == "" {
+		key := make([]byte, cursorKeyLen)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		cursorKey = hex.EncodeToString(key)
+		logger.Warn("MG_CALLHOME_CURSOR_KEY is not set, pagination cursors are only valid until the service restarts")
+	}
+	svc := callhome.New(repo, locSvc, asnSvc, anon, uuid.New(), callhome.Config{AdminKey: cfg.AdminKey, Precision: precCfg, Retention: cfg.Retention, Status: statusCfg, CursorKey: cursorKey})
 	svc = stracing.NewService(tracer, svc)
 	counter, latency := internal.MakeMetrics(svcName, "api")
 	svc = api.MetricsMiddleware(svc, counter, latency)
@@ -0,0 +1,202 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/absmach/callhome/internal/clients/postgres"
+	sqliteClient "github.com/absmach/callhome/internal/clients/sqlite"
+	"github.com/absmach/callhome/sqlite"
+	"github.com/absmach/callhome/timescale"
+	"github.com/absmach/magistrala/pkg/errors"
+	"github.com/jmoiron/sqlx"
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+const migrateUsage = `usage: callhome migrate <command>
+
+Commands:
+  up        apply all pending migrations
+  down [N]  roll back the last N applied migrations, 1 by default
+  status    list the migrations and when they were applied
+  redo      roll back and reapply the last applied migration`
+
+var (
+	errMigrateUsage      = errors.New(migrateUsage)
+	errNoMigrations      = errors.New("the in-memory database has no migrations")
+	errNothingToRedo     = errors.New("no migration has been applied")
+	errPendingMigrations = errors.New("database has unapplied migrations")
+)
+
+// database is an SQL database of the service along with its migrations.
+type database struct {
+	db         *sqlx.DB
+	dialect    string
+	migrations migrate.MemoryMigrationSource
+}
+
+// connect opens the database of the configured backend without migrating it.
+func connect(cfg config) (database, error) {
+	switch cfg.DB {
+	case dbTimescale:
+		dbCfg := postgres.Config{}
+		if err := dbCfg.LoadEnv(envPrefix); err != nil {
+			return database{}, err
+		}
+		db, err := postgres.Connect(dbCfg)
+		if err != nil {
+			return database{}, err
+		}
+		return database{db: db, dialect: "postgres", migrations: timescale.Migration()}, nil
+	case dbSQLite:
+		dbCfg := sqliteClient.Config{}
+		if err := dbCfg.LoadEnv(envPrefix); err != nil {
+			return database{}, err
+		}
+		db, err := sqliteClient.Connect(dbCfg)
+		if err != nil {
+			return database{}, err
+		}
+		return database{db: db, dialect: "sqlite3", migrations: sqlite.Migration()}, nil
+	case dbMemory:
+		return database{}, errNoMigrations
+	default:
+		return database{}, errUnknownDB
+	}
+}
+
+// exec applies up to steps migrations in the given direction, all of them
+// when steps is 0, and returns the number of applied migrations.
+func (d database) exec(dir migrate.MigrationDirection, steps int) (int, error) {
+	return migrate.ExecMax(d.db.DB, d.dialect, d.migrations, dir, steps)
+}
+
+// pending returns the number of migrations not applied to the database.
+func (d database) pending() (int, error) {
+	plan, _, err := migrate.PlanMigration(d.db.DB, d.dialect, d.migrations, migrate.Up, 0)
+	if err != nil {
+		return 0, err
+	}
+	return len(plan), nil
+}
+
+// checkMigrations returns errPendingMigrations if any migration is not applied.
+func (d database) checkMigrations() error {
+	n, err := d.pending()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errors.Wrap(errPendingMigrations, fmt.Errorf("%d pending", n))
+	}
+	return nil
+}
+
+// runMigrate runs the migrate subcommand with the given arguments.
+func runMigrate(cfg config, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+	steps := 0
+	switch args[0] {
+	case "up", "status", "redo":
+		if len(args) > 1 {
+			return errMigrateUsage
+		}
+	case "down":
+		switch len(args) {
+		case 1:
+			steps = 1
+		case 2:
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return errMigrateUsage
+			}
+			steps = n
+		default:
+			return errMigrateUsage
+		}
+	default:
+		return errMigrateUsage
+	}
+
+	d, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer d.db.Close()
+
+	switch args[0] {
+	case "up":
+		n, err := d.exec(migrate.Up, 0)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "applied %d migrations\n", n)
+	case "down":
+		n, err := d.exec(migrate.Down, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "rolled back %d migrations\n", n)
+	case "redo":
+		records, err := migrate.GetMigrationRecords(d.db.DB, d.dialect)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return errNothingToRedo
+		}
+		if _, err := d.exec(migrate.Down, 1); err != nil {
+			return err
+		}
+		if _, err := d.exec(migrate.Up, 1); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "reapplied migration %s\n", records[len(records)-1].Id)
+	case "status":
+		return d.status(w)
+	}
+	return nil
+}
+
+// status writes the migrations of the service and the time they were applied.
+// Applied migrations unknown to the service are listed last.
+func (d database) status(w io.Writer) error {
+	records, err := migrate.GetMigrationRecords(d.db.DB, d.dialect)
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]time.Time, len(records))
+	for _, r := range records {
+		applied[r.Id] = r.AppliedAt
+	}
+	migrations, err := d.migrations.FindMigrations()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MIGRATION\tAPPLIED AT")
+	for _, m := range migrations {
+		at, ok := applied[m.Id]
+		if !ok {
+			fmt.Fprintf(tw, "%s\tpending\n", m.Id)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", m.Id, at.Format(time.RFC3339))
+		delete(applied, m.Id)
+	}
+	for _, r := range records {
+		if _, ok := applied[r.Id]; ok {
+			fmt.Fprintf(tw, "%s\t%s (unknown)\n", r.Id, r.AppliedAt.Format(time.RFC3339))
+		}
+	}
+	return tw.Flush()
+}
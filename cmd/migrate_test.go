@@ -0,0 +1,64 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/absmach/callhome/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMigrate(t *testing.T) {
+	t.Setenv(envPrefix+"SQLITE_PATH", filepath.Join(t.TempDir(), "callhome.db"))
+	cfg := config{DB: dbSQLite}
+	ids := make([]string, len(sqlite.Migration().Migrations))
+	for i, m := range sqlite.Migration().Migrations {
+		ids[i] = m.Id
+	}
+
+	status := func() string {
+		var out bytes.Buffer
+		require.Nil(t, runMigrate(cfg, []string{"status"}, &out))
+		return out.String()
+	}
+
+	assert.Contains(t, status(), ids[0]+"  pending")
+
+	cases := []struct {
+		desc string
+		args []string
+		out  string
+		err  error
+	}{
+		{desc: "no command", args: nil, err: errMigrateUsage},
+		{desc: "unknown command", args: []string{"sideways"}, err: errMigrateUsage},
+		{desc: "invalid down steps", args: []string{"down", "-1"}, err: errMigrateUsage},
+		{desc: "extra arguments", args: []string{"up", "1"}, err: errMigrateUsage},
+		{desc: "redo without migrations", args: []string{"redo"}, err: errNothingToRedo},
+		{desc: "up", args: []string{"up"}, out: fmt.Sprintf("applied %d migrations\n", len(ids))},
+		{desc: "up without pending migrations", args: []string{"up"}, out: "applied 0 migrations\n"},
+		{desc: "redo", args: []string{"redo"}, out: "reapplied migration " + ids[len(ids)-1] + "\n"},
+		{desc: "down", args: []string{"down"}, out: "rolled back 1 migrations\n"},
+		{desc: "down past the first migration", args: []string{"down", strconv.Itoa(len(ids))}, out: fmt.Sprintf("rolled back %d migrations\n", len(ids)-1)},
+	}
+	for _, tc := range cases {
+		var out bytes.Buffer
+		err := runMigrate(cfg, tc.args, &out)
+		assert.Equal(t, tc.err, err, tc.desc)
+		assert.Equal(t, tc.out, out.String(), tc.desc)
+	}
+
+	require.Nil(t, runMigrate(cfg, []string{"up"}, &bytes.Buffer{}))
+	assert.False(t, strings.Contains(status(), "pending"))
+
+	_, err := connect(config{DB: dbMemory})
+	assert.Equal(t, errNoMigrations, err)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrInvalidPeriod indicates an unsupported cohort period.
+var ErrInvalidPeriod = errors.New("invalid cohort period")
+
+// Cohort is the group of deployments first seen within the period starting
+// at Start. Retention holds the fraction of them that reported in every
+// period since, the first being the period of the cohort itself.
+type Cohort struct {
+	Start         time.Time `json:"start"`
+	NoDeployments int       `json:"number_of_deployments"`
+	Retention     []float64 `json:"retention"`
+}
+
+// CohortActivity counts the deployments of the cohort starting at Cohort
+// that reported within the period starting at Period.
+type CohortActivity struct {
+	Cohort        time.Time `db:"cohort"`
+	Period        time.Time `db:"period"`
+	NoDeployments int       `db:"count"`
+}
+
+// ValidateCohortPeriod checks that cohorts can be grouped by the period.
+// Cohorts are weekly or monthly.
+func ValidateCohortPeriod(period string) error {
+	switch period {
+	case IntervalWeek, IntervalMonth:
+		return nil
+	default:
+		return ErrInvalidPeriod
+	}
+}
+
+// BuildCohorts computes the retention of the cohorts from their activity.
+// Retention is reported for every period up to the one containing end, or
+// now when end is zero. Cohorts are ordered by their start.
+func BuildCohorts(activity []CohortActivity, period string, end time.Time) []Cohort {
+	if end.IsZero() {
+		end = time.Now()
+	}
+	last := BucketStart(end, period)
+	byStart := make(map[int64]*Cohort)
+	var cohorts []*Cohort
+	for _, a := range activity {
+		start := a.Cohort.UTC()
+		c, ok := byStart[start.Unix()]
+		if !ok {
+			c = &Cohort{Start: start, Retention: make([]float64, max(periodsBetween(start, last, period)+1, 1))}
+			byStart[start.Unix()] = c
+			cohorts = append(cohorts, c)
+		}
+		n := periodsBetween(start, a.Period.UTC(), period)
+		if n < 0 || n >= len(c.Retention) {
+			continue
+		}
+		// Deployments report in the period they're first seen, so it
+		// holds the size of the cohort.
+		if n == 0 {
+			c.NoDeployments = a.NoDeployments
+		}
+		c.Retention[n] = float64(a.NoDeployments)
+	}
+
+	ret := make([]Cohort, 0, len(cohorts))
+	for _, c := range cohorts {
+		for i := range c.Retention {
+			if c.NoDeployments > 0 {
+				c.Retention[i] /= float64(c.NoDeployments)
+			}
+		}
+		ret = append(ret, *c)
+	}
+	slices.SortFunc(ret, func(a, b Cohort) int { return a.Start.Compare(b.Start) })
+	return ret
+}
+
+// periodsBetween returns the number of periods from the start of one period
+// to the start of another.
+func periodsBetween(from, to time.Time, period string) int {
+	if period == IntervalMonth {
+		return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+	}
+	return int(to.Sub(from) / (7 * 24 * time.Hour))
+}
@@ -0,0 +1,47 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCohortPeriod(t *testing.T) {
+	assert.Nil(t, callhome.ValidateCohortPeriod(callhome.IntervalWeek))
+	assert.Nil(t, callhome.ValidateCohortPeriod(callhome.IntervalMonth))
+	assert.Equal(t, callhome.ErrInvalidPeriod, callhome.ValidateCohortPeriod(callhome.IntervalDay))
+	assert.Equal(t, callhome.ErrInvalidPeriod, callhome.ValidateCohortPeriod(""))
+}
+
+func TestBuildCohorts(t *testing.T) {
+	// Weeks starting on Monday.
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 0, 7)
+	third := first.AddDate(0, 0, 14)
+	activity := []callhome.CohortActivity{
+		{Cohort: second, Period: second, NoDeployments: 2},
+		{Cohort: first, Period: first, NoDeployments: 4},
+		{Cohort: first, Period: third, NoDeployments: 1},
+		{Cohort: first, Period: second, NoDeployments: 2},
+		// Activity past the end is left out.
+		{Cohort: second, Period: third.AddDate(0, 0, 7), NoDeployments: 1},
+	}
+	assert.Equal(t, []callhome.Cohort{
+		{Start: first, NoDeployments: 4, Retention: []float64{1, 0.5, 0.25}},
+		{Start: second, NoDeployments: 2, Retention: []float64{1, 0}},
+	}, callhome.BuildCohorts(activity, callhome.IntervalWeek, third.Add(time.Hour)))
+
+	months := []callhome.CohortActivity{
+		{Cohort: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), Period: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), NoDeployments: 3},
+		{Cohort: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), Period: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), NoDeployments: 1},
+	}
+	assert.Equal(t, []callhome.Cohort{
+		{Start: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), NoDeployments: 3, Retention: []float64{1, 0, 1.0 / 3}},
+	}, callhome.BuildCohorts(months, callhome.IntervalMonth, time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC)))
+	assert.Empty(t, callhome.BuildCohorts(nil, callhome.IntervalWeek, time.Time{}))
+}
@@ -0,0 +1,157 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// CompanionShare is the share of the deployments running a service that must
+// also run another one for it to be a usual companion of the service.
+const CompanionShare = 0.5
+
+// DeploymentServices lists the services a deployment reported, in order.
+type DeploymentServices struct {
+	IpAddress string         `json:"ip_address" db:"ip_address"`
+	Services  pq.StringArray `json:"services" db:"services"`
+}
+
+// ServicePair counts the deployments running both services.
+type ServicePair struct {
+	Services      [2]string `json:"services"`
+	NoDeployments int       `json:"number_of_deployments"`
+}
+
+// ServiceSet counts the deployments running exactly the services.
+type ServiceSet struct {
+	Services      []string `json:"services"`
+	NoDeployments int      `json:"number_of_deployments"`
+}
+
+// ServiceOutlier is a deployment running a service without some of its usual
+// companions. The IP address is only reported to administrators.
+type ServiceOutlier struct {
+	IpAddress string   `json:"ip_address,omitempty"`
+	Services  []string `json:"services"`
+	Missing   []string `json:"missing"`
+}
+
+// CooccurrenceReport reports which services run together. Pairs are ordered
+// by the number of deployments, most first, and Sets are the most frequent
+// full sets of services. When a service is given, Companions are the services
+// usually running along with it, and Outliers the deployments running it
+// without them.
+type CooccurrenceReport struct {
+	NoDeployments int              `json:"number_of_deployments"`
+	Pairs         []ServicePair    `json:"pairs"`
+	Sets          []ServiceSet     `json:"sets"`
+	Service       string           `json:"service,omitempty"`
+	Companions    []string         `json:"companions,omitempty"`
+	Outliers      []ServiceOutlier `json:"outliers,omitempty"`
+}
+
+// AnalyzeCooccurrence reports the co-occurrence of the services of the
+// deployments. At most limit sets and outliers are reported, outliers being
+// ordered by the number of companions they miss, most first, then by their
+// missing and running services, so that the order doesn't give away their
+// addresses.
+func AnalyzeCooccurrence(deployments []DeploymentServices, service string, limit int) CooccurrenceReport {
+	report := CooccurrenceReport{NoDeployments: len(deployments), Service: service}
+	pairs := make(map[[2]string]int)
+	sets := make(map[string]int)
+	running := 0
+	companions := make(map[string]int)
+	for _, d := range deployments {
+		services := slices.Clone([]string(d.Services))
+		slices.Sort(services)
+		services = slices.Compact(services)
+		for i, a := range services {
+			for _, b := range services[i+1:] {
+				pairs[[2]string{a, b}]++
+			}
+		}
+		sets[strings.Join(services, "\x00")]++
+		if slices.Contains(services, service) {
+			running++
+			for _, s := range services {
+				if s != service {
+					companions[s]++
+				}
+			}
+		}
+	}
+
+	report.Pairs = make([]ServicePair, 0, len(pairs))
+	for p, n := range pairs {
+		report.Pairs = append(report.Pairs, ServicePair{Services: p, NoDeployments: n})
+	}
+	slices.SortFunc(report.Pairs, func(a, b ServicePair) int {
+		if c := cmp.Compare(b.NoDeployments, a.NoDeployments); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Services[0], b.Services[0]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Services[1], b.Services[1])
+	})
+
+	report.Sets = make([]ServiceSet, 0, len(sets))
+	for k, n := range sets {
+		report.Sets = append(report.Sets, ServiceSet{Services: strings.Split(k, "\x00"), NoDeployments: n})
+	}
+	slices.SortFunc(report.Sets, func(a, b ServiceSet) int {
+		if c := cmp.Compare(b.NoDeployments, a.NoDeployments); c != 0 {
+			return c
+		}
+		return slices.Compare(a.Services, b.Services)
+	})
+	if len(report.Sets) > limit {
+		report.Sets = report.Sets[:limit]
+	}
+
+	if service == "" {
+		return report
+	}
+	for s, n := range companions {
+		if float64(n) >= CompanionShare*float64(running) {
+			report.Companions = append(report.Companions, s)
+		}
+	}
+	slices.Sort(report.Companions)
+	for _, d := range deployments {
+		if !slices.Contains(d.Services, service) {
+			continue
+		}
+		var missing []string
+		for _, s := range report.Companions {
+			if !slices.Contains(d.Services, s) {
+				missing = append(missing, s)
+			}
+		}
+		if len(missing) > 0 {
+			report.Outliers = append(report.Outliers, ServiceOutlier{IpAddress: d.IpAddress, Services: d.Services, Missing: missing})
+		}
+	}
+	slices.SortFunc(report.Outliers, func(a, b ServiceOutlier) int {
+		if c := cmp.Compare(len(b.Missing), len(a.Missing)); c != 0 {
+			return c
+		}
+		if c := slices.Compare(a.Missing, b.Missing); c != 0 {
+			return c
+		}
+		if c := slices.Compare(a.Services, b.Services); c != 0 {
+			return c
+		}
+		// The address only keeps the order stable.
+		return cmp.Compare(a.IpAddress, b.IpAddress)
+	})
+	if len(report.Outliers) > limit {
+		report.Outliers = report.Outliers[:limit]
+	}
+	return report
+}
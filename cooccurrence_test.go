@@ -0,0 +1,64 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeCooccurrence(t *testing.T) {
+	deployments := []callhome.DeploymentServices{
+		{IpAddress: "10.0.0.4", Services: []string{"things", "users"}},
+		{IpAddress: "10.0.0.1", Services: []string{"bootstrap", "things", "users"}},
+		{IpAddress: "10.0.0.2", Services: []string{"things", "users"}},
+		{IpAddress: "10.0.0.3", Services: []string{"bootstrap", "users"}},
+		{IpAddress: "10.0.0.5", Services: []string{"users"}},
+	}
+
+	report := callhome.AnalyzeCooccurrence(deployments, "", 2)
+	assert.Equal(t, callhome.CooccurrenceReport{
+		NoDeployments: 5,
+		Pairs: []callhome.ServicePair{
+			{Services: [2]string{"things", "users"}, NoDeployments: 3},
+			{Services: [2]string{"bootstrap", "users"}, NoDeployments: 2},
+			{Services: [2]string{"bootstrap", "things"}, NoDeployments: 1},
+		},
+		Sets: []callhome.ServiceSet{
+			{Services: []string{"things", "users"}, NoDeployments: 2},
+			{Services: []string{"bootstrap", "things", "users"}, NoDeployments: 1},
+		},
+	}, report)
+
+	// Things runs along with users on three of the five deployments running
+	// users, bootstrap on only two of them.
+	report = callhome.AnalyzeCooccurrence(deployments, "users", 10)
+	assert.Equal(t, []string{"things"}, report.Companions)
+	assert.Equal(t, []callhome.ServiceOutlier{
+		{IpAddress: "10.0.0.3", Services: []string{"bootstrap", "users"}, Missing: []string{"things"}},
+		{IpAddress: "10.0.0.5", Services: []string{"users"}, Missing: []string{"things"}},
+	}, report.Outliers)
+
+	// Outliers missing more companions come first, whatever their addresses.
+	deployments = []callhome.DeploymentServices{
+		{IpAddress: "10.0.0.1", Services: []string{"bootstrap", "things", "users"}},
+		{IpAddress: "10.0.0.2", Services: []string{"bootstrap", "things", "users"}},
+		{IpAddress: "10.0.0.3", Services: []string{"bootstrap", "things", "users"}},
+		{IpAddress: "10.0.0.4", Services: []string{"things", "users"}},
+		{IpAddress: "10.0.0.5", Services: []string{"users"}},
+		{IpAddress: "10.0.0.6", Services: []string{"bootstrap", "users"}},
+	}
+	report = callhome.AnalyzeCooccurrence(deployments, "users", 10)
+	assert.Equal(t, []string{"bootstrap", "things"}, report.Companions)
+	assert.Equal(t, []callhome.ServiceOutlier{
+		{IpAddress: "10.0.0.5", Services: []string{"users"}, Missing: []string{"bootstrap", "things"}},
+		{IpAddress: "10.0.0.4", Services: []string{"things", "users"}, Missing: []string{"bootstrap"}},
+		{IpAddress: "10.0.0.6", Services: []string{"bootstrap", "users"}, Missing: []string{"things"}},
+	}, report.Outliers)
+
+	report = callhome.AnalyzeCooccurrence(nil, "users", 10)
+	assert.Equal(t, callhome.CooccurrenceReport{Pairs: []callhome.ServicePair{}, Sets: []callhome.ServiceSet{}, Service: "users"}, report)
+}
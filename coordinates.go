@@ -0,0 +1,227 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"math"
+)
+
+// Coordinate precision modes applied to public outputs.
+const (
+	// PrecisionExact leaves coordinates unchanged.
+	PrecisionExact = "exact"
+	// PrecisionRound rounds coordinates to Decimals decimal places.
+	PrecisionRound = "round"
+	// PrecisionGrid snaps coordinates to the centre of a GridSize degrees cell.
+	PrecisionGrid = "grid"
+	// PrecisionCity replaces coordinates with the centroid of all deployments
+	// in the same city. Deployments without a city, or in a city with fewer
+	// than minCityDeployments deployments, are rounded to whole degrees.
+	PrecisionCity = "city"
+)
+
+const (
+	maxDecimals  = 6
+	maxLatitude  = 90
+	maxLongitude = 180
+	// minCityDeployments is the number of deployments a city centroid is
+	// averaged over at least, so that it doesn't give away the coordinates
+	// of a deployment alone in its city.
+	minCityDeployments = 3
+)
+
+var (
+	// ErrInvalidPrecisionMode indicates an unknown coordinate precision mode.
+	ErrInvalidPrecisionMode = errors.New("invalid coordinate precision mode")
+	// ErrInvalidPrecision indicates invalid decimals or grid size.
+	ErrInvalidPrecision = errors.New("invalid coordinate precision")
+	// ErrAreaTooSmall indicates an area filter finer than the precision of
+	// public coordinates.
+	ErrAreaTooSmall = errors.New("area filter is smaller than the coordinate precision")
+)
+
+// PrecisionConfig defines how coordinates are generalised in public outputs.
+type PrecisionConfig struct {
+	Mode     string
+	Decimals int
+	GridSize float64
+}
+
+// Validate checks that the precision configuration is usable.
+func (pc PrecisionConfig) Validate() error {
+	switch pc.Mode {
+	case "", PrecisionExact, PrecisionCity:
+	case PrecisionRound:
+		if pc.Decimals < 0 || pc.Decimals > maxDecimals {
+			return ErrInvalidPrecision
+		}
+	case PrecisionGrid:
+		if pc.GridSize <= 0 || pc.GridSize > maxLatitude {
+			return ErrInvalidPrecision
+		}
+	default:
+		return ErrInvalidPrecisionMode
+	}
+	return nil
+}
+
+// Generalize reduces the precision of the coordinates of the telemetry events in place.
+// Unless coordinates are exact, the fields that would locate a deployment
+// more precisely than them are cleared.
+func (pc PrecisionConfig) Generalize(tels []Telemetry) {
+	if pc.Resolution() > 0 {
+		defer clearLocating(tels)
+	}
+	switch pc.Mode {
+	case PrecisionRound:
+		for i := range tels {
+			tels[i].Latitude = round(tels[i].Latitude, pc.Decimals)
+			tels[i].Longitude = round(tels[i].Longitude, pc.Decimals)
+		}
+	case PrecisionGrid:
+		for i := range tels {
+			tels[i].Latitude = math.Min(snap(tels[i].Latitude, pc.GridSize), maxLatitude)
+			tels[i].Longitude = snap(tels[i].Longitude, pc.GridSize)
+		}
+	case PrecisionCity:
+		type centroid struct {
+			lat, lon float64
+			n        int
+		}
+		centroids := make(map[[3]string]*centroid)
+		for _, t := range tels {
+			if t.City == "" {
+				continue
+			}
+			key := [3]string{t.Country, t.Region, t.City}
+			c, ok := centroids[key]
+			if !ok {
+				c = &centroid{}
+				centroids[key] = c
+			}
+			c.lat += t.Latitude
+			c.lon += t.Longitude
+			c.n++
+		}
+		for i := range tels {
+			c := centroids[[3]string{tels[i].Country, tels[i].Region, tels[i].City}]
+			if tels[i].City == "" || c.n < minCityDeployments {
+				tels[i].Latitude = round(tels[i].Latitude, 0)
+				tels[i].Longitude = round(tels[i].Longitude, 0)
+				continue
+			}
+			tels[i].Latitude = c.lat / float64(c.n)
+			tels[i].Longitude = c.lon / float64(c.n)
+		}
+	}
+}
+
+// clearLocating clears the region, postal code, timezone and autonomous
+// system of the telemetry events. Together they narrow a deployment down
+// well below its generalised coordinates.
+func clearLocating(tels []Telemetry) {
+	for i := range tels {
+		tels[i].Region = ""
+		tels[i].PostalCode = ""
+		tels[i].Timezone = ""
+		tels[i].ASN = 0
+		tels[i].ASOrg = ""
+	}
+}
+
+// Resolution returns the size in degrees of the areas coordinates are
+// generalised to, zero when they're exact.
+func (pc PrecisionConfig) Resolution() float64 {
+	switch pc.Mode {
+	case PrecisionRound:
+		return math.Pow10(-pc.Decimals)
+	case PrecisionGrid:
+		return pc.GridSize
+	case PrecisionCity:
+		// Deployments that don't share a centroid are rounded to whole degrees.
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ValidateArea checks that the sides of the bounding box and the diameter of
+// the radius filter are at least the resolution, so that public requests
+// can't locate deployments more precisely than their public coordinates do.
+func (pc PrecisionConfig) ValidateArea(filters TelemetryFilters) error {
+	res := pc.Resolution()
+	if bb := filters.BoundingBox; bb != nil {
+		width := bb.MaxLon - bb.MinLon
+		if width < 0 {
+			width += 360
+		}
+		if bb.MaxLat-bb.MinLat < res || width < res {
+			return ErrAreaTooSmall
+		}
+	}
+	if rd := filters.Radius; rd != nil && 2*rd.Distance < res*earthRadius*math.Pi/180 {
+		return ErrAreaTooSmall
+	}
+	return nil
+}
+
+// PublicArea validates the area filters of a public request and snaps them
+// to the cells coordinates are generalised to. Box edges are moved outwards
+// onto cell boundaries, the centre of the radius onto the centre of its cell
+// and the radius up to a multiple of the resolution, so that moving the area
+// in small steps doesn't tell where in its cell a deployment is.
+func (pc PrecisionConfig) PublicArea(filters TelemetryFilters) (TelemetryFilters, error) {
+	if err := pc.ValidateArea(filters); err != nil {
+		return TelemetryFilters{}, err
+	}
+	res := pc.Resolution()
+	if res == 0 {
+		return filters, nil
+	}
+	// Rounded coordinates are the centres of their cells, while grid cells
+	// start at multiples of the grid size.
+	offset, centre := res/2, func(v float64) float64 { return math.Round(v/res) * res }
+	if pc.Mode == PrecisionGrid {
+		offset, centre = 0, func(v float64) float64 { return snap(v, res) }
+	}
+	if bb := filters.BoundingBox; bb != nil {
+		filters.BoundingBox = &BoundingBox{
+			MinLat: math.Max(floorCell(bb.MinLat, res, offset), -maxLatitude),
+			MinLon: math.Max(floorCell(bb.MinLon, res, offset), -maxLongitude),
+			MaxLat: math.Min(ceilCell(bb.MaxLat, res, offset), maxLatitude),
+			MaxLon: math.Min(ceilCell(bb.MaxLon, res, offset), maxLongitude),
+		}
+	}
+	if rd := filters.Radius; rd != nil {
+		step := res * earthRadius * math.Pi / 180
+		filters.Radius = &Radius{
+			Lat:      math.Max(math.Min(centre(rd.Lat), maxLatitude), -maxLatitude),
+			Lon:      math.Max(math.Min(centre(rd.Lon), maxLongitude), -maxLongitude),
+			Distance: math.Ceil(rd.Distance/step) * step,
+		}
+	}
+	return filters, nil
+}
+
+// floorCell returns the nearest boundary of cells of the size, offset from
+// multiples of it, at or below v.
+func floorCell(v, size, offset float64) float64 {
+	return math.Floor((v-offset)/size)*size + offset
+}
+
+// ceilCell returns the nearest boundary of cells of the size, offset from
+// multiples of it, at or above v.
+func ceilCell(v, size, offset float64) float64 {
+	return math.Ceil((v-offset)/size)*size + offset
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Round(v*p) / p
+}
+
+func snap(v, size float64) float64 {
+	return math.Floor(v/size)*size + size/2
+}
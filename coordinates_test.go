@@ -0,0 +1,158 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneralize(t *testing.T) {
+	tels := func() []callhome.Telemetry {
+		return []callhome.Telemetry{
+			{Country: "France", Region: "Ile-de-France", City: "Paris", PostalCode: "75004", Timezone: "Europe/Paris", ASN: 3215, ASOrg: "Orange", Latitude: 48.85661, Longitude: 2.35222},
+			{Country: "France", Region: "Ile-de-France", City: "Paris", Latitude: 48.86661, Longitude: 2.33222},
+			{Country: "France", Region: "Ile-de-France", City: "Paris", Latitude: 48.84661, Longitude: 2.34222},
+			{Country: "Kenya", Latitude: -1.28638, Longitude: 36.81722},
+			{Country: "France", City: "Lyon", Latitude: 45.76404, Longitude: 4.83566},
+		}
+	}
+
+	cases := []struct {
+		desc string
+		cfg  callhome.PrecisionConfig
+		lat  []float64
+		lon  []float64
+	}{
+		{"exact", callhome.PrecisionConfig{Mode: callhome.PrecisionExact}, []float64{48.85661, 48.86661, 48.84661, -1.28638, 45.76404}, []float64{2.35222, 2.33222, 2.34222, 36.81722, 4.83566}},
+		{"round", callhome.PrecisionConfig{Mode: callhome.PrecisionRound, Decimals: 1}, []float64{48.9, 48.9, 48.8, -1.3, 45.8}, []float64{2.4, 2.3, 2.3, 36.8, 4.8}},
+		{"grid", callhome.PrecisionConfig{Mode: callhome.PrecisionGrid, GridSize: 0.5}, []float64{48.75, 48.75, 48.75, -1.25, 45.75}, []float64{2.25, 2.25, 2.25, 36.75, 4.75}},
+		// Lyon has a single deployment, so it is rounded like deployments without a city.
+		{"city", callhome.PrecisionConfig{Mode: callhome.PrecisionCity}, []float64{48.85661, 48.85661, 48.85661, -1, 46}, []float64{2.34222, 2.34222, 2.34222, 37, 5}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.Nil(t, c.cfg.Validate())
+			res := tels()
+			c.cfg.Generalize(res)
+			for i := range res {
+				assert.InDelta(t, c.lat[i], res[i].Latitude, 1e-9)
+				assert.InDelta(t, c.lon[i], res[i].Longitude, 1e-9)
+			}
+			if c.cfg.Mode == callhome.PrecisionExact {
+				assert.Equal(t, tels()[0], res[0])
+				return
+			}
+			// Only the country and city are left to locate deployments by.
+			assert.Equal(t, callhome.Telemetry{Country: "France", City: "Paris", Latitude: res[0].Latitude, Longitude: res[0].Longitude}, res[0])
+		})
+	}
+}
+
+func TestPrecisionValidate(t *testing.T) {
+	assert.Equal(t, callhome.ErrInvalidPrecisionMode, callhome.PrecisionConfig{Mode: "invalid"}.Validate())
+	assert.Equal(t, callhome.ErrInvalidPrecision, callhome.PrecisionConfig{Mode: callhome.PrecisionRound, Decimals: -1}.Validate())
+	assert.Equal(t, callhome.ErrInvalidPrecision, callhome.PrecisionConfig{Mode: callhome.PrecisionGrid}.Validate())
+}
+
+func TestValidateArea(t *testing.T) {
+	round := callhome.PrecisionConfig{Mode: callhome.PrecisionRound, Decimals: 1}
+	testCases := []struct {
+		desc    string
+		pc      callhome.PrecisionConfig
+		filters callhome.TelemetryFilters
+		err     error
+	}{
+		{"no area", round, callhome.TelemetryFilters{}, nil},
+		{"box of a cell", round, callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: 48.8, MinLon: 2.3, MaxLat: 48.9, MaxLon: 2.4}}, nil},
+		{"box narrower than a cell", round, callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: 48.8, MinLon: 2.35, MaxLat: 48.9, MaxLon: 2.36}}, callhome.ErrAreaTooSmall},
+		{"box crossing the antimeridian", round, callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: -20, MinLon: 179.95, MaxLat: -10, MaxLon: -179.95}}, nil},
+		{"radius of a cell", round, callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.85, Lon: 2.35, Distance: 6}}, nil},
+		{"radius smaller than a cell", round, callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.85, Lon: 2.35, Distance: 1}}, callhome.ErrAreaTooSmall},
+		{"radius smaller than a grid cell", callhome.PrecisionConfig{Mode: callhome.PrecisionGrid, GridSize: 0.5}, callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.85, Lon: 2.35, Distance: 20}}, callhome.ErrAreaTooSmall},
+		{"exact coordinates", callhome.PrecisionConfig{Mode: callhome.PrecisionExact}, callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.85, Lon: 2.35, Distance: 0.1}}, nil},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.err, tc.pc.ValidateArea(tc.filters), tc.desc)
+	}
+}
+
+func TestPublicArea(t *testing.T) {
+	round := callhome.PrecisionConfig{Mode: callhome.PrecisionRound, Decimals: 1}
+	grid := callhome.PrecisionConfig{Mode: callhome.PrecisionGrid, GridSize: 0.5}
+	cell := 0.1 * 6371 * math.Pi / 180
+	testCases := []struct {
+		desc    string
+		pc      callhome.PrecisionConfig
+		filters callhome.TelemetryFilters
+		box     *callhome.BoundingBox
+		radius  *callhome.Radius
+		err     error
+	}{
+		{
+			desc:    "box snapped to rounding cells",
+			pc:      round,
+			filters: callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: 48.83, MinLon: 2.31, MaxLat: 48.96, MaxLon: 2.44}},
+			box:     &callhome.BoundingBox{MinLat: 48.75, MinLon: 2.25, MaxLat: 49.05, MaxLon: 2.45},
+		},
+		{
+			// Moving an edge within a cell doesn't change the area.
+			desc:    "box moved within the cells",
+			pc:      round,
+			filters: callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: 48.76, MinLon: 2.29, MaxLat: 48.99, MaxLon: 2.42}},
+			box:     &callhome.BoundingBox{MinLat: 48.75, MinLon: 2.25, MaxLat: 49.05, MaxLon: 2.45},
+		},
+		{
+			desc:    "box snapped to grid cells",
+			pc:      grid,
+			filters: callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: 48.8, MinLon: 2.1, MaxLat: 49.6, MaxLon: 179.9}},
+			box:     &callhome.BoundingBox{MinLat: 48.5, MinLon: 2, MaxLat: 50, MaxLon: 180},
+		},
+		{
+			desc:    "radius snapped to the cell centre",
+			pc:      round,
+			filters: callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.8634, Lon: 2.3412, Distance: 6}},
+			radius:  &callhome.Radius{Lat: 48.9, Lon: 2.3, Distance: cell},
+		},
+		{
+			desc:    "radius snapped to the grid cell centre",
+			pc:      grid,
+			filters: callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.8634, Lon: 2.3412, Distance: 60}},
+			radius:  &callhome.Radius{Lat: 48.75, Lon: 2.25, Distance: 2 * 5 * cell},
+		},
+		{
+			desc:    "exact coordinates",
+			pc:      callhome.PrecisionConfig{Mode: callhome.PrecisionExact},
+			filters: callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.8634, Lon: 2.3412, Distance: 0.1}},
+			radius:  &callhome.Radius{Lat: 48.8634, Lon: 2.3412, Distance: 0.1},
+		},
+		{
+			desc:    "area too small",
+			pc:      round,
+			filters: callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.85, Lon: 2.35, Distance: 1}},
+			err:     callhome.ErrAreaTooSmall,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			filters, err := tc.pc.PublicArea(tc.filters)
+			assert.Equal(t, tc.err, err)
+			if tc.box != nil {
+				assert.InDelta(t, tc.box.MinLat, filters.BoundingBox.MinLat, 1e-9)
+				assert.InDelta(t, tc.box.MinLon, filters.BoundingBox.MinLon, 1e-9)
+				assert.InDelta(t, tc.box.MaxLat, filters.BoundingBox.MaxLat, 1e-9)
+				assert.InDelta(t, tc.box.MaxLon, filters.BoundingBox.MaxLon, 1e-9)
+			}
+			if tc.radius != nil {
+				assert.InDelta(t, tc.radius.Lat, filters.Radius.Lat, 1e-9)
+				assert.InDelta(t, tc.radius.Lon, filters.Radius.Lon, 1e-9)
+				assert.InDelta(t, tc.radius.Distance, filters.Radius.Distance, 1e-9)
+			}
+		})
+	}
+}
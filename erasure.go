@@ -0,0 +1,42 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"time"
+)
+
+// Erasure subjects.
+const (
+	SubjectIPAddress  = "ip_address"
+	SubjectDeployment = "deployment"
+)
+
+const fingerprintPrefix = "hmac:"
+
+// ErrMissingBlocklistKey indicates an IP address was to be blocklisted
+// without a privacy key to fingerprint it with.
+var ErrMissingBlocklistKey = errors.New("privacy key is required to blocklist IP addresses")
+
+// ErasureRequest identifies the deployment whose data is to be erased.
+// Exactly one of IpAddress and Deployment is set. Deployment is the
+// identifier the deployment is stored under, i.e. the anonymized IP address.
+type ErasureRequest struct {
+	IpAddress  string
+	Deployment string
+	Blocklist  bool
+	Reason     string
+}
+
+// ErasureReceipt is the audit record of a completed erasure. It doesn't
+// contain the erased identifiers.
+type ErasureReceipt struct {
+	ID             string    `json:"id" db:"id"`
+	Subject        string    `json:"subject" db:"subject"`
+	RecordsRemoved uint64    `json:"records_removed" db:"records_removed"`
+	Blocklisted    bool      `json:"blocklisted" db:"blocklisted"`
+	Reason         string    `json:"reason,omitempty" db:"reason"`
+	ErasedAt       time.Time `json:"erased_at" db:"erased_at"`
+}
@@ -4,7 +4,9 @@
 package postgres
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/absmach/callhome/internal/env"
 	"github.com/absmach/magistrala/pkg/errors"
@@ -19,6 +21,15 @@ var (
 	errMigration = errors.New("failed to apply migrations")
 )
 
+// Bounds of the delay between connection attempts at startup.
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+// defConnectTimeout is used when PoolConfig.ConnectTimeout isn't set.
+const defConnectTimeout = time.Minute
+
 // Config defines the options that are used when connecting to a TimescaleSQL instance.
 type Config struct {
 	Host        string `env:"TIMESCALE_HOST"            envDefault:"localhost"`
@@ -30,6 +41,29 @@ type Config struct {
 	SSLCert     string `env:"TIMESCALE_SSL_CERT"        envDefault:""`
 	SSLKey      string `env:"TIMESCALE_SSL_KEY"         envDefault:""`
 	SSLRootCert string `env:"TIMESCALE_SSL_ROOT_CERT"   envDefault:""`
+
+	Pool PoolConfig `envPrefix:"TIMESCALE_"`
+}
+
+// PoolConfig defines the options of a connection pool.
+type PoolConfig struct {
+	MaxOpenConns    int           `env:"MAX_OPEN_CONNS"     envDefault:"20"`
+	MaxIdleConns    int           `env:"MAX_IDLE_CONNS"     envDefault:"5"`
+	ConnMaxLifetime time.Duration `env:"CONN_MAX_LIFETIME"  envDefault:"30m"`
+	ConnMaxIdleTime time.Duration `env:"CONN_MAX_IDLE_TIME" envDefault:"5m"`
+	// ConnectTimeout bounds how long connecting retries reaching the
+	// database. Zero uses the default of a minute.
+	ConnectTimeout time.Duration `env:"CONNECT_TIMEOUT" envDefault:"1m"`
+}
+
+// ReplicaConfig defines the options that are used when connecting to a read
+// replica. The replica is disabled when DSN is empty.
+type ReplicaConfig struct {
+	DSN string `env:"TIMESCALE_REPLICA_DSN" envDefault:""`
+	// CheckInterval is how often the health of the replica is checked.
+	CheckInterval time.Duration `env:"TIMESCALE_REPLICA_CHECK_INTERVAL" envDefault:"10s"`
+
+	Pool PoolConfig `envPrefix:"TIMESCALE_REPLICA_"`
 }
 
 // Setup creates a connection to the PostgreSQL instance and applies any
@@ -61,18 +95,66 @@ func SetupDB(cfg Config, migrations migrate.MemoryMigrationSource) (*sqlx.DB, er
 	return db, nil
 }
 
-// Connect creates a connection to the PostgreSQL instance.
+// Connect creates a connection pool to the PostgreSQL instance and waits for
+// the instance to accept connections, retrying with an exponential backoff
+// for up to the connect timeout.
 func Connect(cfg Config) (*sqlx.DB, error) {
 	url := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=%s sslcert=%s sslkey=%s sslrootcert=%s", cfg.Host, cfg.Port, cfg.User, cfg.Name, cfg.Pass, cfg.SSLMode, cfg.SSLCert, cfg.SSLKey, cfg.SSLRootCert)
 
-	db, err := sqlx.Open("pgx", url)
+	db, err := open(url, cfg.Pool)
+	if err != nil {
+		return nil, err
+	}
+	if err := ping(db, cfg.Pool.ConnectTimeout); err != nil {
+		db.Close()
+		return nil, errors.Wrap(errConnect, err)
+	}
+	return db, nil
+}
+
+// ConnectReplica creates a connection pool to the read replica without
+// waiting for it to accept connections, so that an unreachable replica
+// doesn't keep the service from starting. Replica routes reads to it once
+// it answers.
+func ConnectReplica(cfg ReplicaConfig) (*sqlx.DB, error) {
+	return open(cfg.DSN, cfg.Pool)
+}
+
+func open(dsn string, cfg PoolConfig) (*sqlx.DB, error) {
+	db, err := sqlx.Open("pgx", dsn)
 	if err != nil {
 		return nil, errors.Wrap(errConnect, err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
 	return db, nil
 }
 
+func ping(db *sqlx.DB, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defConnectTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	backoff := minBackoff
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
 // MigrateDB applies any unapplied database migrations.
 func MigrateDB(db *sqlx.DB, migrations migrate.MemoryMigrationSource) error {
 	_, err := migrate.Exec(db.DB, "postgres", migrations, migrate.Up)
@@ -88,3 +170,10 @@ func (c *Config) LoadEnv(prefix string) error {
 	}
 	return nil
 }
+
+func (c *ReplicaConfig) LoadEnv(prefix string) error {
+	if err := env.Parse(c, env.Options{Prefix: prefix}); err != nil {
+		return errors.Wrap(errConfig, err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Replica routes reads to a read replica while it's healthy, and to the
+// primary database otherwise.
+type Replica struct {
+	primary *sqlx.DB
+	replica *sqlx.DB
+	healthy atomic.Bool
+	logger  *slog.Logger
+}
+
+// NewReplica returns a router between the primary database and its replica.
+// Reads use the primary until a check finds the replica healthy.
+func NewReplica(primary, replica *sqlx.DB, logger *slog.Logger) *Replica {
+	return &Replica{primary: primary, replica: replica, logger: logger}
+}
+
+// Reader returns the database reads are routed to.
+func (r *Replica) Reader() *sqlx.DB {
+	if r.healthy.Load() {
+		return r.replica
+	}
+	return r.primary
+}
+
+// Monitor checks the health of the replica right away and then every
+// interval until the context is done.
+func (r *Replica) Monitor(ctx context.Context, interval time.Duration) {
+	r.check(ctx, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check(ctx, interval)
+		}
+	}
+}
+
+// check pings the replica and updates its health, logging changes.
+func (r *Replica) check(ctx context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := r.replica.PingContext(ctx)
+	healthy := err == nil
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		r.logger.Info("read replica is healthy, routing reads to the replica")
+		return
+	}
+	r.logger.Warn(fmt.Sprintf("read replica is unhealthy, routing reads to the primary: %s", err))
+}
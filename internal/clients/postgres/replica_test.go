@@ -0,0 +1,94 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplica(t *testing.T) {
+	primaryDB, _, err := sqlmock.New()
+	require.Nil(t, err)
+	defer primaryDB.Close()
+	replicaDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.Nil(t, err)
+	defer replicaDB.Close()
+
+	primary := sqlx.NewDb(primaryDB, "sqlmock")
+	replica := sqlx.NewDb(replicaDB, "sqlmock")
+	r := NewReplica(primary, replica, slog.Default())
+	assert.Same(t, primary, r.Reader(), "reads use the primary until the replica answers")
+
+	mock.ExpectPing()
+	r.check(context.Background(), time.Second)
+	assert.Same(t, replica, r.Reader())
+
+	mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+	r.check(context.Background(), time.Second)
+	assert.Same(t, primary, r.Reader(), "reads fall back to the primary")
+
+	mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+	r.check(context.Background(), time.Second)
+	assert.Same(t, primary, r.Reader())
+
+	mock.ExpectPing()
+	r.check(context.Background(), time.Second)
+	assert.Same(t, replica, r.Reader(), "reads return to the recovered replica")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestReplicaConfig(t *testing.T) {
+	t.Setenv("MG_TEST_TIMESCALE_REPLICA_DSN", "host=replica")
+	t.Setenv("MG_TEST_TIMESCALE_REPLICA_MAX_OPEN_CONNS", "50")
+	t.Setenv("MG_TEST_TIMESCALE_MAX_OPEN_CONNS", "10")
+
+	var cfg ReplicaConfig
+	require.Nil(t, cfg.LoadEnv("MG_TEST_"))
+	assert.Equal(t, "host=replica", cfg.DSN)
+	assert.Equal(t, 50, cfg.Pool.MaxOpenConns)
+	assert.Equal(t, 5, cfg.Pool.MaxIdleConns)
+
+	var primary Config
+	require.Nil(t, primary.LoadEnv("MG_TEST_"))
+	assert.Equal(t, 10, primary.Pool.MaxOpenConns)
+	assert.Equal(t, time.Minute, primary.Pool.ConnectTimeout)
+}
+
+func TestPingRetries(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.Nil(t, err)
+	defer sqlDB.Close()
+
+	// An unset timeout retries for the default timeout rather than giving up.
+	mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+	mock.ExpectPing()
+	assert.Nil(t, ping(sqlx.NewDb(sqlDB, "sqlmock"), 0))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestConnectUnreachableReplica(t *testing.T) {
+	// Connecting doesn't wait for the replica, so it can't keep the service
+	// from starting.
+	db, err := ConnectReplica(ReplicaConfig{DSN: "host=127.0.0.1 port=1 connect_timeout=1", Pool: PoolConfig{ConnectTimeout: time.Minute}})
+	require.Nil(t, err)
+	defer db.Close()
+
+	primaryDB, _, err := sqlmock.New()
+	require.Nil(t, err)
+	defer primaryDB.Close()
+	primary := sqlx.NewDb(primaryDB, "sqlmock")
+
+	r := NewReplica(primary, db, slog.Default())
+	r.check(context.Background(), time.Second)
+	assert.Same(t, primary, r.Reader())
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/internal/env"
+	"github.com/absmach/magistrala/pkg/errors"
+	"github.com/jmoiron/sqlx"
+	migrate "github.com/rubenv/sql-migrate"
+	"modernc.org/sqlite"
+)
+
+// driverName is the name the pure Go SQLite driver is registered under, so
+// that the service builds without cgo.
+const driverName = "sqlite"
+
+var (
+	errConfig    = errors.New("failed to load sqlite configuration")
+	errConnect   = errors.New("failed to open sqlite database")
+	errMigration = errors.New("failed to apply migrations")
+)
+
+func init() {
+	// Functions are registered for all connections opened afterwards.
+	if err := sqlite.RegisterDeterministicScalarFunction("callhome_distance", 4, distance); err != nil {
+		panic(err)
+	}
+	sqlx.BindDriver(driverName, sqlx.QUESTION)
+}
+
+// distance computes callhome.Distance of its four coordinate arguments, or
+// NULL when any of them is NULL.
+func distance(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	coords := make([]float64, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			return nil, nil
+		case float64:
+			coords[i] = v
+		case int64:
+			coords[i] = float64(v)
+		default:
+			return nil, fmt.Errorf("callhome_distance: invalid coordinate %v", arg)
+		}
+	}
+	return callhome.Distance(coords[0], coords[1], coords[2], coords[3]), nil
+}
+
+// Config defines the options that are used when opening a SQLite database.
+type Config struct {
+	// Path is the database file, or ":memory:" for a database that lives as
+	// long as the process.
+	Path string `env:"SQLITE_PATH" envDefault:"callhome.db"`
+}
+
+// Setup opens the SQLite database and applies any unapplied database
+// migrations. A non-nil error is returned to indicate failure.
+func Setup(prefix string, migrations migrate.MemoryMigrationSource) (*sqlx.DB, error) {
+	cfg := Config{}
+	if err := env.Parse(&cfg, env.Options{Prefix: prefix}); err != nil {
+		return nil, errors.Wrap(errConfig, err)
+	}
+	return SetupDB(cfg, migrations)
+}
+
+// SetupDB opens the SQLite database and applies any unapplied database
+// migrations. A non-nil error is returned to indicate failure.
+func SetupDB(cfg Config, migrations migrate.MemoryMigrationSource) (*sqlx.DB, error) {
+	db, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := MigrateDB(db, migrations); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Connect opens the SQLite database. SQLite allows a single writer, and every
+// connection to ":memory:" opens a new database, so a single connection is used.
+func Connect(cfg Config) (*sqlx.DB, error) {
+	db, err := sqlx.Open(driverName, cfg.Path)
+	if err != nil {
+		return nil, errors.Wrap(errConnect, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+// MigrateDB applies any unapplied database migrations.
+func MigrateDB(db *sqlx.DB, migrations migrate.MemoryMigrationSource) error {
+	_, err := migrate.Exec(db.DB, "sqlite3", migrations, migrate.Up)
+	if err != nil {
+		return errors.Wrap(errMigration, err)
+	}
+	return nil
+}
+
+func (c *Config) LoadEnv(prefix string) error {
+	if err := env.Parse(c, env.Options{Prefix: prefix}); err != nil {
+		return errors.Wrap(errConfig, err)
+	}
+	return nil
+}
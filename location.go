@@ -5,12 +5,29 @@ package callhome
 
 import (
 	"context"
+	"strings"
 
 	"github.com/ip2location/ip2location-go/v9"
 )
 
+// ip2location fills fields that are missing from the loaded database
+// with this message instead of leaving them empty.
+const unavailableField = "This parameter is unavailable"
+
 var _ LocationService = (*locationService)(nil)
 
+// Location represents the geographic location resolved from an IP address.
+type Location struct {
+	Country     string
+	CountryCode string
+	Region      string
+	City        string
+	PostalCode  string
+	Timezone    string
+	Latitude    float64
+	Longitude   float64
+}
+
 type locationService struct {
 	db *ip2location.DB
 }
@@ -18,7 +35,7 @@ type locationService struct {
 // LocationService provides a service for obtaining location information from an IP address.
 type LocationService interface {
 	// GetLocation returns the location information for a given IP address.
-	GetLocation(ctx context.Context, ip string) (ip2location.IP2Locationrecord, error)
+	GetLocation(ctx context.Context, ip string) (Location, error)
 }
 
 // NewLocationService creates a new LocationService that uses the specified IP2Location database file.
@@ -33,6 +50,26 @@ func NewLocationService(dbfilepath string) (LocationService, error) {
 }
 
 // GetLocation returns the location information for a given IP address.
-func (ls *locationService) GetLocation(ctx context.Context, ip string) (ip2location.IP2Locationrecord, error) {
-	return ls.db.Get_all(ip)
+func (ls *locationService) GetLocation(ctx context.Context, ip string) (Location, error) {
+	rec, err := ls.db.Get_all(ip)
+	if err != nil {
+		return Location{}, err
+	}
+	return Location{
+		Country:     field(rec.Country_long),
+		CountryCode: field(rec.Country_short),
+		Region:      field(rec.Region),
+		City:        field(rec.City),
+		PostalCode:  field(rec.Zipcode),
+		Timezone:    field(rec.Timezone),
+		Latitude:    float64(rec.Latitude),
+		Longitude:   float64(rec.Longitude),
+	}, nil
+}
+
+func field(val string) string {
+	if strings.HasPrefix(val, unavailableField) {
+		return ""
+	}
+	return val
 }
@@ -0,0 +1,566 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+// Package memory contains an in-memory telemetry repository. It is meant for
+// development and tests, data is lost when the process exits.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/absmach/callhome"
+)
+
+var _ callhome.TelemetryRepo = (*repo)(nil)
+
+type repo struct {
+	mu        sync.RWMutex
+	telemetry []callhome.Telemetry
+	erasures  []callhome.ErasureReceipt
+	blocklist map[string]string
+}
+
+// New returns a new in-memory telemetry repository.
+func New() callhome.TelemetryRepo {
+	return &repo{blocklist: make(map[string]string)}
+}
+
+// Save stores the telemetry event.
+func (r *repo) Save(ctx context.Context, t callhome.Telemetry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.Services = nil
+	r.telemetry = append(r.telemetry, t)
+	return nil
+}
+
+// RetrieveAll lists deployments the same way the TimescaleDB repository does:
+// the latest event of every deployment with an event matching the filters,
+// along with the services of its matching events.
+func (r *repo) RetrieveAll(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	if err := callhome.ValidateSort(pm.Sort, pm.Dir); err != nil {
+		return callhome.TelemetryPage{}, err
+	}
+	if pm.Sort == callhome.SortDistance && filters.Radius == nil {
+		return callhome.TelemetryPage{}, callhome.ErrInvalidSort
+	}
+
+	r.mu.RLock()
+	deps := r.deployments(filters)
+	r.mu.RUnlock()
+
+	for i := range deps {
+		deps[i].key = sortKey(deps[i], pm.Sort, filters)
+	}
+	order := func(a, b deployment) int {
+		if c := compareKeys(a.key, b.key); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.IpAddress, b.IpAddress)
+	}
+	if pm.Dir == callhome.DirDesc {
+		asc := order
+		order = func(a, b deployment) int { return asc(b, a) }
+	}
+	slices.SortFunc(deps, order)
+
+	page := deps
+	if pm.Cursor != "" {
+		cursor, err := callhome.DecodeCursor(pm.Cursor)
+		if err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+		if !cursor.Matches(pm.Sort, pm.Dir) {
+			return callhome.TelemetryPage{}, callhome.ErrInvalidCursor
+		}
+		key, err := parseKey(cursor.Key, pm.Sort)
+		if err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+		last := deployment{Telemetry: callhome.Telemetry{IpAddress: cursor.IpAddress}, key: key}
+		start, _ := slices.BinarySearchFunc(page, last, order)
+		if start < len(page) && order(page[start], last) == 0 {
+			start++
+		}
+		page = page[start:]
+	}
+	page = page[min(pm.Offset, uint64(len(page))):]
+
+	results := callhome.TelemetryPage{
+		PageMetadata: callhome.PageMetadata{
+			Offset:    pm.Offset,
+			Limit:     pm.Limit,
+			Cursor:    pm.Cursor,
+			SkipTotal: pm.SkipTotal,
+			Sort:      pm.Sort,
+			Dir:       pm.Dir,
+		},
+	}
+	if uint64(len(page)) > pm.Limit {
+		page = page[:pm.Limit]
+		if pm.Limit > 0 {
+			last := page[len(page)-1]
+			results.NextCursor = callhome.Cursor{Sort: pm.Sort, Dir: pm.Dir, Key: formatKey(last.key), IpAddress: last.IpAddress}.Encode()
+		}
+	}
+	for _, d := range page {
+		results.Telemetry = append(results.Telemetry, d.Telemetry)
+	}
+	if !pm.SkipTotal {
+		results.Total = uint64(len(deps))
+	}
+
+	return results, nil
+}
+
+// RetrieveSummary summarises the events matching the filters.
+func (r *repo) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns, status callhome.StatusConfig, now time.Time) (callhome.TelemetrySummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deployments := make(map[string]struct{})
+	countries := make(map[string]map[string]struct{})
+	cities := make(map[[2]string]map[string]struct{})
+	services := make(map[string]map[string]struct{})
+	versions := make(map[string]map[string]struct{})
+	providers := make(map[[2]string]map[string]struct{})
+	match := r.matcher(filters)
+	for _, t := range r.telemetry {
+		if !match(t) {
+			continue
+		}
+		deployments[t.IpAddress] = struct{}{}
+		addTo(countries, t.Country, t.IpAddress)
+		addTo(cities, [2]string{t.Country, t.City}, t.IpAddress)
+		addTo(services, t.Service, t.IpAddress)
+		addTo(versions, t.Version, t.IpAddress)
+		addTo(providers, [2]string{t.NetworkType, t.Provider}, t.IpAddress)
+	}
+
+	summary := callhome.TelemetrySummary{TotalDeployments: len(deployments)}
+	if breakdowns.Includes(callhome.BreakdownCountries) {
+		for _, k := range ranked(countries, cmp.Compare[string]) {
+			summary.Countries = append(summary.Countries, callhome.CountrySummary{Country: k, NoDeployments: len(countries[k])})
+		}
+	}
+	if breakdowns.Includes(callhome.BreakdownCities) {
+		for _, k := range ranked(cities, comparePairs) {
+			summary.Cities = append(summary.Cities, callhome.CitySummary{Country: k[0], City: k[1], NoDeployments: len(cities[k])})
+		}
+	}
+	if breakdowns.Includes(callhome.BreakdownServices) {
+		for _, k := range ranked(services, cmp.Compare[string]) {
+			summary.Services = append(summary.Services, callhome.ServiceSummary{Service: k, NoDeployments: len(services[k])})
+		}
+	}
+	if breakdowns.Includes(callhome.BreakdownVersions) {
+		for _, k := range ranked(versions, cmp.Compare[string]) {
+			summary.Versions = append(summary.Versions, callhome.VersionSummary{Version: k, NoDeployments: len(versions[k])})
+		}
+	}
+	if breakdowns.Includes(callhome.BreakdownProviders) {
+		for _, k := range ranked(providers, comparePairs) {
+			summary.Providers = append(summary.Providers, callhome.ProviderSummary{NetworkType: k[0], Provider: k[1], NoDeployments: len(providers[k])})
+		}
+	}
+	if breakdowns.Includes(callhome.BreakdownStatuses) {
+		summary.Statuses = r.statuses(filters, status, now)
+	}
+
+	return summary, nil
+}
+
+// RetrieveTimeseries counts the deployments with events matching the filters
+// in every bucket of the interval.
+func (r *repo) RetrieveTimeseries(ctx context.Context, filters callhome.TelemetryFilters, interval, split string) ([]callhome.TimeseriesPoint, error) {
+	if err := callhome.ValidateTimeseries(interval, split); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type point struct {
+		time  time.Time
+		value string
+	}
+	deployments := make(map[point]map[string]struct{})
+	match := r.matcher(filters)
+	for _, t := range r.telemetry {
+		if !match(t) {
+			continue
+		}
+		p := point{time: callhome.BucketStart(t.ServiceTime, interval), value: callhome.SplitValue(t, split)}
+		addTo(deployments, p, t.IpAddress)
+	}
+
+	var points []callhome.TimeseriesPoint
+	for p, ips := range deployments {
+		points = append(points, callhome.TimeseriesPoint{Time: p.time, Value: p.value, NoDeployments: len(ips)})
+	}
+	slices.SortFunc(points, func(a, b callhome.TimeseriesPoint) int {
+		if c := a.Time.Compare(b.Time); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+	return points, nil
+}
+
+// RetrieveTransitions reports the version upgrades of the services of
+// deployments, from consecutive events of a service with a newer version.
+func (r *repo) RetrieveTransitions(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TransitionReport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	released := make(map[string]time.Time)
+	for _, t := range r.telemetry {
+		if at, ok := released[t.Version]; !ok || t.ServiceTime.Before(at) {
+			released[t.Version] = t.ServiceTime
+		}
+	}
+
+	// Earlier versions are looked up before the window.
+	events := filters
+	events.From = time.Time{}
+	services := make(map[[2]string][]callhome.Telemetry)
+	match := r.matcher(events)
+	for _, t := range r.telemetry {
+		if match(t) {
+			k := [2]string{t.IpAddress, t.Service}
+			services[k] = append(services[k], t)
+		}
+	}
+
+	var upgrades []callhome.Upgrade
+	for _, ts := range services {
+		slices.SortStableFunc(ts, func(a, b callhome.Telemetry) int { return a.ServiceTime.Compare(b.ServiceTime) })
+		for i := 1; i < len(ts); i++ {
+			prev, t := ts[i-1], ts[i]
+			if !callhome.IsUpgrade(prev.Version, t.Version) || (!filters.From.IsZero() && t.ServiceTime.Before(filters.From)) {
+				continue
+			}
+			upgrades = append(upgrades, callhome.Upgrade{
+				IpAddress: t.IpAddress,
+				From:      prev.Version,
+				To:        t.Version,
+				Adoption:  t.ServiceTime.Sub(released[t.Version]),
+			})
+		}
+	}
+	return callhome.SummarizeUpgrades(upgrades), nil
+}
+
+// RetrieveCohorts groups deployments by the period they were first seen in.
+func (r *repo) RetrieveCohorts(ctx context.Context, filters callhome.TelemetryFilters, period string) ([]callhome.Cohort, error) {
+	if err := callhome.ValidateCohortPeriod(period); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Deployments first seen before the window are left out rather than
+	// assigned to a later cohort.
+	events := filters
+	events.From = time.Time{}
+	firstSeen := make(map[string]time.Time)
+	periods := make(map[string]map[time.Time]struct{})
+	match := r.matcher(events)
+	for _, t := range r.telemetry {
+		if !match(t) {
+			continue
+		}
+		if seen, ok := firstSeen[t.IpAddress]; !ok || t.ServiceTime.Before(seen) {
+			firstSeen[t.IpAddress] = t.ServiceTime
+		}
+		if periods[t.IpAddress] == nil {
+			periods[t.IpAddress] = make(map[time.Time]struct{})
+		}
+		periods[t.IpAddress][callhome.BucketStart(t.ServiceTime, period)] = struct{}{}
+	}
+
+	counts := make(map[[2]time.Time]int)
+	for ip, seen := range firstSeen {
+		if !filters.From.IsZero() && seen.Before(filters.From) {
+			continue
+		}
+		cohort := callhome.BucketStart(seen, period)
+		for p := range periods[ip] {
+			counts[[2]time.Time{cohort, p}]++
+		}
+	}
+	activity := make([]callhome.CohortActivity, 0, len(counts))
+	for k, n := range counts {
+		activity = append(activity, callhome.CohortActivity{Cohort: k[0], Period: k[1], NoDeployments: n})
+	}
+	return callhome.BuildCohorts(activity, period, filters.To), nil
+}
+
+// statuses counts the deployments by the latest of all their events. The
+// caller holds the lock.
+func (r *repo) statuses(filters callhome.TelemetryFilters, cfg callhome.StatusConfig, now time.Time) []callhome.StatusSummary {
+	lastSeen := r.lastSeen()
+	statuses := make(map[string]map[string]struct{})
+	match := r.matcher(filters)
+	for _, t := range r.telemetry {
+		if match(t) {
+			addTo(statuses, cfg.Classify(lastSeen[t.IpAddress], now), t.IpAddress)
+		}
+	}
+	var summaries []callhome.StatusSummary
+	for _, k := range ranked(statuses, cmp.Compare[string]) {
+		summaries = append(summaries, callhome.StatusSummary{Status: k, NoDeployments: len(statuses[k])})
+	}
+	return summaries
+}
+
+// RetrieveServiceSets lists the services of every deployment.
+func (r *repo) RetrieveServiceSets(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.DeploymentServices, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	services := make(map[string]map[string]struct{})
+	match := r.matcher(filters)
+	for _, t := range r.telemetry {
+		if match(t) {
+			addTo(services, t.IpAddress, t.Service)
+		}
+	}
+	var sets []callhome.DeploymentServices
+	for _, ip := range sortedKeys(services) {
+		sets = append(sets, callhome.DeploymentServices{IpAddress: ip, Services: sortedKeys(services[ip])})
+	}
+	return sets, nil
+}
+
+// Erase removes the events stored under any of the identifiers.
+func (r *repo) Erase(ctx context.Context, receipt callhome.ErasureReceipt, identifiers, blocklist []string) (callhome.ErasureReceipt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.telemetry[:0]
+	for _, t := range r.telemetry {
+		if slices.Contains(identifiers, t.IpAddress) {
+			receipt.RecordsRemoved++
+			continue
+		}
+		kept = append(kept, t)
+	}
+	clear(r.telemetry[len(kept):])
+	r.telemetry = kept
+
+	r.erasures = append(r.erasures, receipt)
+	for _, id := range blocklist {
+		if _, ok := r.blocklist[id]; !ok {
+			r.blocklist[id] = receipt.ID
+		}
+	}
+
+	return receipt, nil
+}
+
+// Blocked reports whether any of the identifiers is blocklisted.
+func (r *repo) Blocked(ctx context.Context, identifiers ...string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, id := range identifiers {
+		if _, ok := r.blocklist[id]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matcher returns the function reporting whether an event passes the filters,
+// including the range of the latest events of deployments. The caller must
+// hold the lock.
+func (r *repo) matcher(filters callhome.TelemetryFilters) func(callhome.Telemetry) bool {
+	if filters.LastSeen == nil {
+		return filters.Matches
+	}
+	lastSeen := r.lastSeen()
+	return func(t callhome.Telemetry) bool {
+		return filters.Matches(t) && filters.LastSeen.Contains(lastSeen[t.IpAddress])
+	}
+}
+
+// lastSeen returns the time of the latest event of every deployment. The
+// caller must hold the lock.
+func (r *repo) lastSeen() map[string]time.Time {
+	lastSeen := make(map[string]time.Time)
+	for _, t := range r.telemetry {
+		if t.ServiceTime.After(lastSeen[t.IpAddress]) {
+			lastSeen[t.IpAddress] = t.ServiceTime
+		}
+	}
+	return lastSeen
+}
+
+// deployment is a deployment of the listing along with its sort key.
+type deployment struct {
+	callhome.Telemetry
+	firstSeen time.Time
+	key       any
+}
+
+// deployments returns the deployments with events matching the filters.
+// The caller must hold the lock.
+func (r *repo) deployments(filters callhome.TelemetryFilters) []deployment {
+	matching := make(map[string]*deployment)
+	services := make(map[string]map[string]struct{})
+	match := r.matcher(filters)
+	for _, t := range r.telemetry {
+		if !match(t) {
+			continue
+		}
+		d, ok := matching[t.IpAddress]
+		if !ok {
+			d = &deployment{firstSeen: t.ServiceTime}
+			matching[t.IpAddress] = d
+		}
+		if t.ServiceTime.Before(d.firstSeen) {
+			d.firstSeen = t.ServiceTime
+		}
+		addTo(services, t.IpAddress, t.Service)
+	}
+
+	// Deployments are represented by their latest event, matching or not.
+	for _, t := range r.telemetry {
+		d, ok := matching[t.IpAddress]
+		if !ok {
+			continue
+		}
+		if d.IpAddress == "" || t.ServiceTime.After(d.ServiceTime) {
+			d.Telemetry = t
+		}
+	}
+
+	deps := make([]deployment, 0, len(matching))
+	for ip, d := range matching {
+		d.Services = sortedKeys(services[ip])
+		deps = append(deps, *d)
+	}
+	return deps
+}
+
+// sortKey returns the value the deployment is sorted by before its IP address.
+func sortKey(d deployment, sort string, filters callhome.TelemetryFilters) any {
+	switch sort {
+	case callhome.SortLastSeen:
+		return d.ServiceTime
+	case callhome.SortFirstSeen:
+		return d.firstSeen
+	case callhome.SortCountry:
+		return d.Country
+	case callhome.SortCity:
+		return d.City
+	case callhome.SortVersion:
+		return d.Version
+	case callhome.SortServices:
+		return len(d.Services)
+	case callhome.SortDistance:
+		return callhome.Distance(filters.Radius.Lat, filters.Radius.Lon, d.Latitude, d.Longitude)
+	default:
+		return nil
+	}
+}
+
+func compareKeys(a, b any) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case string:
+		return cmp.Compare(a, b.(string))
+	case int:
+		return cmp.Compare(a, b.(int))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	default:
+		return 0
+	}
+}
+
+func formatKey(key any) string {
+	switch key := key.(type) {
+	case time.Time:
+		return key.Format(time.RFC3339Nano)
+	case string:
+		return key
+	case int:
+		return strconv.Itoa(key)
+	case float64:
+		return strconv.FormatFloat(key, 'g', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func parseKey(key, sort string) (any, error) {
+	var (
+		val any
+		err error
+	)
+	switch sort {
+	case callhome.SortLastSeen, callhome.SortFirstSeen:
+		val, err = time.Parse(time.RFC3339Nano, key)
+	case callhome.SortCountry, callhome.SortCity, callhome.SortVersion:
+		val = key
+	case callhome.SortServices:
+		val, err = strconv.Atoi(key)
+	case callhome.SortDistance:
+		val, err = strconv.ParseFloat(key, 64)
+	}
+	if err != nil {
+		return nil, callhome.ErrInvalidCursor
+	}
+	return val, nil
+}
+
+func addTo[K comparable](sets map[K]map[string]struct{}, key K, val string) {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[string]struct{})
+		sets[key] = set
+	}
+	set[val] = struct{}{}
+}
+
+// ranked returns the keys of the sets, largest set first. Keys of sets of the
+// same size are ordered by compare.
+func ranked[K comparable](sets map[K]map[string]struct{}, compare func(a, b K) int) []K {
+	keys := make([]K, 0, len(sets))
+	for k := range sets {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b K) int {
+		if c := cmp.Compare(len(sets[b]), len(sets[a])); c != 0 {
+			return c
+		}
+		return compare(a, b)
+	})
+	return keys
+}
+
+func comparePairs(a, b [2]string) int {
+	if c := cmp.Compare(a[0], b[0]); c != 0 {
+		return c
+	}
+	return cmp.Compare(a[1], b[1])
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
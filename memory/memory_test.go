@@ -0,0 +1,18 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/memory"
+	"github.com/absmach/callhome/repotest"
+)
+
+func TestRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) callhome.TelemetryRepo {
+		return memory.New()
+	})
+}
@@ -0,0 +1,35 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"context"
+
+	"github.com/absmach/callhome"
+	mock "github.com/stretchr/testify/mock"
+)
+
+var _ callhome.ASNService = (*ASNService)(nil)
+
+type ASNService struct {
+	mock.Mock
+}
+
+func (_m *ASNService) GetASN(ctx context.Context, ip string) (callhome.ASN, error) {
+	ret := _m.Called(ip)
+
+	return ret.Get(0).(callhome.ASN), ret.Error(1)
+}
+
+type mockConstructorTestingTNewASNService interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+func NewASNService(t mockConstructorTestingTNewASNService) *ASNService {
+	mock := &ASNService{}
+	mock.Mock.Test(t)
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+	return mock
+}
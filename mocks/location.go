@@ -7,7 +7,6 @@ import (
 	"context"
 
 	"github.com/absmach/callhome"
-	ip2location "github.com/ip2location/ip2location-go/v9"
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -17,10 +16,10 @@ type LocationService struct {
 	mock.Mock
 }
 
-func (_m *LocationService) GetLocation(ctx context.Context, ip string) (ip2location.IP2Locationrecord, error) {
+func (_m *LocationService) GetLocation(ctx context.Context, ip string) (callhome.Location, error) {
 	ret := _m.Called(ip)
 
-	return ret.Get(0).(ip2location.IP2Locationrecord), ret.Error(1)
+	return ret.Get(0).(callhome.Location), ret.Error(1)
 }
 
 type mockConstructorTestingTNewLocationService interface {
@@ -21,7 +21,7 @@ func (*Service) ServeUI(ctx context.Context, filters callhome.TelemetryFilters)
 	return nil, nil
 }
 
-func (s *Service) Retrieve(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+func (s *Service) Retrieve(ctx context.Context, token string, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
 	ret := s.Called(ctx, pm)
 	var r0 callhome.TelemetryPage
 	var r1 error
@@ -55,10 +55,39 @@ func (s *Service) Save(ctx context.Context, t callhome.Telemetry) error {
 	return r0
 }
 
-func (*Service) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+func (*Service) RetrieveSummary(ctx context.Context, token string, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns) (callhome.TelemetrySummary, error) {
 	return callhome.TelemetrySummary{}, nil
 }
 
+func (*Service) RetrieveTimeseries(ctx context.Context, filters callhome.TelemetryFilters, interval, split string) ([]callhome.TimeseriesPoint, error) {
+	return nil, nil
+}
+
+func (*Service) RetrieveAdoption(ctx context.Context, filters callhome.TelemetryFilters, interval string) ([]callhome.VersionShare, error) {
+	return nil, nil
+}
+
+func (*Service) RetrieveTransitions(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TransitionReport, error) {
+	return callhome.TransitionReport{}, nil
+}
+
+func (*Service) RetrieveChurn(ctx context.Context, token string, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	return callhome.TelemetryPage{}, nil
+}
+
+func (*Service) RetrieveCohorts(ctx context.Context, filters callhome.TelemetryFilters, period string) ([]callhome.Cohort, error) {
+	return nil, nil
+}
+
+func (*Service) RetrieveCooccurrence(ctx context.Context, token string, filters callhome.TelemetryFilters, service string, limit uint64) (callhome.CooccurrenceReport, error) {
+	return callhome.CooccurrenceReport{}, nil
+}
+
+func (s *Service) Erase(ctx context.Context, token string, req callhome.ErasureRequest) (callhome.ErasureReceipt, error) {
+	ret := s.Called(ctx, token, req)
+	return ret.Get(0).(callhome.ErasureReceipt), ret.Error(1)
+}
+
 type mockConstructorTestingTNewService interface {
 	mock.TestingT
 	Cleanup(func())
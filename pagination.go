@@ -0,0 +1,142 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Sort orders of the telemetry listing. Deployments are ordered by their
+// stored IP address when no sort order is given.
+const (
+	SortLastSeen  = "last_seen"
+	SortFirstSeen = "first_seen"
+	SortCountry   = "country"
+	SortCity      = "city"
+	SortVersion   = "version"
+	SortServices  = "services"
+	// SortDistance orders by the distance from the centre of the Radius
+	// filter, which it requires.
+	SortDistance = "distance"
+)
+
+// Sort directions.
+const (
+	DirAsc  = "asc"
+	DirDesc = "desc"
+)
+
+var (
+	// ErrInvalidCursor indicates a malformed pagination cursor or a cursor
+	// issued for a different sort order.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSort indicates an unsupported sort order.
+	ErrInvalidSort = errors.New("invalid sort order")
+	// ErrInvalidDirection indicates an unsupported sort direction.
+	ErrInvalidDirection = errors.New("invalid sort direction")
+)
+
+// Cursor marks the last deployment of a page. Deployments are listed in a
+// stable order, so the next page starts right after it. Key holds the value
+// of the sort column of that deployment, and Sort and Dir the order the
+// cursor was issued for.
+type Cursor struct {
+	Sort      string `json:"s,omitempty"`
+	Dir       string `json:"d,omitempty"`
+	Key       string `json:"k,omitempty"`
+	IpAddress string `json:"id"`
+}
+
+// ValidateSort checks the sort order and direction against the allowed values.
+func ValidateSort(sort, dir string) error {
+	switch sort {
+	case "", SortLastSeen, SortFirstSeen, SortCountry, SortCity, SortVersion, SortServices, SortDistance:
+	default:
+		return ErrInvalidSort
+	}
+	switch dir {
+	case "", DirAsc, DirDesc:
+	default:
+		return ErrInvalidDirection
+	}
+	return nil
+}
+
+// Matches reports whether the cursor was issued for the given sort order.
+func (c Cursor) Matches(sort, dir string) bool {
+	if c.Dir == "" {
+		c.Dir = DirAsc
+	}
+	if dir == "" {
+		dir = DirAsc
+	}
+	return c.Sort == sort && c.Dir == dir
+}
+
+// Encode returns the representation of the cursor repositories exchange.
+// Cursors handed to clients are sealed by the service.
+func (c Cursor) Encode() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses an opaque cursor returned by Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.IpAddress == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// cursorSealer encrypts and authenticates the cursors handed to clients, so
+// that they can neither read the IP address and sort key a cursor holds nor
+// forge one.
+type cursorSealer struct {
+	aead cipher.AEAD
+}
+
+func newCursorSealer(key string) cursorSealer {
+	secret := sha256.Sum256([]byte(key))
+	// Neither can fail with a 32 bytes key and the 16 bytes blocks of AES.
+	block, _ := aes.NewCipher(secret[:])
+	aead, _ := cipher.NewGCM(block)
+	return cursorSealer{aead: aead}
+}
+
+// seal returns the sealed representation of the encoded cursor.
+func (cs cursorSealer) seal(cursor string) string {
+	nonce := make([]byte, cs.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(cs.aead.Seal(nonce, nonce, []byte(cursor), nil))
+}
+
+// open returns the encoded cursor of a sealed one.
+func (cs cursorSealer) open(sealed string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(b) < cs.aead.NonceSize() {
+		return "", ErrInvalidCursor
+	}
+	nonce, ciphertext := b[:cs.aead.NonceSize()], b[cs.aead.NonceSize():]
+	cursor, err := cs.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return string(cursor), nil
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		c := callhome.Cursor{IpAddress: "41.90.185.50"}
+		got, err := callhome.DecodeCursor(c.Encode())
+		assert.Nil(t, err)
+		assert.Equal(t, c, got)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+			_, err := callhome.DecodeCursor(s)
+			assert.Equal(t, callhome.ErrInvalidCursor, err, s)
+		}
+	})
+}
+
+func TestCursorMatches(t *testing.T) {
+	c := callhome.Cursor{Sort: callhome.SortCity, IpAddress: "41.90.185.50"}
+	assert.True(t, c.Matches(callhome.SortCity, ""))
+	assert.True(t, c.Matches(callhome.SortCity, callhome.DirAsc))
+	assert.False(t, c.Matches(callhome.SortCity, callhome.DirDesc))
+	assert.False(t, c.Matches(callhome.SortCountry, ""))
+}
+
+func TestValidateSort(t *testing.T) {
+	cases := []struct {
+		desc string
+		sort string
+		dir  string
+		err  error
+	}{
+		{"default", "", "", nil},
+		{"last seen descending", callhome.SortLastSeen, callhome.DirDesc, nil},
+		{"service count ascending", callhome.SortServices, callhome.DirAsc, nil},
+		{"unknown sort", "ip_address", "", callhome.ErrInvalidSort},
+		{"unknown direction", callhome.SortCity, "up", callhome.ErrInvalidDirection},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.err, callhome.ValidateSort(tc.sort, tc.dir))
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// Privacy modes applied to client IP addresses before they are stored.
+const (
+	// PrivacyKeep stores the IP address unchanged.
+	PrivacyKeep = "keep"
+	// PrivacyTruncate stores the /24 network for IPv4 and the /48 network for IPv6.
+	PrivacyTruncate = "truncate"
+	// PrivacyHash stores a keyed hash of the IP address. The salt is derived
+	// from the key and rotates every SaltRotation.
+	PrivacyHash = "hash"
+)
+
+const (
+	ipv4TruncateBits = 24
+	ipv6TruncateBits = 48
+	hashPrefix       = "h:"
+	hashLen          = 16
+)
+
+var (
+	// ErrInvalidPrivacyMode indicates an unknown privacy mode.
+	ErrInvalidPrivacyMode = errors.New("invalid privacy mode")
+	// ErrMissingPrivacyKey indicates hash mode was selected without a key.
+	ErrMissingPrivacyKey = errors.New("privacy key is required for hash mode")
+)
+
+var _ Anonymizer = (*anonymizer)(nil)
+
+// PrivacyConfig defines how client IP addresses are anonymized.
+type PrivacyConfig struct {
+	Mode         string
+	Key          string
+	SaltRotation time.Duration
+}
+
+// Anonymizer transforms client IP addresses into their stored representation.
+type Anonymizer interface {
+	// Anonymize returns the representation of the IP address to be stored
+	// for a record received at the given time.
+	Anonymize(ip string, at time.Time) (string, error)
+
+	// Identifiers returns every representation the IP address may have been
+	// stored under between from and to.
+	Identifiers(ip string, from, to time.Time) ([]string, error)
+
+	// Fingerprint returns the representation of the IP address kept in the
+	// blocklist, so that blocked addresses are recognised regardless of the
+	// privacy mode and salt rotation. It is keyed with the privacy key, so
+	// that the blocklist can't be matched against enumerated addresses.
+	Fingerprint(ip string) (string, error)
+}
+
+type anonymizer struct {
+	cfg PrivacyConfig
+}
+
+// NewAnonymizer creates a new Anonymizer for the given privacy configuration.
+func NewAnonymizer(cfg PrivacyConfig) (Anonymizer, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = PrivacyKeep
+	case PrivacyKeep, PrivacyTruncate:
+	case PrivacyHash:
+		if cfg.Key == "" {
+			return nil, ErrMissingPrivacyKey
+		}
+	default:
+		return nil, ErrInvalidPrivacyMode
+	}
+	return &anonymizer{cfg: cfg}, nil
+}
+
+// Anonymize returns the representation of the IP address to be stored.
+func (a *anonymizer) Anonymize(ip string, at time.Time) (string, error) {
+	switch a.cfg.Mode {
+	case PrivacyTruncate:
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return "", err
+		}
+		addr = addr.Unmap()
+		bits := ipv6TruncateBits
+		if addr.Is4() {
+			bits = ipv4TruncateBits
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			return "", err
+		}
+		return prefix.Addr().String(), nil
+	case PrivacyHash:
+		mac := hmac.New(sha256.New, a.salt(at))
+		mac.Write([]byte(ip))
+		return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:hashLen]), nil
+	default:
+		return ip, nil
+	}
+}
+
+// Identifiers returns every representation the IP address may have been stored under.
+func (a *anonymizer) Identifiers(ip string, from, to time.Time) ([]string, error) {
+	if a.cfg.Mode != PrivacyHash || a.cfg.SaltRotation <= 0 {
+		id, err := a.Anonymize(ip, to)
+		if err != nil {
+			return nil, err
+		}
+		return []string{id}, nil
+	}
+
+	// Align to the start of the period, the same way salt does.
+	start := from.UnixNano() - from.UnixNano()%int64(a.cfg.SaltRotation)
+	var ids []string
+	for at := time.Unix(0, start); !at.After(to); at = at.Add(a.cfg.SaltRotation) {
+		id, err := a.Anonymize(ip, at)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Fingerprint returns the keyed representation of the IP address kept in the blocklist.
+func (a *anonymizer) Fingerprint(ip string) (string, error) {
+	if a.cfg.Key == "" {
+		return "", ErrMissingBlocklistKey
+	}
+	mac := hmac.New(sha256.New, []byte(a.cfg.Key))
+	mac.Write([]byte(fingerprintPrefix + ip))
+	return fingerprintPrefix + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// salt derives the salt of the rotation period the given time falls in.
+func (a *anonymizer) salt(at time.Time) []byte {
+	var period uint64
+	if a.cfg.SaltRotation > 0 {
+		period = uint64(at.UnixNano() / int64(a.cfg.SaltRotation))
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, period)
+	mac := hmac.New(sha256.New, []byte(a.cfg.Key))
+	mac.Write(buf)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymize(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	t.Run("invalid mode", func(t *testing.T) {
+		_, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: "invalid"})
+		assert.Equal(t, callhome.ErrInvalidPrivacyMode, err)
+	})
+	t.Run("hash without key", func(t *testing.T) {
+		_, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyHash})
+		assert.Equal(t, callhome.ErrMissingPrivacyKey, err)
+	})
+	t.Run("keep", func(t *testing.T) {
+		anon, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyKeep})
+		assert.Nil(t, err)
+		ip, err := anon.Anonymize("41.90.185.50", now)
+		assert.Nil(t, err)
+		assert.Equal(t, "41.90.185.50", ip)
+	})
+	t.Run("truncate", func(t *testing.T) {
+		anon, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyTruncate})
+		assert.Nil(t, err)
+		cases := map[string]string{
+			"41.90.185.50":                 "41.90.185.0",
+			"::ffff:41.90.185.50":          "41.90.185.0",
+			"2001:db8:85a3:8d3:1319::7344": "2001:db8:85a3::",
+		}
+		for in, out := range cases {
+			ip, err := anon.Anonymize(in, now)
+			assert.Nil(t, err)
+			assert.Equal(t, out, ip)
+		}
+		_, err = anon.Anonymize("invalid", now)
+		assert.NotNil(t, err)
+	})
+	t.Run("hash", func(t *testing.T) {
+		anon, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyHash, Key: "secret", SaltRotation: 24 * time.Hour})
+		assert.Nil(t, err)
+		h1, err := anon.Anonymize("41.90.185.50", now)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(h1, "h:"))
+		assert.NotContains(t, h1, "41.90")
+
+		h2, _ := anon.Anonymize("41.90.185.50", now.Add(time.Hour))
+		assert.Equal(t, h1, h2, "same period must produce the same hash")
+
+		h3, _ := anon.Anonymize("41.90.185.50", now.Add(24*time.Hour))
+		assert.NotEqual(t, h1, h3, "salt must rotate between periods")
+
+		h4, _ := anon.Anonymize("41.90.185.51", now)
+		assert.NotEqual(t, h1, h4)
+	})
+
+	t.Run("fingerprint", func(t *testing.T) {
+		anon, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyKeep, Key: "secret"})
+		assert.Nil(t, err)
+		f1, err := anon.Fingerprint("41.90.185.50")
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(f1, "hmac:"))
+
+		other, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyHash, Key: "secret", SaltRotation: 24 * time.Hour})
+		assert.Nil(t, err)
+		f2, _ := other.Fingerprint("41.90.185.50")
+		assert.Equal(t, f1, f2, "fingerprint must not depend on the privacy mode")
+
+		rekeyed, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyKeep, Key: "other"})
+		assert.Nil(t, err)
+		f3, _ := rekeyed.Fingerprint("41.90.185.50")
+		assert.NotEqual(t, f1, f3, "fingerprint must be keyed")
+
+		unkeyed, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyKeep})
+		assert.Nil(t, err)
+		_, err = unkeyed.Fingerprint("41.90.185.50")
+		assert.Equal(t, callhome.ErrMissingBlocklistKey, err)
+	})
+}
@@ -0,0 +1,928 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+// Package repotest implements a conformance test suite for
+// callhome.TelemetryRepo implementations. It fixes the semantics of listing
+// and summarising telemetry that every backend must share.
+package repotest
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty repository. It's called once for every test of
+// the suite, and is responsible for cleaning up after it.
+type Factory func(t *testing.T) callhome.TelemetryRepo
+
+// Deployments of the fixtures, in the order of their IP addresses.
+const (
+	nairobi  = "10.0.0.1"
+	belgrade = "10.0.0.2"
+	paris    = "10.0.0.3"
+	suva     = "10.0.0.4"
+)
+
+// Run checks the repository returned by the factory against the suite.
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("Save", func(t *testing.T) { testSave(t, newRepo(t)) })
+	t.Run("RetrieveAll", func(t *testing.T) { testRetrieveAll(t, newRepo(t)) })
+	t.Run("Filters", func(t *testing.T) { testFilters(t, newRepo(t)) })
+	t.Run("Paging", func(t *testing.T) { testPaging(t, newRepo(t)) })
+	t.Run("Ordering", func(t *testing.T) { testOrdering(t, newRepo(t)) })
+	t.Run("Summary", func(t *testing.T) { testSummary(t, newRepo(t)) })
+	t.Run("Timeseries", func(t *testing.T) { testTimeseries(t, newRepo(t)) })
+	t.Run("Transitions", func(t *testing.T) { testTransitions(t, newRepo(t)) })
+	t.Run("Cohorts", func(t *testing.T) { testCohorts(t, newRepo(t)) })
+	t.Run("ServiceSets", func(t *testing.T) { testServiceSets(t, newRepo(t)) })
+	t.Run("Statuses", func(t *testing.T) { testStatuses(t, newRepo(t)) })
+	t.Run("Erase", func(t *testing.T) { testErase(t, newRepo(t)) })
+}
+
+// start is the time of the first event of the fixtures. It's recent, so
+// that the fixtures are within any retention period.
+var start = time.Now().UTC().Truncate(time.Hour).Add(-24 * time.Hour)
+
+// Statuses are classified at statusTime, when deployments were last seen 23h
+// (nairobi), 22h (belgrade), 20h (paris) and 19h (suva) before.
+var (
+	statusTime = start.Add(24 * time.Hour)
+	statusCfg  = callhome.StatusConfig{StaleAfter: 19*time.Hour + 30*time.Minute, DormantAfter: 21 * time.Hour, ChurnedAfter: 22*time.Hour + 30*time.Minute}
+)
+
+type fixture struct {
+	ip, service, version, country, city, networkType, provider string
+	lat, lon                                                   float64
+	at                                                         time.Duration
+}
+
+var fixtures = []fixture{
+	{nairobi, "users", "0.14.0", "Kenya", "Nairobi", callhome.NetworkISP, "Safaricom", -1.29, 36.82, 0},
+	{nairobi, "things", "0.14.0", "Kenya", "Nairobi", callhome.NetworkISP, "Safaricom", -1.29, 36.82, time.Hour},
+	{belgrade, "users", "0.13.1", "Serbia", "Belgrade", callhome.NetworkCloud, "Hetzner", 44.79, 20.45, 2 * time.Hour},
+	{paris, "users", "0.14.1", "Serbia", "Novi Sad", callhome.NetworkISP, "SBB", 45.25, 19.84, 3 * time.Hour},
+	{paris, "bootstrap", "0.15.0", "France", "Paris", callhome.NetworkISP, "Orange", 48.85, 2.35, 4 * time.Hour},
+	{suva, "users", "0.14.1", "Fiji", "Suva", callhome.NetworkUnknown, "Vodafone", -18.14, 178.44, -time.Hour},
+	{suva, "users", "0.15.0", "Fiji", "Suva", callhome.NetworkUnknown, "Vodafone", -18.14, 178.44, 5 * time.Hour},
+}
+
+func (f fixture) telemetry() callhome.Telemetry {
+	return callhome.Telemetry{
+		IpAddress:   f.ip,
+		Service:     f.service,
+		Version:     f.version,
+		Country:     f.country,
+		CountryCode: f.country[:2],
+		City:        f.city,
+		Latitude:    f.lat,
+		Longitude:   f.lon,
+		NetworkType: f.networkType,
+		Provider:    f.provider,
+		ServiceTime: start.Add(f.at),
+		LastSeen:    start.Add(f.at),
+	}
+}
+
+func seed(t *testing.T, repo callhome.TelemetryRepo) {
+	for _, f := range fixtures {
+		require.Nil(t, repo.Save(context.Background(), f.telemetry()), "saving fixtures")
+	}
+}
+
+func ips(page callhome.TelemetryPage) []string {
+	var ips []string
+	for _, t := range page.Telemetry {
+		ips = append(ips, t.IpAddress)
+	}
+	return ips
+}
+
+func testSave(t *testing.T, repo callhome.TelemetryRepo) {
+	event := callhome.Telemetry{
+		IpAddress:   "192.168.0.1",
+		Service:     "users",
+		Version:     "0.14.0",
+		Country:     "Serbia",
+		CountryCode: "RS",
+		Region:      "Vojvodina",
+		City:        "Novi Sad",
+		PostalCode:  "21000",
+		Timezone:    "+01:00",
+		Latitude:    45.25,
+		Longitude:   19.84,
+		ASN:         8400,
+		ASOrg:       "Telekom Srbija",
+		Provider:    "Telekom Srbija",
+		NetworkType: callhome.NetworkISP,
+		ServiceTime: start,
+		LastSeen:    start.Add(time.Minute),
+	}
+	require.Nil(t, repo.Save(context.Background(), event))
+
+	page, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	require.Len(t, page.Telemetry, 1)
+	got := page.Telemetry[0]
+	assert.Equal(t, []string{"users"}, []string(got.Services))
+	assert.True(t, event.ServiceTime.Equal(got.ServiceTime), "expected time %s got %s", event.ServiceTime, got.ServiceTime)
+	assert.True(t, event.LastSeen.Equal(got.LastSeen), "expected last seen %s got %s", event.LastSeen, got.LastSeen)
+	got.Services, got.ServiceTime, got.LastSeen = nil, event.ServiceTime, event.LastSeen
+	event.Service = ""
+	got.Service = ""
+	assert.Equal(t, event, got)
+}
+
+func testRetrieveAll(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+
+	page, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	assert.Equal(t, uint64(4), page.Total)
+	assert.Equal(t, uint64(10), page.Limit)
+	assert.Empty(t, page.NextCursor)
+	require.Equal(t, []string{nairobi, belgrade, paris, suva}, ips(page))
+
+	services := [][]string{{"things", "users"}, {"users"}, {"bootstrap", "users"}, {"users"}}
+	for i, t2 := range page.Telemetry {
+		assert.Equal(t, services[i], []string(t2.Services), "services of %s", t2.IpAddress)
+	}
+	// Deployments are represented by their latest event.
+	assert.Equal(t, "France", page.Telemetry[2].Country)
+	assert.Equal(t, "0.15.0", page.Telemetry[3].Version)
+	assert.True(t, start.Add(4*time.Hour).Equal(page.Telemetry[2].ServiceTime))
+
+	page, err = repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10, SkipTotal: true}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	assert.Zero(t, page.Total)
+	assert.Len(t, page.Telemetry, 4)
+}
+
+func testFilters(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+
+	cases := []struct {
+		desc     string
+		filters  callhome.TelemetryFilters
+		ips      []string
+		services [][]string
+	}{
+		{
+			desc:     "country",
+			filters:  callhome.TelemetryFilters{Country: callhome.Match("Serbia")},
+			ips:      []string{belgrade, paris},
+			services: [][]string{{"users"}, {"users"}},
+		},
+		{
+			desc:    "multiple countries",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Kenya", "Fiji")},
+			ips:     []string{nairobi, suva},
+		},
+		{
+			desc:    "excluded country",
+			filters: callhome.TelemetryFilters{Country: callhome.Filter{Excluded: []string{"Serbia", "Fiji"}}},
+			ips:     []string{nairobi, paris},
+		},
+		{
+			desc:    "city",
+			filters: callhome.TelemetryFilters{City: callhome.Match("Novi Sad")},
+			ips:     []string{paris},
+		},
+		{
+			desc:    "version prefix",
+			filters: callhome.TelemetryFilters{Version: callhome.Match("0.14.*")},
+			ips:     []string{nairobi, paris, suva},
+		},
+		{
+			desc:    "version and prefix",
+			filters: callhome.TelemetryFilters{Version: callhome.Match("0.13.1", "0.15.*")},
+			ips:     []string{belgrade, paris, suva},
+		},
+		{
+			desc:    "excluded version prefix",
+			filters: callhome.TelemetryFilters{Version: callhome.Filter{Excluded: []string{"0.14.*"}}},
+			ips:     []string{belgrade, paris, suva},
+		},
+		{
+			desc:    "wildcard matches exactly on other fields",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Ser*")},
+		},
+		{
+			desc:     "service",
+			filters:  callhome.TelemetryFilters{Service: callhome.Match("users")},
+			ips:      []string{nairobi, belgrade, paris, suva},
+			services: [][]string{{"users"}, {"users"}, {"users"}, {"users"}},
+		},
+		{
+			desc:    "provider",
+			filters: callhome.TelemetryFilters{Provider: callhome.Match("Orange", "Hetzner")},
+			ips:     []string{belgrade, paris},
+		},
+		{
+			desc:    "network type",
+			filters: callhome.TelemetryFilters{NetworkType: callhome.Filter{Excluded: []string{callhome.NetworkISP}}},
+			ips:     []string{belgrade, suva},
+		},
+		{
+			desc:    "time range",
+			filters: callhome.TelemetryFilters{From: start.Add(90 * time.Minute), To: start.Add(3 * time.Hour)},
+			ips:     []string{belgrade, paris},
+		},
+		{
+			desc:    "combined",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Serbia"), Service: callhome.Match("users"), Version: callhome.Match("0.14.*")},
+			ips:     []string{paris},
+		},
+		{
+			desc:    "bounding box",
+			filters: callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: 40, MinLon: 0, MaxLat: 50, MaxLon: 10}},
+			ips:     []string{paris},
+		},
+		{
+			desc:    "bounding box across the antimeridian",
+			filters: callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: -30, MinLon: 170, MaxLat: 0, MaxLon: -170}},
+			ips:     []string{suva},
+		},
+		{
+			desc:    "radius",
+			filters: callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 44.8, Lon: 20.5, Distance: 100}},
+			ips:     []string{belgrade, paris},
+		},
+		{
+			// Belgrade is 0.8 km away, so the radius must not be truncated.
+			desc:    "fractional radius",
+			filters: callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 44.79, Lon: 20.46, Distance: 0.9}},
+			ips:     []string{belgrade},
+		},
+		{
+			desc:    "last seen",
+			filters: callhome.TelemetryFilters{LastSeen: &callhome.TimeRange{From: start.Add(3 * time.Hour)}},
+			ips:     []string{paris, suva},
+		},
+		{
+			// Paris last reported from France, so it was seen after the
+			// range even though it reported from Serbia within it.
+			desc:    "last seen of all events",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Serbia"), LastSeen: &callhome.TimeRange{To: start.Add(3 * time.Hour)}},
+			ips:     []string{belgrade},
+		},
+		{
+			desc:    "no match",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Atlantis")},
+		},
+	}
+	for _, tc := range cases {
+		page, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10}, tc.filters)
+		require.Nil(t, err, tc.desc)
+		assert.Equal(t, tc.ips, ips(page), tc.desc)
+		assert.Equal(t, uint64(len(tc.ips)), page.Total, tc.desc)
+		for i, services := range tc.services {
+			assert.Equal(t, services, []string(page.Telemetry[i].Services), tc.desc)
+		}
+	}
+}
+
+func testPaging(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+
+	cases := []struct {
+		desc   string
+		offset uint64
+		limit  uint64
+		ips    []string
+		next   bool
+	}{
+		{desc: "first page", offset: 0, limit: 2, ips: []string{nairobi, belgrade}, next: true},
+		{desc: "last page", offset: 2, limit: 2, ips: []string{paris, suva}},
+		{desc: "partial page", offset: 3, limit: 2, ips: []string{suva}},
+		{desc: "past the end", offset: 4, limit: 2},
+		{desc: "zero limit", offset: 0, limit: 0},
+	}
+	for _, tc := range cases {
+		page, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Offset: tc.offset, Limit: tc.limit}, callhome.TelemetryFilters{})
+		require.Nil(t, err, tc.desc)
+		assert.Equal(t, tc.ips, ips(page), tc.desc)
+		assert.Equal(t, uint64(4), page.Total, tc.desc)
+		assert.Equal(t, tc.next, page.NextCursor != "", tc.desc)
+	}
+
+	page, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 2}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	page, err = repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 2, Cursor: page.NextCursor}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	assert.Equal(t, []string{paris, suva}, ips(page))
+	assert.Empty(t, page.NextCursor)
+
+	last := callhome.PageMetadata{Limit: 1, Sort: callhome.SortLastSeen}
+	page, err = repo.RetrieveAll(context.Background(), last, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	_, err = repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 1, Sort: callhome.SortCountry, Cursor: page.NextCursor}, callhome.TelemetryFilters{})
+	assert.ErrorIs(t, err, callhome.ErrInvalidCursor, "cursor of another sort order")
+	_, err = repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 1, Sort: callhome.SortLastSeen, Dir: callhome.DirDesc, Cursor: page.NextCursor}, callhome.TelemetryFilters{})
+	assert.ErrorIs(t, err, callhome.ErrInvalidCursor, "cursor of another direction")
+	_, err = repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 1, Cursor: "invalid"}, callhome.TelemetryFilters{})
+	assert.ErrorIs(t, err, callhome.ErrInvalidCursor, "malformed cursor")
+}
+
+func testOrdering(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+
+	fromParis := callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.85, Lon: 2.35, Distance: 20000}}
+	cases := []struct {
+		sort    string
+		filters callhome.TelemetryFilters
+		asc     []string
+		desc    []string
+	}{
+		{sort: "", asc: []string{nairobi, belgrade, paris, suva}, desc: []string{suva, paris, belgrade, nairobi}},
+		{sort: callhome.SortLastSeen, asc: []string{nairobi, belgrade, paris, suva}, desc: []string{suva, paris, belgrade, nairobi}},
+		{sort: callhome.SortFirstSeen, asc: []string{suva, nairobi, belgrade, paris}, desc: []string{paris, belgrade, nairobi, suva}},
+		{sort: callhome.SortCountry, asc: []string{suva, paris, nairobi, belgrade}, desc: []string{belgrade, nairobi, paris, suva}},
+		{sort: callhome.SortCity, asc: []string{belgrade, nairobi, paris, suva}, desc: []string{suva, paris, nairobi, belgrade}},
+		// Ties are broken by the IP address in the same direction.
+		{sort: callhome.SortVersion, asc: []string{belgrade, nairobi, paris, suva}, desc: []string{suva, paris, nairobi, belgrade}},
+		{sort: callhome.SortServices, asc: []string{belgrade, suva, nairobi, paris}, desc: []string{paris, nairobi, suva, belgrade}},
+		{sort: callhome.SortDistance, filters: fromParis, asc: []string{paris, belgrade, nairobi, suva}, desc: []string{suva, nairobi, belgrade, paris}},
+	}
+	for _, tc := range cases {
+		for _, dir := range []string{callhome.DirAsc, callhome.DirDesc} {
+			want := tc.asc
+			if dir == callhome.DirDesc {
+				want = tc.desc
+			}
+			desc := tc.sort + " " + dir
+
+			page, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10, Sort: tc.sort, Dir: dir}, tc.filters)
+			require.Nil(t, err, desc)
+			assert.Equal(t, want, ips(page), desc)
+
+			// Following cursors visits every deployment once, in order.
+			for _, limit := range []uint64{1, 3} {
+				var got []string
+				pm := callhome.PageMetadata{Limit: limit, Sort: tc.sort, Dir: dir}
+				for i := 0; i < len(want); i++ {
+					page, err := repo.RetrieveAll(context.Background(), pm, tc.filters)
+					require.Nil(t, err, desc)
+					assert.Equal(t, uint64(len(want)), page.Total, desc)
+					got = append(got, ips(page)...)
+					if page.NextCursor == "" {
+						break
+					}
+					pm.Cursor = page.NextCursor
+				}
+				assert.Equal(t, want, got, "%s with limit %d", desc, limit)
+			}
+		}
+	}
+
+	_, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10, Sort: callhome.SortDistance}, callhome.TelemetryFilters{})
+	assert.ErrorIs(t, err, callhome.ErrInvalidSort, "distance without radius")
+	_, err = repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10, Sort: "unknown"}, callhome.TelemetryFilters{})
+	assert.ErrorIs(t, err, callhome.ErrInvalidSort, "unknown sort")
+	_, err = repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10, Dir: "up"}, callhome.TelemetryFilters{})
+	assert.ErrorIs(t, err, callhome.ErrInvalidDirection, "unknown direction")
+}
+
+func testSummary(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+
+	cases := []struct {
+		desc       string
+		filters    callhome.TelemetryFilters
+		breakdowns callhome.Breakdowns
+		countries  []callhome.CountrySummary
+		cities     []callhome.CitySummary
+		services   []callhome.ServiceSummary
+		versions   []callhome.VersionSummary
+		providers  []callhome.ProviderSummary
+		total      int
+	}{
+		{
+			desc: "all",
+			countries: []callhome.CountrySummary{
+				{Country: "Serbia", NoDeployments: 2},
+				{Country: "Fiji", NoDeployments: 1},
+				{Country: "France", NoDeployments: 1},
+				{Country: "Kenya", NoDeployments: 1},
+			},
+			cities: []callhome.CitySummary{
+				{Country: "Fiji", City: "Suva", NoDeployments: 1},
+				{Country: "France", City: "Paris", NoDeployments: 1},
+				{Country: "Kenya", City: "Nairobi", NoDeployments: 1},
+				{Country: "Serbia", City: "Belgrade", NoDeployments: 1},
+				{Country: "Serbia", City: "Novi Sad", NoDeployments: 1},
+			},
+			services: []callhome.ServiceSummary{
+				{Service: "users", NoDeployments: 4},
+				{Service: "bootstrap", NoDeployments: 1},
+				{Service: "things", NoDeployments: 1},
+			},
+			versions: []callhome.VersionSummary{
+				{Version: "0.14.1", NoDeployments: 2},
+				{Version: "0.15.0", NoDeployments: 2},
+				{Version: "0.13.1", NoDeployments: 1},
+				{Version: "0.14.0", NoDeployments: 1},
+			},
+			providers: []callhome.ProviderSummary{
+				{NetworkType: callhome.NetworkCloud, Provider: "Hetzner", NoDeployments: 1},
+				{NetworkType: callhome.NetworkUnknown, Provider: "Vodafone", NoDeployments: 1},
+				{NetworkType: callhome.NetworkISP, Provider: "Orange", NoDeployments: 1},
+				{NetworkType: callhome.NetworkISP, Provider: "SBB", NoDeployments: 1},
+				{NetworkType: callhome.NetworkISP, Provider: "Safaricom", NoDeployments: 1},
+			},
+			// The deployment that reported from two countries is counted once.
+			total: 4,
+		},
+		{
+			desc:      "country",
+			filters:   callhome.TelemetryFilters{Country: callhome.Match("Serbia")},
+			countries: []callhome.CountrySummary{{Country: "Serbia", NoDeployments: 2}},
+			cities: []callhome.CitySummary{
+				{Country: "Serbia", City: "Belgrade", NoDeployments: 1},
+				{Country: "Serbia", City: "Novi Sad", NoDeployments: 1},
+			},
+			services: []callhome.ServiceSummary{{Service: "users", NoDeployments: 2}},
+			versions: []callhome.VersionSummary{
+				{Version: "0.13.1", NoDeployments: 1},
+				{Version: "0.14.1", NoDeployments: 1},
+			},
+			providers: []callhome.ProviderSummary{
+				{NetworkType: callhome.NetworkCloud, Provider: "Hetzner", NoDeployments: 1},
+				{NetworkType: callhome.NetworkISP, Provider: "SBB", NoDeployments: 1},
+			},
+			total: 2,
+		},
+		{
+			desc:    "version prefix",
+			filters: callhome.TelemetryFilters{Version: callhome.Match("0.15.*")},
+			countries: []callhome.CountrySummary{
+				{Country: "Fiji", NoDeployments: 1},
+				{Country: "France", NoDeployments: 1},
+			},
+			cities: []callhome.CitySummary{
+				{Country: "Fiji", City: "Suva", NoDeployments: 1},
+				{Country: "France", City: "Paris", NoDeployments: 1},
+			},
+			services: []callhome.ServiceSummary{
+				{Service: "bootstrap", NoDeployments: 1},
+				{Service: "users", NoDeployments: 1},
+			},
+			versions: []callhome.VersionSummary{{Version: "0.15.0", NoDeployments: 2}},
+			providers: []callhome.ProviderSummary{
+				{NetworkType: callhome.NetworkUnknown, Provider: "Vodafone", NoDeployments: 1},
+				{NetworkType: callhome.NetworkISP, Provider: "Orange", NoDeployments: 1},
+			},
+			total: 2,
+		},
+		{
+			desc:      "radius",
+			filters:   callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: -1.3, Lon: 36.8, Distance: 50}},
+			countries: []callhome.CountrySummary{{Country: "Kenya", NoDeployments: 1}},
+			cities:    []callhome.CitySummary{{Country: "Kenya", City: "Nairobi", NoDeployments: 1}},
+			services: []callhome.ServiceSummary{
+				{Service: "things", NoDeployments: 1},
+				{Service: "users", NoDeployments: 1},
+			},
+			versions:  []callhome.VersionSummary{{Version: "0.14.0", NoDeployments: 1}},
+			providers: []callhome.ProviderSummary{{NetworkType: callhome.NetworkISP, Provider: "Safaricom", NoDeployments: 1}},
+			total:     1,
+		},
+		{
+			desc:       "selected breakdowns",
+			filters:    callhome.TelemetryFilters{Country: callhome.Match("Serbia")},
+			breakdowns: callhome.Breakdowns{callhome.BreakdownServices, callhome.BreakdownVersions},
+			services:   []callhome.ServiceSummary{{Service: "users", NoDeployments: 2}},
+			versions: []callhome.VersionSummary{
+				{Version: "0.13.1", NoDeployments: 1},
+				{Version: "0.14.1", NoDeployments: 1},
+			},
+			total: 2,
+		},
+		{
+			desc:    "no match",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Atlantis")},
+		},
+	}
+	for _, tc := range cases {
+		summary, err := repo.RetrieveSummary(context.Background(), tc.filters, tc.breakdowns, statusCfg, statusTime)
+		require.Nil(t, err, tc.desc)
+		// Entries with the same number of deployments may be in any order,
+		// as it depends on the collation of the database.
+		assert.ElementsMatch(t, tc.countries, summary.Countries, tc.desc)
+		assert.ElementsMatch(t, tc.cities, summary.Cities, tc.desc)
+		assert.ElementsMatch(t, tc.services, summary.Services, tc.desc)
+		assert.ElementsMatch(t, tc.versions, summary.Versions, tc.desc)
+		assert.ElementsMatch(t, tc.providers, summary.Providers, tc.desc)
+		assertRanked(t, tc.desc, summary.Countries, func(s callhome.CountrySummary) int { return s.NoDeployments })
+		assertRanked(t, tc.desc, summary.Cities, func(s callhome.CitySummary) int { return s.NoDeployments })
+		assertRanked(t, tc.desc, summary.Services, func(s callhome.ServiceSummary) int { return s.NoDeployments })
+		assertRanked(t, tc.desc, summary.Versions, func(s callhome.VersionSummary) int { return s.NoDeployments })
+		assertRanked(t, tc.desc, summary.Providers, func(s callhome.ProviderSummary) int { return s.NoDeployments })
+		assert.Equal(t, tc.total, summary.TotalDeployments, tc.desc)
+	}
+}
+
+// assertRanked asserts that the summary entries are ordered by the number of
+// deployments, most first.
+func assertRanked[S any](t *testing.T, desc string, entries []S, count func(S) int) {
+	t.Helper()
+	assert.True(t, slices.IsSortedFunc(entries, func(a, b S) int { return cmp.Compare(count(b), count(a)) }), "%s: entries aren't ranked: %v", desc, entries)
+}
+
+func testTimeseries(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+
+	hour := func(h time.Duration, value string, n int) callhome.TimeseriesPoint {
+		return callhome.TimeseriesPoint{Time: start.Add(h * time.Hour), Value: value, NoDeployments: n}
+	}
+	cases := []struct {
+		desc     string
+		filters  callhome.TelemetryFilters
+		interval string
+		split    string
+		points   []callhome.TimeseriesPoint
+		err      error
+	}{
+		{
+			desc:     "hourly",
+			interval: callhome.IntervalHour,
+			points: []callhome.TimeseriesPoint{
+				hour(-1, "", 1), hour(0, "", 1), hour(1, "", 1), hour(2, "", 1),
+				hour(3, "", 1), hour(4, "", 1), hour(5, "", 1),
+			},
+		},
+		{
+			desc:     "hourly by country",
+			filters:  callhome.TelemetryFilters{Service: callhome.Match("users")},
+			interval: callhome.IntervalHour,
+			split:    callhome.SplitCountry,
+			points: []callhome.TimeseriesPoint{
+				hour(-1, "Fiji", 1), hour(0, "Kenya", 1), hour(2, "Serbia", 1),
+				hour(3, "Serbia", 1), hour(5, "Fiji", 1),
+			},
+		},
+		{
+			desc:     "daily",
+			interval: callhome.IntervalDay,
+			points:   series(callhome.IntervalDay, "", func(fixture) bool { return true }),
+		},
+		{
+			desc:     "weekly by version",
+			filters:  callhome.TelemetryFilters{Country: callhome.Match("Fiji", "France")},
+			interval: callhome.IntervalWeek,
+			split:    callhome.SplitVersion,
+			points: series(callhome.IntervalWeek, callhome.SplitVersion, func(f fixture) bool {
+				return f.country == "Fiji" || f.country == "France"
+			}),
+		},
+		{
+			desc:     "monthly by service",
+			interval: callhome.IntervalMonth,
+			split:    callhome.SplitService,
+			points:   series(callhome.IntervalMonth, callhome.SplitService, func(fixture) bool { return true }),
+		},
+		{
+			desc:     "no match",
+			filters:  callhome.TelemetryFilters{Country: callhome.Match("Atlantis")},
+			interval: callhome.IntervalDay,
+		},
+		{desc: "invalid interval", interval: "fortnight", err: callhome.ErrInvalidInterval},
+		{desc: "invalid split", interval: callhome.IntervalDay, split: "city", err: callhome.ErrInvalidSplit},
+	}
+	for _, tc := range cases {
+		points, err := repo.RetrieveTimeseries(context.Background(), tc.filters, tc.interval, tc.split)
+		assert.Equal(t, tc.err, err, tc.desc)
+		require.Len(t, points, len(tc.points), tc.desc)
+		for i, p := range points {
+			assert.True(t, tc.points[i].Time.Equal(p.Time), "%s: got bucket %s, want %s", tc.desc, p.Time, tc.points[i].Time)
+			assert.Equal(t, tc.points[i].Value, p.Value, tc.desc)
+			assert.Equal(t, tc.points[i].NoDeployments, p.NoDeployments, tc.desc)
+		}
+	}
+}
+
+// series returns the points of the fixtures passing match, for intervals
+// whose buckets depend on when the suite runs.
+func series(interval, split string, match func(fixture) bool) []callhome.TimeseriesPoint {
+	type key struct {
+		time  time.Time
+		value string
+	}
+	deployments := make(map[key]map[string]bool)
+	for _, f := range fixtures {
+		if !match(f) {
+			continue
+		}
+		k := key{callhome.BucketStart(start.Add(f.at), interval), callhome.SplitValue(f.telemetry(), split)}
+		if deployments[k] == nil {
+			deployments[k] = make(map[string]bool)
+		}
+		deployments[k][f.ip] = true
+	}
+	var points []callhome.TimeseriesPoint
+	for k, ips := range deployments {
+		points = append(points, callhome.TimeseriesPoint{Time: k.time, Value: k.value, NoDeployments: len(ips)})
+	}
+	slices.SortFunc(points, func(a, b callhome.TimeseriesPoint) int {
+		if c := a.Time.Compare(b.Time); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+	return points
+}
+
+func testTransitions(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+	// Besides Suva upgrading from 0.14.1 an hour after 0.15.0 was first
+	// reported from Paris, Belgrade upgrades twice and Nairobi once. Paris
+	// downgrades, which isn't a transition.
+	for _, f := range []fixture{
+		{belgrade, "users", "0.14.1", "Serbia", "Belgrade", callhome.NetworkCloud, "Hetzner", 44.79, 20.45, 6 * time.Hour},
+		{nairobi, "users", "0.15.0", "Kenya", "Nairobi", callhome.NetworkISP, "Safaricom", -1.29, 36.82, 7 * time.Hour},
+		{belgrade, "users", "0.15.0", "Serbia", "Belgrade", callhome.NetworkCloud, "Hetzner", 44.79, 20.45, 8 * time.Hour},
+		{paris, "users", "0.13.1", "Serbia", "Novi Sad", callhome.NetworkISP, "SBB", 45.25, 19.84, 9 * time.Hour},
+	} {
+		require.Nil(t, repo.Save(context.Background(), f.telemetry()), "saving upgrades")
+	}
+
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		report  callhome.TransitionReport
+	}{
+		{
+			desc: "all",
+			report: callhome.TransitionReport{
+				Transitions: []callhome.VersionTransition{
+					{From: "0.14.1", To: "0.15.0", NoDeployments: 2, MedianAdoption: 150 * time.Minute},
+					{From: "0.13.1", To: "0.14.1", NoDeployments: 1, MedianAdoption: 7 * time.Hour},
+					{From: "0.14.0", To: "0.15.0", NoDeployments: 1, MedianAdoption: 3 * time.Hour},
+				},
+				NoDeployments:  3,
+				MedianAdoption: 210 * time.Minute,
+			},
+		},
+		{
+			// Versions reported before the window are still upgraded from.
+			desc:    "window",
+			filters: callhome.TelemetryFilters{From: start.Add(6 * time.Hour)},
+			report: callhome.TransitionReport{
+				Transitions: []callhome.VersionTransition{
+					{From: "0.13.1", To: "0.14.1", NoDeployments: 1, MedianAdoption: 7 * time.Hour},
+					{From: "0.14.0", To: "0.15.0", NoDeployments: 1, MedianAdoption: 3 * time.Hour},
+					{From: "0.14.1", To: "0.15.0", NoDeployments: 1, MedianAdoption: 4 * time.Hour},
+				},
+				NoDeployments:  2,
+				MedianAdoption: 4 * time.Hour,
+			},
+		},
+		{
+			desc:    "country",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Fiji")},
+			report: callhome.TransitionReport{
+				Transitions:    []callhome.VersionTransition{{From: "0.14.1", To: "0.15.0", NoDeployments: 1, MedianAdoption: time.Hour}},
+				NoDeployments:  1,
+				MedianAdoption: time.Hour,
+			},
+		},
+		{
+			desc:    "no transitions",
+			filters: callhome.TelemetryFilters{Version: callhome.Match("0.15.*")},
+		},
+	}
+	for _, tc := range cases {
+		report, err := repo.RetrieveTransitions(context.Background(), tc.filters)
+		require.Nil(t, err, tc.desc)
+		assert.Equal(t, tc.report, report, tc.desc)
+	}
+}
+
+func testCohorts(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+	// Nairobi keeps reporting for two more weeks and Belgrade for one.
+	returns := []fixture{
+		{nairobi, "users", "0.14.0", "Kenya", "Nairobi", callhome.NetworkISP, "Safaricom", -1.29, 36.82, 8 * 24 * time.Hour},
+		{nairobi, "users", "0.14.0", "Kenya", "Nairobi", callhome.NetworkISP, "Safaricom", -1.29, 36.82, 15 * 24 * time.Hour},
+		{belgrade, "users", "0.13.1", "Serbia", "Belgrade", callhome.NetworkCloud, "Hetzner", 44.79, 20.45, 8 * 24 * time.Hour},
+	}
+	for _, f := range returns {
+		require.Nil(t, repo.Save(context.Background(), f.telemetry()), "saving returning deployments")
+	}
+	events := append(slices.Clone(fixtures), returns...)
+	end := start.Add(20 * 24 * time.Hour)
+	all := func(fixture) bool { return true }
+
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		period  string
+		cohorts []callhome.Cohort
+	}{
+		{
+			desc:    "weekly",
+			filters: callhome.TelemetryFilters{To: end},
+			period:  callhome.IntervalWeek,
+			cohorts: cohorts(events, callhome.IntervalWeek, time.Time{}, end, all),
+		},
+		{
+			desc:    "monthly",
+			filters: callhome.TelemetryFilters{To: end},
+			period:  callhome.IntervalMonth,
+			cohorts: cohorts(events, callhome.IntervalMonth, time.Time{}, end, all),
+		},
+		{
+			desc:    "country",
+			filters: callhome.TelemetryFilters{To: end, Country: callhome.Match("Kenya")},
+			period:  callhome.IntervalWeek,
+			cohorts: cohorts(events, callhome.IntervalWeek, time.Time{}, end, func(f fixture) bool { return f.country == "Kenya" }),
+		},
+		{
+			// Deployments first seen before the window belong to no cohort.
+			desc:    "window",
+			filters: callhome.TelemetryFilters{From: start.Add(time.Hour), To: end},
+			period:  callhome.IntervalWeek,
+			cohorts: cohorts(events, callhome.IntervalWeek, start.Add(time.Hour), end, all),
+		},
+	}
+	for _, tc := range cases {
+		res, err := repo.RetrieveCohorts(context.Background(), tc.filters, tc.period)
+		require.Nil(t, err, tc.desc)
+		assert.Equal(t, tc.cohorts, res, tc.desc)
+	}
+
+	_, err := repo.RetrieveCohorts(context.Background(), callhome.TelemetryFilters{}, callhome.IntervalDay)
+	assert.ErrorIs(t, err, callhome.ErrInvalidPeriod)
+}
+
+// cohorts returns the cohorts of the events passing match, for periods
+// whose boundaries depend on when the suite runs.
+func cohorts(events []fixture, period string, from, end time.Time, match func(fixture) bool) []callhome.Cohort {
+	firstSeen := make(map[string]time.Time)
+	for _, f := range events {
+		if !match(f) {
+			continue
+		}
+		if seen, ok := firstSeen[f.ip]; !ok || start.Add(f.at).Before(seen) {
+			firstSeen[f.ip] = start.Add(f.at)
+		}
+	}
+	deployments := make(map[[2]time.Time]map[string]bool)
+	for _, f := range events {
+		seen, ok := firstSeen[f.ip]
+		if !match(f) || !ok || seen.Before(from) {
+			continue
+		}
+		k := [2]time.Time{callhome.BucketStart(seen, period), callhome.BucketStart(start.Add(f.at), period)}
+		if deployments[k] == nil {
+			deployments[k] = make(map[string]bool)
+		}
+		deployments[k][f.ip] = true
+	}
+	var activity []callhome.CohortActivity
+	for k, ips := range deployments {
+		activity = append(activity, callhome.CohortActivity{Cohort: k[0], Period: k[1], NoDeployments: len(ips)})
+	}
+	return callhome.BuildCohorts(activity, period, end)
+}
+
+func testServiceSets(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		sets    []callhome.DeploymentServices
+	}{
+		{
+			desc: "all",
+			sets: []callhome.DeploymentServices{
+				{IpAddress: nairobi, Services: []string{"things", "users"}},
+				{IpAddress: belgrade, Services: []string{"users"}},
+				{IpAddress: paris, Services: []string{"bootstrap", "users"}},
+				{IpAddress: suva, Services: []string{"users"}},
+			},
+		},
+		{
+			desc:    "country",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Kenya", "France")},
+			sets: []callhome.DeploymentServices{
+				{IpAddress: nairobi, Services: []string{"things", "users"}},
+				{IpAddress: paris, Services: []string{"bootstrap"}},
+			},
+		},
+		{
+			desc:    "window",
+			filters: callhome.TelemetryFilters{From: start.Add(time.Hour), To: start.Add(3 * time.Hour)},
+			sets: []callhome.DeploymentServices{
+				{IpAddress: nairobi, Services: []string{"things"}},
+				{IpAddress: belgrade, Services: []string{"users"}},
+				{IpAddress: paris, Services: []string{"users"}},
+			},
+		},
+		{
+			desc:    "no deployments",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Chile")},
+		},
+	}
+	for _, tc := range cases {
+		sets, err := repo.RetrieveServiceSets(context.Background(), tc.filters)
+		require.Nil(t, err, tc.desc)
+		assert.Equal(t, tc.sets, sets, tc.desc)
+	}
+}
+
+func testStatuses(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+
+	cases := []struct {
+		desc     string
+		filters  callhome.TelemetryFilters
+		statuses []callhome.StatusSummary
+	}{
+		{
+			desc: "all",
+			statuses: []callhome.StatusSummary{
+				{Status: callhome.StatusActive, NoDeployments: 1},
+				{Status: callhome.StatusChurned, NoDeployments: 1},
+				{Status: callhome.StatusDormant, NoDeployments: 1},
+				{Status: callhome.StatusStale, NoDeployments: 1},
+			},
+		},
+		{
+			// Paris is stale by its latest report, from France.
+			desc:    "country",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Serbia")},
+			statuses: []callhome.StatusSummary{
+				{Status: callhome.StatusDormant, NoDeployments: 1},
+				{Status: callhome.StatusStale, NoDeployments: 1},
+			},
+		},
+		{
+			desc:    "service",
+			filters: callhome.TelemetryFilters{Service: callhome.Match("users")},
+			statuses: []callhome.StatusSummary{
+				{Status: callhome.StatusActive, NoDeployments: 1},
+				{Status: callhome.StatusChurned, NoDeployments: 1},
+				{Status: callhome.StatusDormant, NoDeployments: 1},
+				{Status: callhome.StatusStale, NoDeployments: 1},
+			},
+		},
+		{
+			desc:    "no deployments",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Chile")},
+		},
+	}
+	for _, tc := range cases {
+		summary, err := repo.RetrieveSummary(context.Background(), tc.filters, callhome.Breakdowns{callhome.BreakdownStatuses}, statusCfg, statusTime)
+		require.Nil(t, err, tc.desc)
+		assert.Equal(t, tc.statuses, summary.Statuses, tc.desc)
+	}
+}
+
+func testErase(t *testing.T, repo callhome.TelemetryRepo) {
+	seed(t, repo)
+
+	receipt := callhome.ErasureReceipt{ID: "erasure-1", Subject: callhome.SubjectDeployment, Blocklisted: true, ErasedAt: start}
+	receipt, err := repo.Erase(context.Background(), receipt, []string{nairobi, "10.0.0.99"}, []string{nairobi})
+	require.Nil(t, err)
+	assert.Equal(t, uint64(2), receipt.RecordsRemoved)
+	assert.Equal(t, "erasure-1", receipt.ID)
+
+	page, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	assert.Equal(t, []string{belgrade, paris, suva}, ips(page))
+	assert.Equal(t, uint64(3), page.Total)
+
+	summary, err := repo.RetrieveSummary(context.Background(), callhome.TelemetryFilters{Country: callhome.Match("Kenya")}, nil, statusCfg, statusTime)
+	require.Nil(t, err)
+	assert.Empty(t, summary.Countries)
+
+	blocked, err := repo.Blocked(context.Background(), belgrade, nairobi)
+	require.Nil(t, err)
+	assert.True(t, blocked)
+	blocked, err = repo.Blocked(context.Background(), belgrade)
+	require.Nil(t, err)
+	assert.False(t, blocked)
+
+	// Erasing without blocklisting removes data only, and blocklisting an
+	// identifier again keeps it blocked.
+	receipt, err = repo.Erase(context.Background(), callhome.ErasureReceipt{ID: "erasure-2", Subject: callhome.SubjectDeployment, ErasedAt: start}, []string{belgrade}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, uint64(1), receipt.RecordsRemoved)
+	blocked, err = repo.Blocked(context.Background(), belgrade)
+	require.Nil(t, err)
+	assert.False(t, blocked)
+
+	_, err = repo.Erase(context.Background(), callhome.ErasureReceipt{ID: "erasure-3", Subject: callhome.SubjectDeployment, Blocklisted: true, ErasedAt: start}, []string{nairobi}, []string{nairobi})
+	require.Nil(t, err)
+	blocked, err = repo.Blocked(context.Background(), nairobi)
+	require.Nil(t, err)
+	assert.True(t, blocked)
+}
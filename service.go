@@ -6,84 +6,412 @@ package callhome
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
+
+	"github.com/absmach/magistrala"
+	"github.com/absmach/magistrala/pkg/errors"
 )
 
-const pageLimit = 1000
+const (
+	pageLimit = 1000
+	// defRetention is used when Config.Retention isn't set.
+	defRetention = 90 * 24 * time.Hour
+)
 
 // Service to receive homing telemetry data, persist and retrieve it.
 type Service interface {
 	// Save saves the homing telemetry data and its location information.
 	Save(ctx context.Context, t Telemetry) error
 	// Retrieve retrieves homing telemetry data from the specified repository.
-	Retrieve(ctx context.Context, pm PageMetadata, filters TelemetryFilters) (TelemetryPage, error)
-	// RetrieveSummary gets distinct countries and ip addresses
-	RetrieveSummary(ctx context.Context, filters TelemetryFilters) (TelemetrySummary, error)
+	// Coordinates are generalised and area filters finer than them rejected
+	// unless an admin token is provided.
+	Retrieve(ctx context.Context, token string, pm PageMetadata, filters TelemetryFilters) (TelemetryPage, error)
+	// RetrieveChurn lists the deployments that went silent within the filter
+	// window: their latest event is within it, and they're no longer active.
+	// Coordinates are generalised unless an admin token is provided.
+	RetrieveChurn(ctx context.Context, token string, pm PageMetadata, filters TelemetryFilters) (TelemetryPage, error)
+	// RetrieveSummary counts the deployments matching the filters in total and
+	// by each of the breakdowns, all of them when none is given. Area filters
+	// finer than public coordinates require an admin token.
+	RetrieveSummary(ctx context.Context, token string, filters TelemetryFilters, breakdowns Breakdowns) (TelemetrySummary, error)
+	// RetrieveTimeseries counts the deployments matching the filters in every
+	// bucket of the interval, optionally split by country, version or service.
+	RetrieveTimeseries(ctx context.Context, filters TelemetryFilters, interval, split string) ([]TimeseriesPoint, error)
+	// RetrieveAdoption returns the share of active deployments of every
+	// version in every bucket of the interval.
+	RetrieveAdoption(ctx context.Context, filters TelemetryFilters, interval string) ([]VersionShare, error)
+	// RetrieveTransitions counts the deployments that moved between versions
+	// within the filter window, along with how long they took to adopt them.
+	RetrieveTransitions(ctx context.Context, filters TelemetryFilters) (TransitionReport, error)
+	// RetrieveCohorts reports the retention of the weekly or monthly cohorts
+	// of deployments matching the filters.
+	RetrieveCohorts(ctx context.Context, filters TelemetryFilters, period string) ([]Cohort, error)
+	// RetrieveCooccurrence reports which services of deployments matching the
+	// filters run together, and the deployments running the service without
+	// its usual companions when a service is given. At most limit service
+	// sets and outliers are reported. Outliers carry their IP addresses only
+	// when an admin token is provided.
+	RetrieveCooccurrence(ctx context.Context, token string, filters TelemetryFilters, service string, limit uint64) (CooccurrenceReport, error)
 	// ServeUI gets the callhome index html page
 	ServeUI(ctx context.Context, filters TelemetryFilters) ([]byte, error)
+	// Erase removes all telemetry data of a deployment and returns the erasure receipt.
+	Erase(ctx context.Context, token string, req ErasureRequest) (ErasureReceipt, error)
+}
+
+// Config defines the telemetry service options.
+type Config struct {
+	// AdminKey authenticates administrative requests. Administrative
+	// requests are rejected when it is empty.
+	AdminKey string
+	// Precision defines how coordinates are generalised in public outputs.
+	Precision PrecisionConfig
+	// Retention is how long raw telemetry is kept.
+	Retention time.Duration
+	// Status defines the statuses of deployments. Unset thresholds take
+	// their defaults.
+	Status StatusConfig
+	// CursorKey is the secret pagination cursors are sealed under. Cursors
+	// are only valid on the instances sharing it.
+	CursorKey string
 }
 
 var _ Service = (*telemetryService)(nil)
 
 type telemetryService struct {
-	repo   TelemetryRepo
-	locSvc LocationService
+	repo    TelemetryRepo
+	locSvc  LocationService
+	asnSvc  ASNService
+	anon    Anonymizer
+	idp     magistrala.IDProvider
+	cursors cursorSealer
+	cfg     Config
 }
 
 // New creates a new instance of the telemetry service.
-func New(repo TelemetryRepo, locSvc LocationService) Service {
+func New(repo TelemetryRepo, locSvc LocationService, asnSvc ASNService, anon Anonymizer, idp magistrala.IDProvider, cfg Config) Service {
+	cfg.Status = cfg.Status.withDefaults()
 	return &telemetryService{
-		repo:   repo,
-		locSvc: locSvc,
+		repo:    repo,
+		locSvc:  locSvc,
+		asnSvc:  asnSvc,
+		anon:    anon,
+		idp:     idp,
+		cursors: newCursorSealer(cfg.CursorKey),
+		cfg:     cfg,
 	}
 }
 
 // Retrieve retrieves homing telemetry data from the specified repository.
-func (ts *telemetryService) Retrieve(ctx context.Context, pm PageMetadata, filters TelemetryFilters) (TelemetryPage, error) {
-	return ts.repo.RetrieveAll(ctx, pm, filters)
+func (ts *telemetryService) Retrieve(ctx context.Context, token string, pm PageMetadata, filters TelemetryFilters) (TelemetryPage, error) {
+	now := time.Now()
+	filters, err := ts.resolveStatus(filters, now)
+	if err != nil {
+		return TelemetryPage{}, err
+	}
+	filters, err = ts.authorize(token, filters)
+	if err != nil {
+		return TelemetryPage{}, err
+	}
+	// Orders by the precise distance from points of the caller's choice
+	// would locate deployments, so only administrators can sort by it.
+	if token == "" && pm.Sort == SortDistance && ts.cfg.Precision.Resolution() > 0 {
+		return TelemetryPage{}, errors.ErrAuthentication
+	}
+
+	sealed := pm.Cursor
+	if sealed != "" {
+		cursor, err := ts.cursors.open(sealed)
+		if err != nil {
+			return TelemetryPage{}, err
+		}
+		pm.Cursor = cursor
+	}
+
+	page, err := ts.repo.RetrieveAll(ctx, pm, filters)
+	if err != nil {
+		return TelemetryPage{}, err
+	}
+	page.Cursor = sealed
+	if page.NextCursor != "" {
+		page.NextCursor = ts.cursors.seal(page.NextCursor)
+	}
+	// Deployments are represented by their latest event.
+	for i := range page.Telemetry {
+		page.Telemetry[i].Status = ts.cfg.Status.Classify(page.Telemetry[i].ServiceTime, now)
+	}
+	if token == "" {
+		ts.cfg.Precision.Generalize(page.Telemetry)
+	}
+	return page, nil
+}
+
+func (ts *telemetryService) RetrieveChurn(ctx context.Context, token string, pm PageMetadata, filters TelemetryFilters) (TelemetryPage, error) {
+	// The window bounds the latest events of the deployments rather than
+	// their events.
+	silent := TimeRange{From: filters.From, To: time.Now().Add(-ts.cfg.Status.StaleAfter)}
+	if !filters.To.IsZero() {
+		silent = silent.Intersect(TimeRange{To: filters.To})
+	}
+	if filters.LastSeen != nil {
+		silent = silent.Intersect(*filters.LastSeen)
+	}
+	filters.From, filters.To = time.Time{}, time.Time{}
+	filters.LastSeen = &silent
+	return ts.Retrieve(ctx, token, pm, filters)
+}
+
+// resolveStatus narrows the LastSeen range of the filters down to the
+// latest events of the deployments of their status at now.
+func (ts *telemetryService) resolveStatus(filters TelemetryFilters, now time.Time) (TelemetryFilters, error) {
+	if err := ValidateStatus(filters.Status); err != nil {
+		return TelemetryFilters{}, err
+	}
+	if filters.Status == "" {
+		return filters, nil
+	}
+	seen := ts.cfg.Status.LastSeen(filters.Status, now)
+	if filters.LastSeen != nil {
+		seen = seen.Intersect(*filters.LastSeen)
+	}
+	filters.LastSeen = &seen
+	return filters, nil
 }
 
 // Save saves the homing telemetry data and its location information.
 func (ts *telemetryService) Save(ctx context.Context, t Telemetry) error {
-	locRec, err := ts.locSvc.GetLocation(ctx, t.IpAddress)
+	t.LastSeen = time.Now()
+	stored, err := ts.anon.Anonymize(t.IpAddress, t.LastSeen)
 	if err != nil {
 		return err
 	}
-	t.City = locRec.City
-	t.Country = locRec.Country_long
-	t.Latitude = float64(locRec.Latitude)
-	t.Longitude = float64(locRec.Longitude)
-	t.LastSeen = time.Now()
+	ids := []string{stored}
+	// Without a privacy key no address is blocklisted by its fingerprint.
+	if fp, err := ts.anon.Fingerprint(t.IpAddress); err == nil {
+		ids = append(ids, fp)
+	}
+	blocked, err := ts.repo.Blocked(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		// Reports from erased deployments are dropped silently, so that
+		// clients don't retry them.
+		return nil
+	}
+
+	loc, err := ts.locSvc.GetLocation(ctx, t.IpAddress)
+	if err != nil {
+		return err
+	}
+	t.Country = loc.Country
+	t.CountryCode = loc.CountryCode
+	t.Region = loc.Region
+	t.City = loc.City
+	t.PostalCode = loc.PostalCode
+	t.Timezone = loc.Timezone
+	t.Latitude = loc.Latitude
+	t.Longitude = loc.Longitude
+	asn, err := ts.asnSvc.GetASN(ctx, t.IpAddress)
+	if err != nil {
+		return err
+	}
+	t.ASN = asn.Number
+	t.ASOrg = asn.Organization
+	t.Provider = asn.Provider
+	t.NetworkType = asn.NetworkType
+	// Lookups above need the full address, so it is replaced only now.
+	t.IpAddress = stored
 	return ts.repo.Save(ctx, t)
 }
 
-func (ts *telemetryService) RetrieveSummary(ctx context.Context, filters TelemetryFilters) (TelemetrySummary, error) {
-	return ts.repo.RetrieveSummary(ctx, filters)
+// Erase removes all telemetry data of a deployment and returns the erasure receipt.
+func (ts *telemetryService) Erase(ctx context.Context, token string, req ErasureRequest) (ErasureReceipt, error) {
+	if err := ts.authenticate(token); err != nil {
+		return ErasureReceipt{}, err
+	}
+
+	receipt := ErasureReceipt{
+		Blocklisted: req.Blocklist,
+		Reason:      req.Reason,
+		ErasedAt:    time.Now(),
+	}
+	var ids []string
+	var blocklist string
+	switch {
+	case req.IpAddress != "":
+		retention := ts.cfg.Retention
+		if retention <= 0 {
+			retention = defRetention
+		}
+		stored, err := ts.anon.Identifiers(req.IpAddress, receipt.ErasedAt.Add(-retention), receipt.ErasedAt)
+		if err != nil {
+			return ErasureReceipt{}, errors.Wrap(errors.ErrMalformedEntity, err)
+		}
+		ids = stored
+		// Records stored before the privacy mode was changed keep the raw address.
+		if !slices.Contains(ids, req.IpAddress) {
+			ids = append(ids, req.IpAddress)
+		}
+		if req.Blocklist {
+			fp, err := ts.anon.Fingerprint(req.IpAddress)
+			if err != nil {
+				return ErasureReceipt{}, errors.Wrap(errors.ErrMalformedEntity, err)
+			}
+			blocklist = fp
+		}
+		receipt.Subject = SubjectIPAddress
+	case req.Deployment != "":
+		ids = []string{req.Deployment}
+		blocklist = req.Deployment
+		receipt.Subject = SubjectDeployment
+	default:
+		return ErasureReceipt{}, errors.ErrMalformedEntity
+	}
+
+	id, err := ts.idp.ID()
+	if err != nil {
+		return ErasureReceipt{}, err
+	}
+	receipt.ID = id
+
+	var bl []string
+	if req.Blocklist {
+		bl = []string{blocklist}
+	}
+	return ts.repo.Erase(ctx, receipt, ids, bl)
+}
+
+// authorize authenticates the token when one is given. Public requests can't
+// filter by areas finer than the coordinates they get, so their areas are
+// snapped to the cells of public coordinates.
+func (ts *telemetryService) authorize(token string, filters TelemetryFilters) (TelemetryFilters, error) {
+	if token != "" {
+		return filters, ts.authenticate(token)
+	}
+	return ts.cfg.Precision.PublicArea(filters)
+}
+
+func (ts *telemetryService) authenticate(token string) error {
+	if ts.cfg.AdminKey == "" || subtle.ConstantTimeCompare([]byte(token), []byte(ts.cfg.AdminKey)) != 1 {
+		return errors.ErrAuthentication
+	}
+	return nil
+}
+
+func (ts *telemetryService) RetrieveSummary(ctx context.Context, token string, filters TelemetryFilters, breakdowns Breakdowns) (TelemetrySummary, error) {
+	if err := breakdowns.Validate(); err != nil {
+		return TelemetrySummary{}, err
+	}
+	now := time.Now()
+	filters, err := ts.resolveStatus(filters, now)
+	if err != nil {
+		return TelemetrySummary{}, err
+	}
+	filters, err = ts.authorize(token, filters)
+	if err != nil {
+		return TelemetrySummary{}, err
+	}
+	return ts.repo.RetrieveSummary(ctx, filters, breakdowns, ts.cfg.Status, now)
+}
+
+func (ts *telemetryService) RetrieveTimeseries(ctx context.Context, filters TelemetryFilters, interval, split string) ([]TimeseriesPoint, error) {
+	if err := ValidateTimeseries(interval, split); err != nil {
+		return nil, err
+	}
+	filters, err := ts.cfg.Precision.PublicArea(filters)
+	if err != nil {
+		return nil, err
+	}
+	return ts.repo.RetrieveTimeseries(ctx, filters, interval, split)
+}
+
+func (ts *telemetryService) RetrieveAdoption(ctx context.Context, filters TelemetryFilters, interval string) ([]VersionShare, error) {
+	if err := ValidateTimeseries(interval, ""); err != nil {
+		return nil, err
+	}
+	filters, err := ts.cfg.Precision.PublicArea(filters)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := ts.repo.RetrieveTimeseries(ctx, filters, interval, SplitVersion)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := ts.repo.RetrieveTimeseries(ctx, filters, interval, "")
+	if err != nil {
+		return nil, err
+	}
+	return Shares(versions, totals), nil
+}
+
+func (ts *telemetryService) RetrieveTransitions(ctx context.Context, filters TelemetryFilters) (TransitionReport, error) {
+	filters, err := ts.cfg.Precision.PublicArea(filters)
+	if err != nil {
+		return TransitionReport{}, err
+	}
+	return ts.repo.RetrieveTransitions(ctx, filters)
+}
+
+func (ts *telemetryService) RetrieveCohorts(ctx context.Context, filters TelemetryFilters, period string) ([]Cohort, error) {
+	if err := ValidateCohortPeriod(period); err != nil {
+		return nil, err
+	}
+	filters, err := ts.cfg.Precision.PublicArea(filters)
+	if err != nil {
+		return nil, err
+	}
+	return ts.repo.RetrieveCohorts(ctx, filters, period)
+}
+
+func (ts *telemetryService) RetrieveCooccurrence(ctx context.Context, token string, filters TelemetryFilters, service string, limit uint64) (CooccurrenceReport, error) {
+	filters, err := ts.authorize(token, filters)
+	if err != nil {
+		return CooccurrenceReport{}, err
+	}
+	deployments, err := ts.repo.RetrieveServiceSets(ctx, filters)
+	if err != nil {
+		return CooccurrenceReport{}, err
+	}
+	report := AnalyzeCooccurrence(deployments, service, int(limit))
+	if token == "" {
+		for i := range report.Outliers {
+			report.Outliers[i].IpAddress = ""
+		}
+	}
+	return report, nil
 }
 
 // ServeUI gets the callhome index html page.
 func (ts *telemetryService) ServeUI(ctx context.Context, filters TelemetryFilters) ([]byte, error) {
+	filters, err := ts.cfg.Precision.PublicArea(filters)
+	if err != nil {
+		return nil, err
+	}
 	tmpl := template.Must(template.ParseFiles("./web/template/index.html"))
 
-	if filters.From.IsZero() && filters.To.IsZero() && filters.City == "" && filters.Country == "" && filters.Service == "" && filters.Version == "" {
+	if filters.From.IsZero() && filters.To.IsZero() && filters.City.IsZero() && filters.Country.IsZero() && filters.Service.IsZero() && filters.Version.IsZero() &&
+		filters.Provider.IsZero() && filters.NetworkType.IsZero() && filters.BoundingBox == nil && filters.Radius == nil {
 		filters.From = time.Now().Add(-time.Hour)
 	}
 
-	summary, err := ts.repo.RetrieveSummary(ctx, filters)
+	summary, err := ts.repo.RetrieveSummary(ctx, filters, Breakdowns{BreakdownCountries}, ts.cfg.Status, time.Now())
 	if err != nil {
 		return nil, err
 	}
-	unfilteredSummary, err := ts.repo.RetrieveSummary(ctx, TelemetryFilters{})
+	unfilteredSummary, err := ts.repo.RetrieveSummary(ctx, TelemetryFilters{}, Breakdowns{BreakdownCountries, BreakdownCities, BreakdownServices, BreakdownVersions}, ts.cfg.Status, time.Now())
 	if err != nil {
 		return nil, err
 	}
-	telPage, err := ts.repo.RetrieveAll(ctx, PageMetadata{Limit: pageLimit}, filters)
+	telPage, err := ts.repo.RetrieveAll(ctx, PageMetadata{Limit: pageLimit, Sort: SortLastSeen, Dir: DirDesc}, filters)
 	if err != nil {
 		return nil, err
 	}
+	ts.cfg.Precision.Generalize(telPage.Telemetry)
 
 	pg, err := json.Marshal(telPage)
 	if err != nil {
@@ -107,14 +435,15 @@ func (ts *telemetryService) ServeUI(ctx context.Context, filters TelemetryFilter
 		Countries       string
 		Cities          string
 		FilterCountries []CountrySummary
-		FilterCities    []string
-		FilterServices  []string
-		FilterVersions  []string
+		FilterCities    []CitySummary
+		FilterServices  []ServiceSummary
+		FilterVersions  []VersionSummary
 		NoDeployments   int
 		NoCountries     int
 		MapData         string
 		From            string
 		To              string
+		AreaResolution  float64
 	}{
 		Countries:       string(countries),
 		FilterCountries: unfilteredSummary.Countries,
@@ -126,6 +455,7 @@ func (ts *telemetryService) ServeUI(ctx context.Context, filters TelemetryFilter
 		MapData:         string(pg),
 		From:            from,
 		To:              to,
+		AreaResolution:  ts.cfg.Precision.Resolution(),
 	}
 
 	var res bytes.Buffer
@@ -5,14 +5,18 @@ package callhome_test
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/absmach/callhome"
 	"github.com/absmach/callhome/mocks"
 	"github.com/absmach/callhome/timescale"
 	repoMocks "github.com/absmach/callhome/timescale/mocks"
-	"github.com/ip2location/ip2location-go/v9"
+	"github.com/absmach/magistrala/pkg/errors"
+	"github.com/absmach/magistrala/pkg/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -21,72 +25,428 @@ func TestRetrieve(t *testing.T) {
 	ctx := context.TODO()
 	t.Run("failed repo save", func(t *testing.T) {
 		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		svc := callhome.New(timescaleRepo, nil)
-		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}).Return(callhome.TelemetryPage{}, timescale.ErrSaveEvent)
-		_, err := svc.Retrieve(ctx, callhome.PageMetadata{}, callhome.TelemetryFilters{})
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, callhome.Config{})
+		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, mock.Anything).Return(callhome.TelemetryPage{}, timescale.ErrSaveEvent)
+		_, err := svc.Retrieve(ctx, "", callhome.PageMetadata{}, callhome.TelemetryFilters{})
 		assert.NotNil(t, err)
 		assert.Equal(t, timescale.ErrSaveEvent, err)
 	})
 	t.Run("success", func(t *testing.T) {
 		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		svc := callhome.New(timescaleRepo, nil)
-		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}).Return(callhome.TelemetryPage{}, nil)
-		_, err := svc.Retrieve(ctx, callhome.PageMetadata{}, callhome.TelemetryFilters{})
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, callhome.Config{})
+		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, mock.Anything).Return(callhome.TelemetryPage{}, nil)
+		_, err := svc.Retrieve(ctx, "", callhome.PageMetadata{}, callhome.TelemetryFilters{})
 		assert.Nil(t, err)
 	})
+
+	cfg := callhome.Config{
+		AdminKey:  "admin-key",
+		Precision: callhome.PrecisionConfig{Mode: callhome.PrecisionRound, Decimals: 1},
+	}
+	page := func() callhome.TelemetryPage {
+		return callhome.TelemetryPage{Telemetry: []callhome.Telemetry{{Latitude: 48.85661, Longitude: 2.35222}}}
+	}
+	t.Run("public coordinates are generalised", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, cfg)
+		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, mock.Anything).Return(page(), nil)
+		tp, err := svc.Retrieve(ctx, "", callhome.PageMetadata{}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, 48.9, tp.Telemetry[0].Latitude)
+		assert.Equal(t, 2.4, tp.Telemetry[0].Longitude)
+	})
+	t.Run("authenticated coordinates are precise", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, cfg)
+		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, mock.Anything).Return(page(), nil)
+		tp, err := svc.Retrieve(ctx, cfg.AdminKey, callhome.PageMetadata{}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, 48.85661, tp.Telemetry[0].Latitude)
+		assert.Equal(t, 2.35222, tp.Telemetry[0].Longitude)
+	})
+	t.Run("invalid token", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, cfg)
+		_, err := svc.Retrieve(ctx, "invalid", callhome.PageMetadata{}, callhome.TelemetryFilters{})
+		assert.Equal(t, errors.ErrAuthentication, err)
+	})
+	small := callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.85661, Lon: 2.35222, Distance: 1}}
+	t.Run("public area finer than coordinates", func(t *testing.T) {
+		svc := callhome.New(repoMocks.NewTelemetryRepo(t), nil, nil, nil, nil, cfg)
+		_, err := svc.Retrieve(ctx, "", callhome.PageMetadata{}, small)
+		assert.Equal(t, callhome.ErrAreaTooSmall, err)
+		_, err = svc.RetrieveSummary(ctx, "", small, nil)
+		assert.Equal(t, callhome.ErrAreaTooSmall, err)
+		_, err = svc.RetrieveTimeseries(ctx, small, callhome.IntervalDay, "")
+		assert.Equal(t, callhome.ErrAreaTooSmall, err)
+	})
+	t.Run("public area snapped to the coordinates", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, cfg)
+		box := callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: 48.83, MinLon: 2.31, MaxLat: 48.96, MaxLon: 2.44}}
+		snapped := mock.MatchedBy(func(filters callhome.TelemetryFilters) bool {
+			bb := filters.BoundingBox
+			return bb != nil && math.Abs(bb.MinLat-48.75) < 1e-9 && math.Abs(bb.MinLon-2.25) < 1e-9 &&
+				math.Abs(bb.MaxLat-49.05) < 1e-9 && math.Abs(bb.MaxLon-2.45) < 1e-9
+		})
+		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, snapped).Return(page(), nil)
+		_, err := svc.Retrieve(ctx, "", callhome.PageMetadata{}, box)
+		assert.Nil(t, err)
+		// Authenticated requests filter by the area as given.
+		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, box).Return(page(), nil)
+		_, err = svc.Retrieve(ctx, cfg.AdminKey, callhome.PageMetadata{}, box)
+		assert.Nil(t, err)
+	})
+	t.Run("distance order", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, cfg)
+		pm := callhome.PageMetadata{Sort: callhome.SortDistance}
+		area := callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.85661, Lon: 2.35222, Distance: 100}}
+		_, err := svc.Retrieve(ctx, "", pm, area)
+		assert.Equal(t, errors.ErrAuthentication, err)
+		timescaleRepo.On("RetrieveAll", ctx, pm, area).Return(page(), nil)
+		_, err = svc.Retrieve(ctx, cfg.AdminKey, pm, area)
+		assert.Nil(t, err)
+	})
+	t.Run("authenticated area finer than coordinates", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, cfg)
+		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, mock.Anything).Return(page(), nil)
+		_, err := svc.Retrieve(ctx, cfg.AdminKey, callhome.PageMetadata{}, small)
+		assert.Nil(t, err)
+		_, err = svc.RetrieveSummary(ctx, cfg.AdminKey, small, nil)
+		assert.Nil(t, err)
+	})
+	t.Run("deployments are classified", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, callhome.Config{})
+		page := callhome.TelemetryPage{Telemetry: []callhome.Telemetry{
+			{ServiceTime: time.Now().Add(-time.Hour)},
+			{ServiceTime: time.Now().Add(-90 * 24 * time.Hour)},
+		}}
+		// Active deployments were last seen within StaleAfter of now.
+		start := time.Now()
+		active := mock.MatchedBy(func(filters callhome.TelemetryFilters) bool {
+			seen := filters.LastSeen
+			return seen != nil && seen.To.IsZero() &&
+				between(seen.From, start.Add(-7*24*time.Hour), time.Now().Add(-7*24*time.Hour))
+		})
+		timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, active).Return(page, nil)
+		tp, err := svc.Retrieve(ctx, "", callhome.PageMetadata{}, callhome.TelemetryFilters{Status: callhome.StatusActive})
+		assert.Nil(t, err)
+		assert.Equal(t, callhome.StatusActive, tp.Telemetry[0].Status)
+		assert.Equal(t, callhome.StatusChurned, tp.Telemetry[1].Status)
+	})
+	t.Run("invalid status", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		svc := callhome.New(timescaleRepo, nil, nil, nil, nil, callhome.Config{})
+		_, err := svc.Retrieve(ctx, "", callhome.PageMetadata{}, callhome.TelemetryFilters{Status: "gone"})
+		assert.Equal(t, callhome.ErrInvalidStatus, err)
+	})
+}
+
+func TestRetrieveCursor(t *testing.T) {
+	ctx := context.TODO()
+	plain := callhome.Cursor{Sort: callhome.SortCity, Key: "Nairobi", IpAddress: "41.90.185.50"}.Encode()
+	timescaleRepo := repoMocks.NewTelemetryRepo(t)
+	svc := callhome.New(timescaleRepo, nil, nil, nil, nil, callhome.Config{CursorKey: "secret"})
+
+	timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{Limit: 1, Sort: callhome.SortCity}, mock.Anything).
+		Return(callhome.TelemetryPage{PageMetadata: callhome.PageMetadata{NextCursor: plain}}, nil)
+	page, err := svc.Retrieve(ctx, "", callhome.PageMetadata{Limit: 1, Sort: callhome.SortCity}, callhome.TelemetryFilters{})
+	assert.Nil(t, err)
+	sealed := page.NextCursor
+	assert.NotEqual(t, plain, sealed)
+	b, err := base64.RawURLEncoding.DecodeString(sealed)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(b), "41.90.185.50")
+	assert.NotContains(t, string(b), "Nairobi")
+
+	// The repository gets the cursor it issued, and the page the one the client sent.
+	timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{Limit: 1, Sort: callhome.SortCity, Cursor: plain}, mock.Anything).
+		Return(callhome.TelemetryPage{PageMetadata: callhome.PageMetadata{Cursor: plain}}, nil)
+	page, err = svc.Retrieve(ctx, "", callhome.PageMetadata{Limit: 1, Sort: callhome.SortCity, Cursor: sealed}, callhome.TelemetryFilters{})
+	assert.Nil(t, err)
+	assert.Equal(t, sealed, page.Cursor)
+
+	cases := map[string]string{
+		"unsealed cursor":  plain,
+		"malformed cursor": "invalid",
+		"truncated cursor": sealed[:len(sealed)-4],
+	}
+	for desc, cursor := range cases {
+		_, err := svc.Retrieve(ctx, "", callhome.PageMetadata{Limit: 1, Cursor: cursor}, callhome.TelemetryFilters{})
+		assert.Equal(t, callhome.ErrInvalidCursor, err, desc)
+	}
+	other := callhome.New(timescaleRepo, nil, nil, nil, nil, callhome.Config{CursorKey: "other"})
+	_, err = other.Retrieve(ctx, "", callhome.PageMetadata{Limit: 1, Sort: callhome.SortCity, Cursor: sealed}, callhome.TelemetryFilters{})
+	assert.Equal(t, callhome.ErrInvalidCursor, err)
+}
+
+func TestRetrieveChurn(t *testing.T) {
+	ctx := context.TODO()
+	timescaleRepo := repoMocks.NewTelemetryRepo(t)
+	svc := callhome.New(timescaleRepo, nil, nil, nil, nil, callhome.Config{})
+	page := callhome.TelemetryPage{Telemetry: []callhome.Telemetry{{ServiceTime: time.Now().Add(-10 * 24 * time.Hour)}}}
+	// The window bounds the latest events, which are older than StaleAfter.
+	start := time.Now()
+	from := start.Add(-14 * 24 * time.Hour)
+	silent := mock.MatchedBy(func(filters callhome.TelemetryFilters) bool {
+		seen := filters.LastSeen
+		return filters.From.IsZero() && filters.To.IsZero() && seen != nil && seen.From.Equal(from) &&
+			between(seen.To, start.Add(-7*24*time.Hour), time.Now().Add(-7*24*time.Hour))
+	})
+	timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, silent).Return(page, nil)
+
+	tp, err := svc.RetrieveChurn(ctx, "", callhome.PageMetadata{}, callhome.TelemetryFilters{From: from})
+	assert.Nil(t, err)
+	assert.Equal(t, callhome.StatusStale, tp.Telemetry[0].Status)
+
+	// A window ending earlier than StaleAfter ago bounds the range.
+	to := start.Add(-10 * 24 * time.Hour)
+	window := callhome.TimeRange{From: from, To: to}
+	timescaleRepo.On("RetrieveAll", ctx, callhome.PageMetadata{}, callhome.TelemetryFilters{LastSeen: &window}).Return(page, nil)
+	_, err = svc.RetrieveChurn(ctx, "", callhome.PageMetadata{}, callhome.TelemetryFilters{From: from, To: to})
+	assert.Nil(t, err)
+}
+
+// between reports whether t is within the inclusive range from start to end.
+func between(t, start, end time.Time) bool {
+	return !t.Before(start) && !t.After(end)
+}
+
+func TestRetrieveSummary(t *testing.T) {
+	ctx := context.TODO()
+	svc := callhome.New(repoMocks.NewTelemetryRepo(t), nil, nil, nil, nil, callhome.Config{})
+
+	_, err := svc.RetrieveSummary(ctx, "", callhome.TelemetryFilters{}, callhome.Breakdowns{callhome.BreakdownCities, callhome.BreakdownServices})
+	assert.Nil(t, err)
+	_, err = svc.RetrieveSummary(ctx, "", callhome.TelemetryFilters{}, callhome.Breakdowns{"regions"})
+	assert.Equal(t, callhome.ErrInvalidBreakdown, err)
+	_, err = svc.RetrieveSummary(ctx, "", callhome.TelemetryFilters{Status: callhome.StatusStale}, callhome.Breakdowns{callhome.BreakdownStatuses})
+	assert.Nil(t, err)
+	_, err = svc.RetrieveSummary(ctx, "", callhome.TelemetryFilters{Status: "gone"}, nil)
+	assert.Equal(t, callhome.ErrInvalidStatus, err)
+}
+
+func TestRetrieveTimeseries(t *testing.T) {
+	ctx := context.TODO()
+	svc := callhome.New(repoMocks.NewTelemetryRepo(t), nil, nil, nil, nil, callhome.Config{})
+
+	_, err := svc.RetrieveTimeseries(ctx, callhome.TelemetryFilters{}, callhome.IntervalWeek, callhome.SplitVersion)
+	assert.Nil(t, err)
+	_, err = svc.RetrieveTimeseries(ctx, callhome.TelemetryFilters{}, "fortnight", "")
+	assert.Equal(t, callhome.ErrInvalidInterval, err)
+	_, err = svc.RetrieveTimeseries(ctx, callhome.TelemetryFilters{}, callhome.IntervalDay, "city")
+	assert.Equal(t, callhome.ErrInvalidSplit, err)
+}
+
+func TestRetrieveAdoption(t *testing.T) {
+	ctx := context.TODO()
+	svc := callhome.New(repoMocks.NewTelemetryRepo(t), nil, nil, nil, nil, callhome.Config{})
+
+	_, err := svc.RetrieveAdoption(ctx, callhome.TelemetryFilters{}, callhome.IntervalMonth)
+	assert.Nil(t, err)
+	_, err = svc.RetrieveAdoption(ctx, callhome.TelemetryFilters{}, "fortnight")
+	assert.Equal(t, callhome.ErrInvalidInterval, err)
+}
+
+func TestRetrieveCohorts(t *testing.T) {
+	ctx := context.TODO()
+	svc := callhome.New(repoMocks.NewTelemetryRepo(t), nil, nil, nil, nil, callhome.Config{})
+
+	_, err := svc.RetrieveCohorts(ctx, callhome.TelemetryFilters{}, callhome.IntervalMonth)
+	assert.Nil(t, err)
+	_, err = svc.RetrieveCohorts(ctx, callhome.TelemetryFilters{}, callhome.IntervalDay)
+	assert.Equal(t, callhome.ErrInvalidPeriod, err)
+}
+
+func TestRetrieveCooccurrence(t *testing.T) {
+	ctx := context.TODO()
+	repo := repoMocks.NewTelemetryRepo(t)
+	cfg := callhome.Config{AdminKey: "admin-key"}
+	svc := callhome.New(repo, nil, nil, nil, nil, cfg)
+	repo.On("RetrieveServiceSets", ctx).Return([]callhome.DeploymentServices{
+		{IpAddress: "10.0.0.1", Services: []string{"things", "users"}},
+		{IpAddress: "10.0.0.2", Services: []string{"things", "users"}},
+		{IpAddress: "10.0.0.3", Services: []string{"users"}},
+	}, nil)
+
+	report, err := svc.RetrieveCooccurrence(ctx, "", callhome.TelemetryFilters{}, "users", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "users", report.Service)
+	assert.Equal(t, []callhome.ServiceOutlier{{Services: []string{"users"}, Missing: []string{"things"}}}, report.Outliers)
+
+	report, err = svc.RetrieveCooccurrence(ctx, cfg.AdminKey, callhome.TelemetryFilters{}, "users", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.3", report.Outliers[0].IpAddress)
+
+	_, err = svc.RetrieveCooccurrence(ctx, "invalid", callhome.TelemetryFilters{}, "users", 10)
+	assert.Equal(t, errors.ErrAuthentication, err)
 }
 
 func TestSave(t *testing.T) {
 	ctx := context.TODO()
+	anon, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyKeep})
+	assert.Nil(t, err)
 	t.Run("error obtaining location", func(t *testing.T) {
 		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		timescaleRepo.On("Blocked", ctx, mock.Anything).Return(false, nil)
+		locMock := mocks.NewLocationService(t)
+		locMock.On("GetLocation", "").Return(callhome.Location{}, fmt.Errorf("error getting loc"))
+		svc := callhome.New(timescaleRepo, locMock, nil, anon, nil, callhome.Config{})
+		err := svc.Save(ctx, callhome.Telemetry{})
+		assert.NotNil(t, err)
+	})
+	t.Run("error obtaining asn", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		timescaleRepo.On("Blocked", ctx, mock.Anything).Return(false, nil)
 		locMock := mocks.NewLocationService(t)
-		locMock.On("GetLocation", "").Return(ip2location.IP2Locationrecord{}, fmt.Errorf("error getting loc"))
-		svc := callhome.New(timescaleRepo, locMock)
+		locMock.On("GetLocation", "").Return(callhome.Location{}, nil)
+		asnMock := mocks.NewASNService(t)
+		asnMock.On("GetASN", "").Return(callhome.ASN{}, fmt.Errorf("error getting asn"))
+		svc := callhome.New(timescaleRepo, locMock, asnMock, anon, nil, callhome.Config{})
 		err := svc.Save(ctx, callhome.Telemetry{})
 		assert.NotNil(t, err)
 	})
 	t.Run("error saving to timescale", func(t *testing.T) {
 		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		timescaleRepo.On("Blocked", ctx, mock.Anything).Return(false, nil)
 		locMock := mocks.NewLocationService(t)
-		locMock.On("GetLocation", "").Return(ip2location.IP2Locationrecord{
-			Latitude:     1.2,
-			Longitude:    30,
-			Country_long: "SomeCountry",
-			City:         "someCity",
+		locMock.On("GetLocation", "").Return(callhome.Location{
+			Latitude:  1.2,
+			Longitude: 30,
+			Country:   "SomeCountry",
+			City:      "someCity",
 		}, nil)
+		asnMock := mocks.NewASNService(t)
+		asnMock.On("GetASN", "").Return(callhome.Classify(16509, "AMAZON-02"), nil)
 		timescaleRepo.On("Save", ctx, mock.AnythingOfType("callhome.Telemetry")).Return(timescale.ErrSaveEvent)
-		svc := callhome.New(timescaleRepo, locMock)
+		svc := callhome.New(timescaleRepo, locMock, asnMock, anon, nil, callhome.Config{})
 		err := svc.Save(ctx, callhome.Telemetry{})
 		assert.NotNil(t, err)
 		assert.Equal(t, timescale.ErrSaveEvent, err)
 	})
 	t.Run("successful save", func(t *testing.T) {
 		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		timescaleRepo.On("Blocked", ctx, mock.Anything).Return(false, nil)
 		locMock := mocks.NewLocationService(t)
-		locMock.On("GetLocation", "").Return(ip2location.IP2Locationrecord{
-			Latitude:     1.2,
-			Longitude:    30,
-			Country_long: "SomeCountry",
-			City:         "someCity",
+		locMock.On("GetLocation", "").Return(callhome.Location{
+			Latitude:  1.2,
+			Longitude: 30,
+			Country:   "SomeCountry",
+			City:      "someCity",
 		}, nil)
+		asnMock := mocks.NewASNService(t)
+		asnMock.On("GetASN", "").Return(callhome.Classify(16509, "AMAZON-02"), nil)
 		timescaleRepo.On("Save", ctx, mock.AnythingOfType("callhome.Telemetry")).Return(nil)
-		svc := callhome.New(timescaleRepo, locMock)
+		svc := callhome.New(timescaleRepo, locMock, asnMock, anon, nil, callhome.Config{})
 		err := svc.Save(ctx, callhome.Telemetry{})
 		assert.Nil(t, err)
 	})
 	t.Run("successful update", func(t *testing.T) {
 		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		timescaleRepo.On("Blocked", ctx, mock.Anything).Return(false, nil)
 		locMock := mocks.NewLocationService(t)
-		locMock.On("GetLocation", "").Return(ip2location.IP2Locationrecord{
-			Latitude:     1.2,
-			Longitude:    30,
-			Country_long: "SomeCountry",
-			City:         "someCity",
+		locMock.On("GetLocation", "").Return(callhome.Location{
+			Latitude:  1.2,
+			Longitude: 30,
+			Country:   "SomeCountry",
+			City:      "someCity",
 		}, nil)
+		asnMock := mocks.NewASNService(t)
+		asnMock.On("GetASN", "").Return(callhome.Classify(16509, "AMAZON-02"), nil)
 		timescaleRepo.On("Save", ctx, mock.AnythingOfType("callhome.Telemetry")).Return(nil)
-		svc := callhome.New(timescaleRepo, locMock)
+		svc := callhome.New(timescaleRepo, locMock, asnMock, anon, nil, callhome.Config{})
 		err := svc.Save(ctx, callhome.Telemetry{})
 		assert.Nil(t, err)
 	})
+	t.Run("blocklisted deployment", func(t *testing.T) {
+		timescaleRepo := repoMocks.NewTelemetryRepo(t)
+		timescaleRepo.On("Blocked", ctx, mock.Anything).Return(true, nil)
+		svc := callhome.New(timescaleRepo, nil, nil, anon, nil, callhome.Config{})
+		err := svc.Save(ctx, callhome.Telemetry{IpAddress: "41.90.185.50"})
+		assert.Nil(t, err)
+		timescaleRepo.AssertNotCalled(t, "Save", ctx, mock.Anything)
+	})
+}
+
+func TestErase(t *testing.T) {
+	ctx := context.TODO()
+	adminKey := "admin-key"
+	anon, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyKeep, Key: "secret"})
+	assert.Nil(t, err)
+	fp, err := anon.Fingerprint("41.90.185.50")
+	assert.Nil(t, err)
+
+	cases := []struct {
+		desc      string
+		token     string
+		req       callhome.ErasureRequest
+		ids       []string
+		blocklist []string
+		subject   string
+		err       error
+	}{
+		{
+			desc:  "invalid token",
+			token: "invalid",
+			req:   callhome.ErasureRequest{IpAddress: "41.90.185.50"},
+			err:   errors.ErrAuthentication,
+		},
+		{
+			desc:  "empty request",
+			token: adminKey,
+			req:   callhome.ErasureRequest{},
+			err:   errors.ErrMalformedEntity,
+		},
+		{
+			desc:    "erase ip address",
+			token:   adminKey,
+			req:     callhome.ErasureRequest{IpAddress: "41.90.185.50"},
+			ids:     []string{"41.90.185.50"},
+			subject: callhome.SubjectIPAddress,
+		},
+		{
+			desc:      "erase and blocklist ip address",
+			token:     adminKey,
+			req:       callhome.ErasureRequest{IpAddress: "41.90.185.50", Blocklist: true},
+			ids:       []string{"41.90.185.50"},
+			blocklist: []string{fp},
+			subject:   callhome.SubjectIPAddress,
+		},
+		{
+			desc:      "erase and blocklist deployment",
+			token:     adminKey,
+			req:       callhome.ErasureRequest{Deployment: "h:0123", Blocklist: true},
+			ids:       []string{"h:0123"},
+			blocklist: []string{"h:0123"},
+			subject:   callhome.SubjectDeployment,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			timescaleRepo := repoMocks.NewTelemetryRepo(t)
+			svc := callhome.New(timescaleRepo, nil, nil, anon, uuid.NewMock(), callhome.Config{AdminKey: adminKey})
+			if c.err == nil {
+				timescaleRepo.On("Erase", ctx, mock.AnythingOfType("callhome.ErasureReceipt"), c.ids, c.blocklist).
+					Return(callhome.ErasureReceipt{Subject: c.subject, RecordsRemoved: 2}, nil)
+			}
+			receipt, err := svc.Erase(ctx, c.token, c.req)
+			assert.True(t, errors.Contains(err, c.err), fmt.Sprintf("expected %v got %v", c.err, err))
+			if c.err == nil {
+				assert.Equal(t, c.subject, receipt.Subject)
+				assert.Equal(t, uint64(2), receipt.RecordsRemoved)
+			}
+		})
+	}
+
+	t.Run("blocklist ip address without privacy key", func(t *testing.T) {
+		anon, err := callhome.NewAnonymizer(callhome.PrivacyConfig{Mode: callhome.PrivacyKeep})
+		assert.Nil(t, err)
+		svc := callhome.New(repoMocks.NewTelemetryRepo(t), nil, nil, anon, uuid.NewMock(), callhome.Config{AdminKey: adminKey})
+		_, err = svc.Erase(ctx, adminKey, callhome.ErasureRequest{IpAddress: "41.90.185.50", Blocklist: true})
+		assert.True(t, errors.Contains(err, callhome.ErrMissingBlocklistKey))
+	})
 }
@@ -0,0 +1,12 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import "errors"
+
+var (
+	ErrSaveEvent     = errors.New("failed to save event to database")
+	ErrTransRollback = errors.New("failed to rollback transaction")
+	ErrEraseEvents   = errors.New("failed to erase events from database")
+)
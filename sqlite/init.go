@@ -0,0 +1,59 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import migrate "github.com/rubenv/sql-migrate"
+
+// Migration of Telemetry service. Times are stored as text in timeLayout so
+// that they compare in chronological order.
+func Migration() migrate.MemoryMigrationSource {
+	return migrate.MemoryMigrationSource{
+		Migrations: []*migrate.Migration{
+			{
+				Id: "telemetry_1",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS telemetry (
+						time			TIMESTAMP	NOT NULL,
+						service_time	TIMESTAMP,
+						ip_address		TEXT		NOT NULL,
+						longitude		REAL		NOT NULL,
+						latitude		REAL		NOT NULL,
+						mg_version		TEXT		NOT NULL DEFAULT '',
+						service			TEXT		NOT NULL DEFAULT '',
+						country			TEXT		NOT NULL DEFAULT '',
+						country_code	TEXT		NOT NULL DEFAULT '',
+						region			TEXT		NOT NULL DEFAULT '',
+						city			TEXT		NOT NULL DEFAULT '',
+						postal_code		TEXT		NOT NULL DEFAULT '',
+						timezone		TEXT		NOT NULL DEFAULT '',
+						asn				INTEGER		NOT NULL DEFAULT 0,
+						as_org			TEXT		NOT NULL DEFAULT '',
+						provider		TEXT		NOT NULL DEFAULT '',
+						network_type	TEXT		NOT NULL DEFAULT 'unknown'
+					);`,
+					`CREATE INDEX IF NOT EXISTS telemetry_ip_address_idx ON telemetry (ip_address, time DESC);`,
+					`CREATE INDEX IF NOT EXISTS telemetry_time_idx ON telemetry (time);`,
+					`CREATE TABLE IF NOT EXISTS erasures (
+						id				TEXT		PRIMARY KEY,
+						subject			TEXT		NOT NULL,
+						records_removed	INTEGER		NOT NULL,
+						blocklisted		BOOLEAN		NOT NULL,
+						reason			TEXT		NOT NULL DEFAULT '',
+						erased_at		TIMESTAMP	NOT NULL
+					);`,
+					`CREATE TABLE IF NOT EXISTS blocklist (
+						identifier		TEXT		PRIMARY KEY,
+						erasure_id		TEXT		NOT NULL REFERENCES erasures (id),
+						created_at		TIMESTAMP	NOT NULL
+					);`,
+				},
+				Down: []string{
+					`DROP TABLE IF EXISTS blocklist;`,
+					`DROP TABLE IF EXISTS erasures;`,
+					`DROP TABLE IF EXISTS telemetry;`,
+				},
+			},
+		},
+	}
+}
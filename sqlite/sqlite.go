@@ -0,0 +1,755 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sqlite contains a SQLite telemetry repository. It is meant for
+// development and tests, and matches the listing and summary semantics of the
+// TimescaleDB repository without its downsampled history.
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var _ callhome.TelemetryRepo = (*repo)(nil)
+
+// timeLayout is the representation of stored times. It has a fixed width so
+// that stored times compare in chronological order, and the driver parses it
+// back into time.Time for columns declared as TIMESTAMP.
+const timeLayout = "2006-01-02 15:04:05.000000000"
+
+// distanceExpr is the expression of the distance in kilometres between the given
+// coordinate columns and the point given by :lat and :lon. The function is
+// registered by the driver.
+const distanceExpr = "callhome_distance(:lat, :lon, %s, %s)"
+
+var sortColumns = map[string]string{
+	"":                     "d.ip_address",
+	callhome.SortLastSeen:  "t.time",
+	callhome.SortFirstSeen: "d.first_seen",
+	callhome.SortCountry:   "t.country",
+	callhome.SortCity:      "t.city",
+	callhome.SortVersion:   "t.mg_version",
+	callhome.SortServices:  "d.service_count",
+	callhome.SortDistance:  fmt.Sprintf(distanceExpr, "t.latitude", "t.longitude"),
+}
+
+// bucketExprs map the intervals of a time series onto the expression of the
+// start of the bucket of an event, formatted as time.DateTime. Weeks start on
+// Monday. Colons are doubled so that they aren't read as named parameters.
+var bucketExprs = map[string]string{
+	callhome.IntervalHour:  "strftime('%Y-%m-%d %H::00::00', time)",
+	callhome.IntervalDay:   "strftime('%Y-%m-%d 00::00::00', time)",
+	callhome.IntervalWeek:  "strftime('%Y-%m-%d 00::00::00', time, 'weekday 0', '-6 days')",
+	callhome.IntervalMonth: "strftime('%Y-%m-01 00::00::00', time)",
+}
+
+// splitColumns map the dimensions of a time series split onto their columns.
+var splitColumns = map[string]string{
+	"":                    "''",
+	callhome.SplitCountry: "country",
+	callhome.SplitVersion: "mg_version",
+	callhome.SplitService: "service",
+}
+
+type repo struct {
+	db *sqlx.DB
+}
+
+// New returns new SQLite telemetry repository.
+func New(db *sqlx.DB) callhome.TelemetryRepo {
+	return &repo{db: db}
+}
+
+// deployment is a row of the telemetry listing together with the columns
+// it can be sorted by.
+type deployment struct {
+	callhome.Telemetry
+	ServiceList string  `db:"service_list"`
+	FirstSeen   string  `db:"first_seen"`
+	Distance    float64 `db:"distance"`
+}
+
+// key returns the value of the sort column of the deployment as stored in a cursor.
+func (d deployment) key(sort string) string {
+	switch sort {
+	case callhome.SortLastSeen:
+		return d.ServiceTime.Format(time.RFC3339Nano)
+	case callhome.SortFirstSeen:
+		firstSeen, _ := time.ParseInLocation(timeLayout, d.FirstSeen, time.UTC)
+		return firstSeen.Format(time.RFC3339Nano)
+	case callhome.SortCountry:
+		return d.Country
+	case callhome.SortCity:
+		return d.City
+	case callhome.SortVersion:
+		return d.Version
+	case callhome.SortServices:
+		return strconv.Itoa(len(d.Services))
+	case callhome.SortDistance:
+		return strconv.FormatFloat(d.Distance, 'g', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// cursorKey converts the key of a cursor to the value stored in the sort column.
+func cursorKey(sort, key string) (interface{}, error) {
+	var (
+		val interface{}
+		err error
+	)
+	switch sort {
+	case callhome.SortLastSeen, callhome.SortFirstSeen:
+		var t time.Time
+		t, err = time.Parse(time.RFC3339Nano, key)
+		val = formatTime(t)
+	case callhome.SortServices:
+		val, err = strconv.Atoi(key)
+	case callhome.SortDistance:
+		val, err = strconv.ParseFloat(key, 64)
+	default:
+		val = key
+	}
+	if err != nil {
+		return nil, callhome.ErrInvalidCursor
+	}
+	return val, nil
+}
+
+// RetrieveAll gets all records from repo.
+func (r repo) RetrieveAll(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	q := `
+	SELECT d.ip_address, d.service_list, d.first_seen, t.time, t.service_time, t.longitude, t.latitude, t.mg_version, t.country, t.country_code, t.region, t.city, t.postal_code, t.timezone,
+		t.asn, t.as_org, t.provider, t.network_type%s
+	FROM (
+		SELECT ip_address, json_group_array(DISTINCT service) AS service_list,
+			MIN(time) AS first_seen, COUNT(DISTINCT service) AS service_count
+		FROM telemetry
+		%s
+		GROUP BY ip_address
+	) d
+	INNER JOIN telemetry t ON t.rowid = (
+		SELECT rowid
+		FROM telemetry
+		WHERE ip_address = d.ip_address
+		ORDER BY time DESC
+		LIMIT 1
+	)
+	%s
+	ORDER BY %s
+	LIMIT :limit OFFSET :offset;
+	`
+	if err := callhome.ValidateSort(pm.Sort, pm.Dir); err != nil {
+		return callhome.TelemetryPage{}, err
+	}
+	if pm.Sort == callhome.SortDistance && filters.Radius == nil {
+		return callhome.TelemetryPage{}, callhome.ErrInvalidSort
+	}
+	col := sortColumns[pm.Sort]
+	var distance string
+	if pm.Sort == callhome.SortDistance {
+		distance = fmt.Sprintf(", %s AS distance", col)
+	}
+	dir, cmp := "ASC", ">"
+	if pm.Dir == callhome.DirDesc {
+		dir, cmp = "DESC", "<"
+	}
+	// The IP address breaks ties, so that the order is stable.
+	order := fmt.Sprintf("d.ip_address %s", dir)
+	if pm.Sort != "" {
+		order = fmt.Sprintf("%s %s, %s", col, dir, order)
+	}
+
+	filterQuery, params := generateQuery(filters)
+
+	var cursorQuery string
+	if pm.Cursor != "" {
+		cursor, err := callhome.DecodeCursor(pm.Cursor)
+		if err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+		if !cursor.Matches(pm.Sort, pm.Dir) {
+			return callhome.TelemetryPage{}, callhome.ErrInvalidCursor
+		}
+		cursorQuery = fmt.Sprintf("WHERE d.ip_address %s :cursor", cmp)
+		if pm.Sort != "" {
+			key, err := cursorKey(pm.Sort, cursor.Key)
+			if err != nil {
+				return callhome.TelemetryPage{}, err
+			}
+			cursorQuery = fmt.Sprintf("WHERE (%s, d.ip_address) %s (:cursor_key, :cursor)", col, cmp)
+			params["cursor_key"] = key
+		}
+		params["cursor"] = cursor.IpAddress
+	}
+
+	q = fmt.Sprintf(q, distance, filterQuery, cursorQuery, order)
+
+	// One extra row tells whether there is a next page.
+	params["limit"] = pm.Limit + 1
+	params["offset"] = pm.Offset
+
+	var deps []deployment
+	if err := r.selectNamed(ctx, &deps, q, params); err != nil {
+		return callhome.TelemetryPage{}, err
+	}
+
+	results := callhome.TelemetryPage{
+		PageMetadata: callhome.PageMetadata{
+			Offset:    pm.Offset,
+			Limit:     pm.Limit,
+			Cursor:    pm.Cursor,
+			SkipTotal: pm.SkipTotal,
+			Sort:      pm.Sort,
+			Dir:       pm.Dir,
+		},
+	}
+	for i := range deps {
+		if uint64(i) == pm.Limit {
+			if pm.Limit > 0 {
+				last := deps[i-1]
+				results.NextCursor = callhome.Cursor{Sort: pm.Sort, Dir: pm.Dir, Key: last.key(pm.Sort), IpAddress: last.IpAddress}.Encode()
+			}
+			break
+		}
+		d := &deps[i]
+		if err := json.Unmarshal([]byte(d.ServiceList), &d.Services); err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+		slices.Sort(d.Services)
+		results.Telemetry = append(results.Telemetry, d.Telemetry)
+	}
+
+	if pm.SkipTotal {
+		return results, nil
+	}
+
+	q = fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) FROM telemetry %s;`, filterQuery)
+	if err := r.getNamed(ctx, &results.Total, q, params); err != nil {
+		return callhome.TelemetryPage{}, err
+	}
+
+	return results, nil
+}
+
+// selectNamed runs the named query and scans all rows into dest. Rows are
+// closed before returning, which the single connection requires.
+func (r repo) selectNamed(ctx context.Context, dest interface{}, q string, params map[string]interface{}) error {
+	q, args, err := r.db.BindNamed(q, params)
+	if err != nil {
+		return err
+	}
+	return r.db.SelectContext(ctx, dest, q, args...)
+}
+
+// getNamed runs the named query and scans its single row into dest.
+func (r repo) getNamed(ctx context.Context, dest interface{}, q string, params map[string]interface{}) error {
+	q, args, err := r.db.BindNamed(q, params)
+	if err != nil {
+		return err
+	}
+	return r.db.GetContext(ctx, dest, q, args...)
+}
+
+// Save creates record in repo.
+func (r repo) Save(ctx context.Context, t callhome.Telemetry) error {
+	q := `INSERT INTO telemetry (ip_address, longitude, latitude,
+		mg_version, service, time, country, country_code, region, city,
+		postal_code, timezone, asn, as_org, provider, network_type, service_time)
+		VALUES (:ip_address, :longitude, :latitude,
+			:mg_version, :service, :time, :country, :country_code, :region, :city,
+			:postal_code, :timezone, :asn, :as_org, :provider, :network_type, :service_time);`
+	params := map[string]interface{}{
+		"ip_address":   t.IpAddress,
+		"longitude":    t.Longitude,
+		"latitude":     t.Latitude,
+		"mg_version":   t.Version,
+		"service":      t.Service,
+		"time":         formatTime(t.ServiceTime),
+		"country":      t.Country,
+		"country_code": t.CountryCode,
+		"region":       t.Region,
+		"city":         t.City,
+		"postal_code":  t.PostalCode,
+		"timezone":     t.Timezone,
+		"asn":          t.ASN,
+		"as_org":       t.ASOrg,
+		"provider":     t.Provider,
+		"network_type": t.NetworkType,
+		"service_time": formatTime(t.LastSeen),
+	}
+	if _, err := r.db.NamedExecContext(ctx, q, params); err != nil {
+		return errors.Wrap(ErrSaveEvent, err.Error())
+	}
+	return nil
+}
+
+// Erase removes records stored under the identifiers and records the erasure.
+func (r repo) Erase(ctx context.Context, receipt callhome.ErasureReceipt, identifiers, blocklist []string) (ret callhome.ErasureReceipt, err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
+	}
+	defer func() {
+		if err != nil {
+			if txErr := tx.Rollback(); txErr != nil {
+				err = errors.Wrap(err, errors.Wrap(ErrTransRollback, txErr.Error()).Error())
+			}
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			err = errors.Wrap(ErrEraseEvents, err.Error())
+		}
+	}()
+
+	params := make(map[string]interface{})
+	q := fmt.Sprintf(`DELETE FROM telemetry WHERE ip_address IN (%s);`, bindValues(params, "identifier", identifiers))
+	res, err := tx.NamedExecContext(ctx, q, params)
+	if err != nil {
+		return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
+	}
+	receipt.RecordsRemoved = uint64(removed)
+
+	q = `INSERT INTO erasures (id, subject, records_removed, blocklisted, reason, erased_at)
+		VALUES (:id, :subject, :records_removed, :blocklisted, :reason, :erased_at);`
+	params = map[string]interface{}{
+		"id":              receipt.ID,
+		"subject":         receipt.Subject,
+		"records_removed": receipt.RecordsRemoved,
+		"blocklisted":     receipt.Blocklisted,
+		"reason":          receipt.Reason,
+		"erased_at":       formatTime(receipt.ErasedAt),
+	}
+	if _, err = tx.NamedExecContext(ctx, q, params); err != nil {
+		return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
+	}
+
+	q = `INSERT INTO blocklist (identifier, erasure_id, created_at)
+		VALUES (:identifier, :erasure_id, :created_at)
+		ON CONFLICT (identifier) DO NOTHING;`
+	for _, id := range blocklist {
+		entry := map[string]interface{}{
+			"identifier": id,
+			"erasure_id": receipt.ID,
+			"created_at": formatTime(receipt.ErasedAt),
+		}
+		if _, err = tx.NamedExecContext(ctx, q, entry); err != nil {
+			return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
+		}
+	}
+
+	return receipt, nil
+}
+
+// Blocked reports whether any of the identifiers is blocklisted.
+func (r repo) Blocked(ctx context.Context, identifiers ...string) (bool, error) {
+	params := make(map[string]interface{})
+	q := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM blocklist WHERE identifier IN (%s));`, bindValues(params, "identifier", identifiers))
+
+	var blocked bool
+	if err := r.getNamed(ctx, &blocked, q, params); err != nil {
+		return false, err
+	}
+	return blocked, nil
+}
+
+// RetrieveSummary retrieve distinct.
+func (r repo) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns, status callhome.StatusConfig, now time.Time) (callhome.TelemetrySummary, error) {
+	filterQuery, params := generateQuery(filters)
+
+	var summary callhome.TelemetrySummary
+	q := fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) FROM telemetry %s;`, filterQuery)
+	if err := r.getNamed(ctx, &summary.TotalDeployments, q, params); err != nil {
+		return callhome.TelemetrySummary{}, err
+	}
+
+	if breakdowns.Includes(callhome.BreakdownCountries) {
+		q := fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) AS count, country FROM telemetry %s
+			GROUP BY country ORDER BY count DESC, country;`, filterQuery)
+		if err := r.selectNamed(ctx, &summary.Countries, q, params); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+	}
+
+	if breakdowns.Includes(callhome.BreakdownCities) {
+		q := fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) AS count, country, city FROM telemetry %s
+			GROUP BY country, city ORDER BY count DESC, country, city;`, filterQuery)
+		if err := r.selectNamed(ctx, &summary.Cities, q, params); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+	}
+
+	if breakdowns.Includes(callhome.BreakdownServices) {
+		q := fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) AS count, service FROM telemetry %s
+			GROUP BY service ORDER BY count DESC, service;`, filterQuery)
+		if err := r.selectNamed(ctx, &summary.Services, q, params); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+	}
+
+	if breakdowns.Includes(callhome.BreakdownVersions) {
+		q := fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) AS count, mg_version FROM telemetry %s
+			GROUP BY mg_version ORDER BY count DESC, mg_version;`, filterQuery)
+		if err := r.selectNamed(ctx, &summary.Versions, q, params); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+	}
+
+	if breakdowns.Includes(callhome.BreakdownProviders) {
+		q := fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) AS count, network_type, provider FROM telemetry %s
+			GROUP BY network_type, provider ORDER BY count DESC, network_type, provider;`, filterQuery)
+		if err := r.selectNamed(ctx, &summary.Providers, q, params); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+	}
+
+	if breakdowns.Includes(callhome.BreakdownStatuses) {
+		statuses, err := r.retrieveStatuses(ctx, filters, status, now)
+		if err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+		summary.Statuses = statuses
+	}
+
+	return summary, nil
+}
+
+// RetrieveTimeseries counts the deployments with events matching the filters
+// in every bucket of the interval.
+func (r repo) RetrieveTimeseries(ctx context.Context, filters callhome.TelemetryFilters, interval, split string) ([]callhome.TimeseriesPoint, error) {
+	if err := callhome.ValidateTimeseries(interval, split); err != nil {
+		return nil, err
+	}
+	filterQuery, params := generateQuery(filters)
+
+	q := fmt.Sprintf(`SELECT %s AS bucket, %s AS value, COUNT(DISTINCT ip_address) AS count
+		FROM telemetry %s GROUP BY 1, 2 ORDER BY 1, 2;`, bucketExprs[interval], splitColumns[split], filterQuery)
+	var rows []struct {
+		Bucket string `db:"bucket"`
+		Value  string `db:"value"`
+		Count  int    `db:"count"`
+	}
+	if err := r.selectNamed(ctx, &rows, q, params); err != nil {
+		return nil, err
+	}
+
+	var points []callhome.TimeseriesPoint
+	for _, row := range rows {
+		bucket, err := time.ParseInLocation(time.DateTime, row.Bucket, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, callhome.TimeseriesPoint{Time: bucket, Value: row.Value, NoDeployments: row.Count})
+	}
+	return points, nil
+}
+
+// RetrieveTransitions reports the version upgrades of the services of
+// deployments, from consecutive events of a service with a newer version.
+// Versions are compared with callhome.IsUpgrade once read.
+func (r repo) RetrieveTransitions(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TransitionReport, error) {
+	// Earlier versions are looked up before the window.
+	events := filters
+	events.From = time.Time{}
+	filterQuery, params := generateQuery(events)
+
+	window := ""
+	if !filters.From.IsZero() {
+		window = "AND e.time >= :from"
+		params["from"] = formatTime(filters.From)
+	}
+	// Times are cast to text so that they're scanned in the stored layout.
+	q := fmt.Sprintf(`WITH events AS (
+			SELECT ip_address, time, mg_version,
+				LAG(mg_version) OVER (PARTITION BY ip_address, service ORDER BY time) AS previous
+			FROM telemetry %s
+		), releases AS (
+			SELECT mg_version, MIN(time) AS released FROM telemetry GROUP BY mg_version
+		)
+		SELECT e.ip_address, e.previous, e.mg_version, CAST(e.time AS TEXT) AS time, CAST(r.released AS TEXT) AS released
+		FROM events e JOIN releases r ON r.mg_version = e.mg_version
+		WHERE e.previous <> e.mg_version %s;`, filterQuery, window)
+	var rows []struct {
+		IpAddress string `db:"ip_address"`
+		Previous  string `db:"previous"`
+		Version   string `db:"mg_version"`
+		Time      string `db:"time"`
+		Released  string `db:"released"`
+	}
+	if err := r.selectNamed(ctx, &rows, q, params); err != nil {
+		return callhome.TransitionReport{}, err
+	}
+
+	upgrades := make([]callhome.Upgrade, 0, len(rows))
+	for _, row := range rows {
+		if !callhome.IsUpgrade(row.Previous, row.Version) {
+			continue
+		}
+		at, err := time.ParseInLocation(timeLayout, row.Time, time.UTC)
+		if err != nil {
+			return callhome.TransitionReport{}, err
+		}
+		released, err := time.ParseInLocation(timeLayout, row.Released, time.UTC)
+		if err != nil {
+			return callhome.TransitionReport{}, err
+		}
+		upgrades = append(upgrades, callhome.Upgrade{
+			IpAddress: row.IpAddress,
+			From:      row.Previous,
+			To:        row.Version,
+			Adoption:  at.Sub(released),
+		})
+	}
+	return callhome.SummarizeUpgrades(upgrades), nil
+}
+
+// RetrieveCohorts groups deployments by the period they were first seen in.
+func (r repo) RetrieveCohorts(ctx context.Context, filters callhome.TelemetryFilters, period string) ([]callhome.Cohort, error) {
+	if err := callhome.ValidateCohortPeriod(period); err != nil {
+		return nil, err
+	}
+	// Deployments first seen before the window are left out rather than
+	// assigned to a later cohort.
+	events := filters
+	events.From = time.Time{}
+	filterQuery, params := generateQuery(events)
+
+	having := ""
+	if !filters.From.IsZero() {
+		having = "HAVING MIN(first_time) >= :from"
+		params["from"] = formatTime(filters.From)
+	}
+	q := fmt.Sprintf(`WITH events AS (
+			SELECT ip_address, %s AS period, MIN(time) AS first_time FROM telemetry %s GROUP BY 1, 2
+		), cohorts AS (
+			SELECT ip_address, MIN(period) AS cohort FROM events GROUP BY ip_address %s
+		)
+		SELECT c.cohort, e.period, COUNT(*) AS count
+		FROM cohorts c JOIN events e ON e.ip_address = c.ip_address
+		GROUP BY 1, 2 ORDER BY 1, 2;`, bucketExprs[period], filterQuery, having)
+	var rows []struct {
+		Cohort string `db:"cohort"`
+		Period string `db:"period"`
+		Count  int    `db:"count"`
+	}
+	if err := r.selectNamed(ctx, &rows, q, params); err != nil {
+		return nil, err
+	}
+
+	activity := make([]callhome.CohortActivity, 0, len(rows))
+	for _, row := range rows {
+		cohort, err := time.ParseInLocation(time.DateTime, row.Cohort, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+		period, err := time.ParseInLocation(time.DateTime, row.Period, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+		activity = append(activity, callhome.CohortActivity{Cohort: cohort, Period: period, NoDeployments: row.Count})
+	}
+	return callhome.BuildCohorts(activity, period, filters.To), nil
+}
+
+// retrieveStatuses counts the deployments by the latest of all their events.
+func (r repo) retrieveStatuses(ctx context.Context, filters callhome.TelemetryFilters, cfg callhome.StatusConfig, now time.Time) ([]callhome.StatusSummary, error) {
+	filterQuery, params := generateQuery(filters)
+	params["stale"] = formatTime(now.Add(-cfg.StaleAfter))
+	params["dormant"] = formatTime(now.Add(-cfg.DormantAfter))
+	params["churned"] = formatTime(now.Add(-cfg.ChurnedAfter))
+
+	q := fmt.Sprintf(`WITH matching AS (
+			SELECT DISTINCT ip_address FROM telemetry %s
+		), last_seen AS (
+			SELECT t.ip_address, MAX(t.time) AS time
+			FROM telemetry t JOIN matching m ON m.ip_address = t.ip_address
+			GROUP BY t.ip_address
+		)
+		SELECT CASE
+			WHEN time >= :stale THEN '%s'
+			WHEN time >= :dormant THEN '%s'
+			WHEN time >= :churned THEN '%s'
+			ELSE '%s'
+		END AS status, COUNT(*) AS count
+		FROM last_seen
+		GROUP BY 1 ORDER BY count DESC, status;`, filterQuery,
+		callhome.StatusActive, callhome.StatusStale, callhome.StatusDormant, callhome.StatusChurned)
+
+	var statuses []callhome.StatusSummary
+	if err := r.selectNamed(ctx, &statuses, q, params); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// RetrieveServiceSets lists the services of every deployment.
+func (r repo) RetrieveServiceSets(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.DeploymentServices, error) {
+	filterQuery, params := generateQuery(filters)
+	q := fmt.Sprintf(`SELECT ip_address, json_group_array(DISTINCT service) AS service_list
+		FROM telemetry %s
+		GROUP BY ip_address ORDER BY ip_address;`, filterQuery)
+	var rows []struct {
+		IpAddress   string `db:"ip_address"`
+		ServiceList string `db:"service_list"`
+	}
+	if err := r.selectNamed(ctx, &rows, q, params); err != nil {
+		return nil, err
+	}
+
+	var sets []callhome.DeploymentServices
+	for _, row := range rows {
+		d := callhome.DeploymentServices{IpAddress: row.IpAddress}
+		if err := json.Unmarshal([]byte(row.ServiceList), &d.Services); err != nil {
+			return nil, err
+		}
+		slices.Sort(d.Services)
+		sets = append(sets, d)
+	}
+	return sets, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func generateQuery(filters callhome.TelemetryFilters) (string, map[string]interface{}) {
+	var queries []string
+	params := make(map[string]interface{})
+
+	if !filters.From.IsZero() {
+		queries = append(queries, "time >= :from")
+		params["from"] = formatTime(filters.From)
+	}
+	if !filters.To.IsZero() {
+		queries = append(queries, "time <= :to")
+		params["to"] = formatTime(filters.To)
+	}
+	queries = appendFilter(queries, params, "country", "country", filters.Country, false)
+	queries = appendFilter(queries, params, "city", "city", filters.City, false)
+	queries = appendFilter(queries, params, "mg_version", "version", filters.Version, true)
+	queries = appendFilter(queries, params, "service", "service", filters.Service, false)
+	queries = appendFilter(queries, params, "provider", "provider", filters.Provider, false)
+	queries = appendFilter(queries, params, "network_type", "network_type", filters.NetworkType, false)
+
+	if bb := filters.BoundingBox; bb != nil {
+		queries = append(queries, "latitude BETWEEN :min_lat AND :max_lat")
+		lon := "longitude BETWEEN :min_lon AND :max_lon"
+		if bb.MinLon > bb.MaxLon {
+			lon = "(longitude >= :min_lon OR longitude <= :max_lon)"
+		}
+		queries = append(queries, lon)
+		params["min_lat"] = bb.MinLat
+		params["max_lat"] = bb.MaxLat
+		params["min_lon"] = bb.MinLon
+		params["max_lon"] = bb.MaxLon
+	}
+	if rd := filters.Radius; rd != nil {
+		queries = append(queries, fmt.Sprintf(distanceExpr, "latitude", "longitude")+" <= :distance")
+		params["lat"] = rd.Lat
+		params["lon"] = rd.Lon
+		params["distance"] = rd.Distance
+	}
+	if ls := filters.LastSeen; ls != nil {
+		queries = appendLastSeen(queries, params, *ls)
+	}
+
+	switch len(queries) {
+	case 0:
+		return "", params
+	default:
+		return fmt.Sprintf("WHERE %s", strings.Join(queries, " AND ")), params
+	}
+}
+
+// appendLastSeen appends the condition on the latest events of deployments to
+// queries.
+func appendLastSeen(queries []string, params map[string]interface{}, ls callhome.TimeRange) []string {
+	var conds []string
+	if !ls.From.IsZero() {
+		conds = append(conds, "MAX(time) >= :last_seen_from")
+		params["last_seen_from"] = formatTime(ls.From)
+	}
+	if !ls.To.IsZero() {
+		conds = append(conds, "MAX(time) < :last_seen_to")
+		params["last_seen_to"] = formatTime(ls.To)
+	}
+	if len(conds) == 0 {
+		return queries
+	}
+	return append(queries, fmt.Sprintf("ip_address IN (SELECT ip_address FROM telemetry GROUP BY ip_address HAVING %s)", strings.Join(conds, " AND ")))
+}
+
+// appendFilter appends the conditions of the filter on the column to queries.
+// SQLite has no arrays, so every value is passed as its own named parameter,
+// prefixed with name. Values ending in the wildcard are matched by prefix
+// when prefix is set.
+func appendFilter(queries []string, params map[string]interface{}, col, name string, f callhome.Filter, prefix bool) []string {
+	values, prefixes := splitPrefixes(f.Values, prefix)
+	var matches []string
+	if len(values) > 0 {
+		matches = append(matches, fmt.Sprintf("%s IN (%s)", col, bindValues(params, name, values)))
+	}
+	for i, p := range prefixes {
+		key := fmt.Sprintf("%s_prefix_%d", name, i)
+		matches = append(matches, fmt.Sprintf("substr(%s, 1, length(:%s)) = :%[2]s", col, key))
+		params[key] = p
+	}
+	switch len(matches) {
+	case 0:
+	case 1:
+		queries = append(queries, matches[0])
+	default:
+		queries = append(queries, fmt.Sprintf("(%s)", strings.Join(matches, " OR ")))
+	}
+
+	values, prefixes = splitPrefixes(f.Excluded, prefix)
+	if len(values) > 0 {
+		queries = append(queries, fmt.Sprintf("%s NOT IN (%s)", col, bindValues(params, "not_"+name, values)))
+	}
+	for i, p := range prefixes {
+		key := fmt.Sprintf("not_%s_prefix_%d", name, i)
+		queries = append(queries, fmt.Sprintf("substr(%s, 1, length(:%s)) <> :%[2]s", col, key))
+		params[key] = p
+	}
+	return queries
+}
+
+// bindValues adds the values to params and returns the list of their names.
+func bindValues(params map[string]interface{}, name string, values []string) string {
+	names := make([]string, len(values))
+	for i, val := range values {
+		key := fmt.Sprintf("%s_%d", name, i)
+		params[key] = val
+		names[i] = ":" + key
+	}
+	return strings.Join(names, ", ")
+}
+
+// splitPrefixes separates exact values from prefixes, which are returned
+// without the wildcard.
+func splitPrefixes(vals []string, prefix bool) ([]string, []string) {
+	var values, prefixes []string
+	for _, val := range vals {
+		if prefix && strings.HasSuffix(val, callhome.Wildcard) {
+			prefixes = append(prefixes, strings.TrimSuffix(val, callhome.Wildcard))
+			continue
+		}
+		values = append(values, val)
+	}
+	return values, prefixes
+}
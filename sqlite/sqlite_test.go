@@ -0,0 +1,23 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite_test
+
+import (
+	"testing"
+
+	"github.com/absmach/callhome"
+	sqliteClient "github.com/absmach/callhome/internal/clients/sqlite"
+	"github.com/absmach/callhome/repotest"
+	"github.com/absmach/callhome/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) callhome.TelemetryRepo {
+		db, err := sqliteClient.SetupDB(sqliteClient.Config{Path: ":memory:"}, sqlite.Migration())
+		require.Nil(t, err)
+		t.Cleanup(func() { db.Close() })
+		return sqlite.New(db)
+	})
+}
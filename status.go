@@ -0,0 +1,147 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"time"
+)
+
+// Statuses of deployments by the age of their latest report.
+const (
+	StatusActive  = "active"
+	StatusStale   = "stale"
+	StatusDormant = "dormant"
+	StatusChurned = "churned"
+)
+
+// Default ages of the latest report past which deployments change status.
+const (
+	defStaleAfter   = 7 * 24 * time.Hour
+	defDormantAfter = 30 * 24 * time.Hour
+	defChurnedAfter = 60 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidStatus indicates an unknown deployment status.
+	ErrInvalidStatus = errors.New("invalid deployment status")
+	// ErrInvalidStatusConfig indicates status thresholds that aren't
+	// positive and increasing.
+	ErrInvalidStatusConfig = errors.New("invalid deployment status thresholds")
+	// ErrChurnBeyondRetention indicates a churn threshold past the
+	// retention of raw telemetry, which deployments are last seen in.
+	ErrChurnBeyondRetention = errors.New("deployment churn threshold exceeds the telemetry retention")
+)
+
+// StatusSummary counts the deployments of a status.
+type StatusSummary struct {
+	Status        string `json:"status" db:"status"`
+	NoDeployments int    `json:"number_of_deployments" db:"count"`
+}
+
+// StatusConfig defines the ages of the latest report of a deployment past
+// which it is stale, dormant and churned. Deployments that reported more
+// recently are active.
+type StatusConfig struct {
+	StaleAfter   time.Duration
+	DormantAfter time.Duration
+	ChurnedAfter time.Duration
+}
+
+// Validate checks that the thresholds are positive and increasing.
+func (sc StatusConfig) Validate() error {
+	if sc.StaleAfter <= 0 || sc.DormantAfter <= sc.StaleAfter || sc.ChurnedAfter <= sc.DormantAfter {
+		return ErrInvalidStatusConfig
+	}
+	return nil
+}
+
+// ValidateRetention checks that deployments churn before their latest
+// reports are dropped with the raw telemetry kept for the retention.
+// Deployments silent for longer are no longer seen at all.
+func (sc StatusConfig) ValidateRetention(retention time.Duration) error {
+	if retention > 0 && sc.ChurnedAfter >= retention {
+		return ErrChurnBeyondRetention
+	}
+	return nil
+}
+
+// withDefaults returns the configuration with the defaults in place of
+// unset thresholds.
+func (sc StatusConfig) withDefaults() StatusConfig {
+	if sc.StaleAfter == 0 {
+		sc.StaleAfter = defStaleAfter
+	}
+	if sc.DormantAfter == 0 {
+		sc.DormantAfter = defDormantAfter
+	}
+	if sc.ChurnedAfter == 0 {
+		sc.ChurnedAfter = defChurnedAfter
+	}
+	return sc
+}
+
+// Classify returns the status at now of a deployment last seen at lastSeen.
+func (sc StatusConfig) Classify(lastSeen, now time.Time) string {
+	age := now.Sub(lastSeen)
+	switch {
+	case age <= sc.StaleAfter:
+		return StatusActive
+	case age <= sc.DormantAfter:
+		return StatusStale
+	case age <= sc.ChurnedAfter:
+		return StatusDormant
+	default:
+		return StatusChurned
+	}
+}
+
+// LastSeen returns the range of the latest reports of the deployments having
+// the status at now.
+func (sc StatusConfig) LastSeen(status string, now time.Time) TimeRange {
+	switch status {
+	case StatusActive:
+		return TimeRange{From: now.Add(-sc.StaleAfter)}
+	case StatusStale:
+		return TimeRange{From: now.Add(-sc.DormantAfter), To: now.Add(-sc.StaleAfter)}
+	case StatusDormant:
+		return TimeRange{From: now.Add(-sc.ChurnedAfter), To: now.Add(-sc.DormantAfter)}
+	default:
+		return TimeRange{To: now.Add(-sc.ChurnedAfter)}
+	}
+}
+
+// ValidateStatus checks the status against the known statuses. An empty
+// status selects deployments of any status.
+func ValidateStatus(status string) error {
+	switch status {
+	case "", StatusActive, StatusStale, StatusDormant, StatusChurned:
+		return nil
+	default:
+		return ErrInvalidStatus
+	}
+}
+
+// TimeRange is the range of times from From, inclusive, to To, exclusive.
+// A zero bound leaves the range open on its side.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains reports whether t is within the range.
+func (tr TimeRange) Contains(t time.Time) bool {
+	return (tr.From.IsZero() || !t.Before(tr.From)) && (tr.To.IsZero() || t.Before(tr.To))
+}
+
+// Intersect returns the range of the times within both ranges.
+func (tr TimeRange) Intersect(other TimeRange) TimeRange {
+	if tr.From.IsZero() || other.From.After(tr.From) {
+		tr.From = other.From
+	}
+	if tr.To.IsZero() || (!other.To.IsZero() && other.To.Before(tr.To)) {
+		tr.To = other.To
+	}
+	return tr
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+var statusCfg = callhome.StatusConfig{StaleAfter: 7 * 24 * time.Hour, DormantAfter: 30 * 24 * time.Hour, ChurnedAfter: 60 * 24 * time.Hour}
+
+func TestStatusConfigValidate(t *testing.T) {
+	assert.Nil(t, statusCfg.Validate())
+	assert.Equal(t, callhome.ErrInvalidStatusConfig, callhome.StatusConfig{}.Validate())
+	assert.Equal(t, callhome.ErrInvalidStatusConfig, callhome.StatusConfig{StaleAfter: time.Hour, DormantAfter: time.Hour, ChurnedAfter: 2 * time.Hour}.Validate())
+	assert.Equal(t, callhome.ErrInvalidStatusConfig, callhome.StatusConfig{StaleAfter: time.Hour, DormantAfter: 3 * time.Hour, ChurnedAfter: 2 * time.Hour}.Validate())
+}
+
+func TestStatusConfigValidateRetention(t *testing.T) {
+	assert.Nil(t, statusCfg.ValidateRetention(90*24*time.Hour))
+	assert.Nil(t, statusCfg.ValidateRetention(0))
+	assert.Equal(t, callhome.ErrChurnBeyondRetention, statusCfg.ValidateRetention(60*24*time.Hour))
+	assert.Equal(t, callhome.ErrChurnBeyondRetention, statusCfg.ValidateRetention(30*24*time.Hour))
+}
+
+func TestClassifyStatus(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		age    time.Duration
+		status string
+	}{
+		{0, callhome.StatusActive},
+		{7 * 24 * time.Hour, callhome.StatusActive},
+		{7*24*time.Hour + time.Second, callhome.StatusStale},
+		{30 * 24 * time.Hour, callhome.StatusStale},
+		{45 * 24 * time.Hour, callhome.StatusDormant},
+		{60*24*time.Hour + time.Second, callhome.StatusChurned},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.status, statusCfg.Classify(now.Add(-tc.age), now), tc.age.String())
+	}
+}
+
+func TestStatusLastSeen(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, status := range []string{callhome.StatusActive, callhome.StatusStale, callhome.StatusDormant, callhome.StatusChurned} {
+		// The range of a status holds the deployments it classifies, up to
+		// the thresholds themselves.
+		ls := statusCfg.LastSeen(status, now)
+		for _, age := range []time.Duration{time.Hour, 10 * 24 * time.Hour, 45 * 24 * time.Hour, 90 * 24 * time.Hour} {
+			seen := now.Add(-age)
+			assert.Equal(t, statusCfg.Classify(seen, now) == status, ls.Contains(seen), status+" "+age.String())
+		}
+	}
+}
+
+func TestValidateStatus(t *testing.T) {
+	assert.Nil(t, callhome.ValidateStatus(""))
+	assert.Nil(t, callhome.ValidateStatus(callhome.StatusDormant))
+	assert.Equal(t, callhome.ErrInvalidStatus, callhome.ValidateStatus("gone"))
+}
+
+func TestTimeRange(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tr := callhome.TimeRange{From: day, To: day.Add(24 * time.Hour)}
+	assert.True(t, tr.Contains(day))
+	assert.False(t, tr.Contains(day.Add(24*time.Hour)))
+	assert.True(t, callhome.TimeRange{}.Contains(day))
+
+	assert.Equal(t, callhome.TimeRange{From: day.Add(time.Hour), To: day.Add(24 * time.Hour)}, tr.Intersect(callhome.TimeRange{From: day.Add(time.Hour)}))
+	assert.Equal(t, callhome.TimeRange{From: day, To: day.Add(time.Hour)}, tr.Intersect(callhome.TimeRange{From: day.Add(-time.Hour), To: day.Add(time.Hour)}))
+	assert.Equal(t, tr, callhome.TimeRange{}.Intersect(tr))
+}
@@ -5,6 +5,10 @@ package callhome
 
 import (
 	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -19,23 +23,166 @@ type Telemetry struct {
 	Version     string         `json:"magistrala_version,omitempty" db:"mg_version"`
 	LastSeen    time.Time      `json:"last_seen" db:"service_time"`
 	Country     string         `json:"country,omitempty" db:"country"`
+	CountryCode string         `json:"country_code,omitempty" db:"country_code"`
+	Region      string         `json:"region,omitempty" db:"region"`
 	City        string         `json:"city,omitempty" db:"city"`
+	PostalCode  string         `json:"postal_code,omitempty" db:"postal_code"`
+	Timezone    string         `json:"timezone,omitempty" db:"timezone"`
+	ASN         uint32         `json:"asn,omitempty" db:"asn"`
+	ASOrg       string         `json:"as_organization,omitempty" db:"as_org"`
+	Provider    string         `json:"provider,omitempty" db:"provider"`
+	NetworkType string         `json:"network_type,omitempty" db:"network_type"`
 	ServiceTime time.Time      `json:"timestamp" db:"time"`
+	// Status is the status of the deployment of the listings.
+	Status string `json:"status,omitempty" db:"-"`
+}
+
+// Wildcard ends filter values matched by prefix.
+const Wildcard = "*"
+
+// earthRadius is the mean radius of the Earth in kilometres.
+const earthRadius = 6371
+
+// Filter matches a field against lists of values. A value ending in Wildcard
+// matches by prefix on the fields that support it, e.g. "0.14.*" on Version.
+type Filter struct {
+	// Values the field must match any of. An empty list matches everything.
+	Values []string
+	// Excluded values the field must match none of.
+	Excluded []string
+}
+
+// Match returns a filter matching any of the values.
+func Match(values ...string) Filter {
+	return Filter{Values: values}
+}
+
+// IsZero reports whether the filter matches everything.
+func (f Filter) IsZero() bool {
+	return len(f.Values) == 0 && len(f.Excluded) == 0
+}
+
+// Matches reports whether the value passes the filter. Values ending in
+// Wildcard are matched by prefix when prefix is set.
+func (f Filter) Matches(val string, prefix bool) bool {
+	if len(f.Values) > 0 && !matchesAny(f.Values, val, prefix) {
+		return false
+	}
+	return !matchesAny(f.Excluded, val, prefix)
+}
+
+func matchesAny(patterns []string, val string, prefix bool) bool {
+	for _, p := range patterns {
+		if prefix && strings.HasSuffix(p, Wildcard) {
+			if strings.HasPrefix(val, strings.TrimSuffix(p, Wildcard)) {
+				return true
+			}
+			continue
+		}
+		if p == val {
+			return true
+		}
+	}
+	return false
+}
+
+// BoundingBox selects deployments within a rectangle of coordinates. The box
+// crosses the antimeridian when MinLon is greater than MaxLon.
+type BoundingBox struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+}
+
+// Contains reports whether the coordinates are within the box.
+func (bb BoundingBox) Contains(lat, lon float64) bool {
+	if lat < bb.MinLat || lat > bb.MaxLat {
+		return false
+	}
+	if bb.MinLon > bb.MaxLon {
+		return lon >= bb.MinLon || lon <= bb.MaxLon
+	}
+	return lon >= bb.MinLon && lon <= bb.MaxLon
+}
+
+// Radius selects deployments within Distance kilometres of a point.
+type Radius struct {
+	Lat      float64
+	Lon      float64
+	Distance float64
+}
+
+// Contains reports whether the coordinates are within the radius.
+func (r Radius) Contains(lat, lon float64) bool {
+	return Distance(r.Lat, r.Lon, lat, lon) <= r.Distance
+}
+
+// Distance returns the great-circle distance in kilometres between two
+// points, using the haversine formula.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dlat := (lat2 - lat1) * rad
+	dlon := (lon2 - lon1) * rad
+	h := math.Pow(math.Sin(dlat/2), 2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Pow(math.Sin(dlon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
 }
 
 type TelemetryFilters struct {
-	From    time.Time
-	To      time.Time
-	Country string
-	City    string
-	Version string
-	Service string
+	From        time.Time
+	To          time.Time
+	Country     Filter
+	City        Filter
+	Version     Filter
+	Service     Filter
+	Provider    Filter
+	NetworkType Filter
+	BoundingBox *BoundingBox
+	Radius      *Radius
+	// Status selects deployments by their status. The service resolves it
+	// into LastSeen, repositories ignore it.
+	Status string
+	// LastSeen selects deployments whose latest event is within the range,
+	// whether the event passes the other filters or not.
+	LastSeen *TimeRange
+}
+
+// Matches reports whether the telemetry event passes the filters. It is the
+// reference for repositories filtering in memory. LastSeen depends on the
+// other events of the deployment, so it isn't matched here.
+func (tf TelemetryFilters) Matches(t Telemetry) bool {
+	switch {
+	case !tf.From.IsZero() && t.ServiceTime.Before(tf.From),
+		!tf.To.IsZero() && t.ServiceTime.After(tf.To),
+		!tf.Country.Matches(t.Country, false),
+		!tf.City.Matches(t.City, false),
+		!tf.Version.Matches(t.Version, true),
+		!tf.Service.Matches(t.Service, false),
+		!tf.Provider.Matches(t.Provider, false),
+		!tf.NetworkType.Matches(t.NetworkType, false),
+		tf.BoundingBox != nil && !tf.BoundingBox.Contains(t.Latitude, t.Longitude),
+		tf.Radius != nil && !tf.Radius.Contains(t.Latitude, t.Longitude):
+		return false
+	default:
+		return true
+	}
 }
 
 type PageMetadata struct {
 	Total  uint64
 	Offset uint64
 	Limit  uint64
+	// Cursor is the opaque position to continue listing from. It is used
+	// instead of Offset when set.
+	Cursor string
+	// NextCursor is the position of the next page. It's empty on the last page.
+	NextCursor string
+	// SkipTotal disables counting of the matching deployments.
+	SkipTotal bool
+	// Sort is one of the Sort* orders, and Dir one of DirAsc and DirDesc.
+	// Dir defaults to DirAsc.
+	Sort string
+	Dir  string
 }
 
 type TelemetryPage struct {
@@ -48,12 +195,74 @@ type CountrySummary struct {
 	NoDeployments int    `json:"number_of_deployments" db:"count"`
 }
 
+type CitySummary struct {
+	Country       string `json:"country" db:"country"`
+	City          string `json:"city" db:"city"`
+	NoDeployments int    `json:"number_of_deployments" db:"count"`
+}
+
+type VersionSummary struct {
+	Version       string `json:"version" db:"mg_version"`
+	NoDeployments int    `json:"number_of_deployments" db:"count"`
+}
+
+type ServiceSummary struct {
+	Service       string `json:"service" db:"service"`
+	NoDeployments int    `json:"number_of_deployments" db:"count"`
+}
+
+type ProviderSummary struct {
+	NetworkType   string `json:"network_type" db:"network_type"`
+	Provider      string `json:"provider,omitempty" db:"provider"`
+	NoDeployments int    `json:"number_of_deployments" db:"count"`
+}
+
+// TelemetrySummary counts the distinct deployments of every breakdown value.
+// Entries are ordered by the number of deployments, most first.
+// TotalDeployments counts every deployment once, however many values of a
+// breakdown it reported.
 type TelemetrySummary struct {
-	Countries        []CountrySummary `json:"countries,omitempty"`
-	Cities           []string         `json:"cities,omitempty"`
-	Services         []string         `json:"services,omitempty"`
-	Versions         []string         `json:"versions,omitempty"`
-	TotalDeployments int              `json:"total_deployments,omitempty"`
+	Countries        []CountrySummary  `json:"countries,omitempty"`
+	Cities           []CitySummary     `json:"cities,omitempty"`
+	Services         []ServiceSummary  `json:"services,omitempty"`
+	Versions         []VersionSummary  `json:"versions,omitempty"`
+	Providers        []ProviderSummary `json:"providers,omitempty"`
+	Statuses         []StatusSummary   `json:"statuses,omitempty"`
+	TotalDeployments int               `json:"total_deployments,omitempty"`
+}
+
+// Breakdowns of a telemetry summary.
+const (
+	BreakdownCountries = "countries"
+	BreakdownCities    = "cities"
+	BreakdownVersions  = "versions"
+	BreakdownServices  = "services"
+	BreakdownProviders = "providers"
+	BreakdownStatuses  = "statuses"
+)
+
+// ErrInvalidBreakdown indicates an unknown summary breakdown.
+var ErrInvalidBreakdown = errors.New("invalid summary breakdown")
+
+// Breakdowns selects the breakdowns of a summary. No breakdowns select all
+// of them.
+type Breakdowns []string
+
+// Validate returns ErrInvalidBreakdown if any breakdown is unknown.
+func (b Breakdowns) Validate() error {
+	for _, name := range b {
+		switch name {
+		case BreakdownCountries, BreakdownCities, BreakdownVersions, BreakdownServices, BreakdownProviders, BreakdownStatuses:
+		default:
+			return ErrInvalidBreakdown
+		}
+	}
+	return nil
+}
+
+// Includes reports whether the breakdown is selected.
+func (b Breakdowns) Includes(name string) bool {
+	return len(b) == 0 || slices.Contains(b, name)
 }
 
 // TelemetryRepository specifies an account persistence API.
@@ -64,6 +273,35 @@ type TelemetryRepo interface {
 
 	// RetrieveAll retrieves all telemetry events.
 	RetrieveAll(ctx context.Context, pm PageMetadata, filters TelemetryFilters) (TelemetryPage, error)
-	// RetrieveSummary gets distinct countries, cities,services and versions in a summarised form.
-	RetrieveSummary(ctx context.Context, filters TelemetryFilters) (TelemetrySummary, error)
+	// RetrieveSummary counts the deployments with events matching the filters
+	// in total and by each of the breakdowns. Deployments are counted by
+	// their status at now, which depends on their latest event whether it
+	// matches the filters or not, from the same snapshot as the rest.
+	RetrieveSummary(ctx context.Context, filters TelemetryFilters, breakdowns Breakdowns, status StatusConfig, now time.Time) (TelemetrySummary, error)
+	// RetrieveTimeseries counts the deployments with events matching the
+	// filters in every bucket of the interval, by the value of the split
+	// dimension if any. Points are ordered by time and value, buckets
+	// without deployments are left out.
+	RetrieveTimeseries(ctx context.Context, filters TelemetryFilters, interval, split string) ([]TimeseriesPoint, error)
+	// RetrieveTransitions reports the version transitions of deployments
+	// with events matching the filters. The filter window bounds the time of
+	// the upgrades, the versions they're from may be reported before it.
+	RetrieveTransitions(ctx context.Context, filters TelemetryFilters) (TransitionReport, error)
+	// RetrieveCohorts groups the deployments with events matching the filters
+	// by the period they were first seen in, and reports their retention up
+	// to the end of the filter window, or now. The window bounds when
+	// deployments were first seen.
+	RetrieveCohorts(ctx context.Context, filters TelemetryFilters, period string) ([]Cohort, error)
+	// RetrieveServiceSets lists the services of every deployment with events
+	// matching the filters. Deployments are ordered by IP address and their
+	// services by name.
+	RetrieveServiceSets(ctx context.Context, filters TelemetryFilters) ([]DeploymentServices, error)
+
+	// Erase removes all telemetry events stored under any of the identifiers,
+	// records the receipt in the audit log and blocklists the given entries.
+	// The receipt is returned with the number of removed events.
+	Erase(ctx context.Context, receipt ErasureReceipt, identifiers, blocklist []string) (ErasureReceipt, error)
+
+	// Blocked reports whether any of the identifiers is blocklisted.
+	Blocked(ctx context.Context, identifiers ...string) (bool, error)
 }
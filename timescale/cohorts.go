@@ -0,0 +1,57 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/absmach/callhome"
+)
+
+// retrieveCohorts counts the deployments of every cohort that reported in
+// each period in a single query. Like summaries, cohorts are read from the
+// daily continuous aggregate when the filters allow it.
+func (r repo) retrieveCohorts(ctx context.Context, filters callhome.TelemetryFilters, period string) ([]callhome.Cohort, error) {
+	if err := callhome.ValidateCohortPeriod(period); err != nil {
+		return nil, err
+	}
+	src := r.summarySource(filters)
+	// Deployments first seen before the window are left out rather than
+	// assigned to a later cohort.
+	events := filters
+	events.From = time.Time{}
+	filterQuery, params := generateQuery(events, src)
+
+	// Deployments first seen before the retention period look first seen
+	// within it, so the window starts at the first period wholly within it.
+	from := filters.From
+	if r.cfg.Retention > 0 {
+		if boundary := r.retentionBoundary(period); from.Before(boundary) {
+			from = boundary
+		}
+	}
+	having := ""
+	if !from.IsZero() {
+		having = "HAVING MIN(first_time) >= :from"
+		params["from"] = from
+	}
+	q := fmt.Sprintf(`WITH events AS (
+			SELECT ip_address, time_bucket(INTERVAL '%[1]s', %[2]s) AS period, MIN(%[2]s) AS first_time
+			FROM %[3]s %[4]s
+			GROUP BY 1, 2
+		), cohorts AS (
+			SELECT ip_address, MIN(period) AS cohort FROM events GROUP BY ip_address %[5]s
+		)
+		SELECT c.cohort, e.period, COUNT(*) AS count
+		FROM cohorts c JOIN events e ON e.ip_address = c.ip_address
+		GROUP BY 1, 2 ORDER BY 1, 2;`, bucketWidths[period], src.time, src.table, filterQuery, having)
+
+	var activity []callhome.CohortActivity
+	if err := selectNamed(ctx, r.reader(), &activity, q, params); err != nil {
+		return nil, err
+	}
+	return callhome.BuildCohorts(activity, period, filters.To), nil
+}
@@ -0,0 +1,41 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/internal/clients/postgres"
+	"github.com/absmach/callhome/repotest"
+	"github.com/absmach/callhome/timescale"
+	"github.com/stretchr/testify/require"
+)
+
+const testPrefix = "MG_CALLHOME_TEST_"
+
+// TestConformance runs the repository test suite against the TimescaleDB
+// instance configured with the MG_CALLHOME_TEST_TIMESCALE_* variables. The
+// tables of the database are emptied before every test.
+func TestConformance(t *testing.T) {
+	if os.Getenv(testPrefix+"TIMESCALE_HOST") == "" {
+		t.Skip("set " + testPrefix + "TIMESCALE_HOST to run against TimescaleDB")
+	}
+	db, err := postgres.Setup(testPrefix, timescale.Migration())
+	require.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	spatial, err := timescale.SpatialSupport(context.Background(), db)
+	require.Nil(t, err)
+
+	repotest.Run(t, func(t *testing.T) callhome.TelemetryRepo {
+		_, err := db.Exec(`TRUNCATE telemetry, telemetry_history, blocklist, erasures;`)
+		require.Nil(t, err)
+		_, err = db.Exec(`CALL refresh_continuous_aggregate('telemetry_daily', NULL, NULL);`)
+		require.Nil(t, err)
+		return timescale.New(db, timescale.Config{Spatial: spatial})
+	})
+}
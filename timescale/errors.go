@@ -6,8 +6,11 @@ package timescale
 import "errors"
 
 var (
-	ErrRecordNotFound = errors.New("record not found")
-	ErrSaveEvent      = errors.New("failed to save event to database")
-	ErrTransRollback  = errors.New("failed to rollback transaction")
-	ErrInvalidEvent   = errors.New("invalid event representation")
+	ErrRecordNotFound   = errors.New("record not found")
+	ErrSaveEvent        = errors.New("failed to save event to database")
+	ErrTransRollback    = errors.New("failed to rollback transaction")
+	ErrInvalidEvent     = errors.New("invalid event representation")
+	ErrEraseEvents      = errors.New("failed to erase events from database")
+	ErrInvalidRetention = errors.New("invalid retention period")
+	ErrQueryTimeout     = errors.New("database query timed out")
 )
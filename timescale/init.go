@@ -4,10 +4,54 @@
 package timescale
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	_ "github.com/jackc/pgx/v5/stdlib" // required for SQL access
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 	migrate "github.com/rubenv/sql-migrate"
 )
 
+// retentionTables are the tables that keep data only for the raw retention
+// period. The daily aggregate follows the raw data so that erasures, which
+// refresh it from the raw data, reach all of it.
+var retentionTables = []string{"telemetry", "telemetry_daily"}
+
+// ApplyRetention replaces the retention policies of the raw telemetry and its
+// daily aggregate with the given retention period.
+func ApplyRetention(ctx context.Context, db *sqlx.DB, retention time.Duration) (err error) {
+	if retention <= 0 {
+		return ErrInvalidRetention
+	}
+	interval := fmt.Sprintf("%d seconds", int64(retention.Seconds()))
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if txErr := tx.Rollback(); txErr != nil {
+				err = errors.Wrap(err, errors.Wrap(ErrTransRollback, txErr.Error()).Error())
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	for _, table := range retentionTables {
+		if _, err = tx.ExecContext(ctx, `SELECT remove_retention_policy($1, if_exists => true);`, table); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, `SELECT add_retention_policy($1, $2::interval);`, table, interval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Migration of Telemetry service.
 func Migration() migrate.MemoryMigrationSource {
 	return migrate.MemoryMigrationSource{
@@ -38,6 +82,158 @@ func Migration() migrate.MemoryMigrationSource {
 				},
 				Down: []string{`SELECT remove_retention_policy('telemetry');`},
 			},
+			{
+				Id: "telemetry_3",
+				Up: []string{
+					`ALTER TABLE telemetry
+						ADD COLUMN IF NOT EXISTS country_code	TEXT	NOT NULL DEFAULT '',
+						ADD COLUMN IF NOT EXISTS region			TEXT	NOT NULL DEFAULT '',
+						ADD COLUMN IF NOT EXISTS postal_code	TEXT	NOT NULL DEFAULT '',
+						ADD COLUMN IF NOT EXISTS timezone		TEXT	NOT NULL DEFAULT '';`,
+				},
+				Down: []string{
+					`ALTER TABLE telemetry
+						DROP COLUMN IF EXISTS country_code,
+						DROP COLUMN IF EXISTS region,
+						DROP COLUMN IF EXISTS postal_code,
+						DROP COLUMN IF EXISTS timezone;`,
+				},
+			},
+			{
+				Id: "telemetry_4",
+				Up: []string{
+					`ALTER TABLE telemetry
+						ADD COLUMN IF NOT EXISTS asn			BIGINT	NOT NULL DEFAULT 0,
+						ADD COLUMN IF NOT EXISTS as_org			TEXT	NOT NULL DEFAULT '',
+						ADD COLUMN IF NOT EXISTS provider		TEXT	NOT NULL DEFAULT '',
+						ADD COLUMN IF NOT EXISTS network_type	TEXT	NOT NULL DEFAULT 'unknown';`,
+				},
+				Down: []string{
+					`ALTER TABLE telemetry
+						DROP COLUMN IF EXISTS asn,
+						DROP COLUMN IF EXISTS as_org,
+						DROP COLUMN IF EXISTS provider,
+						DROP COLUMN IF EXISTS network_type;`,
+				},
+			},
+			{
+				Id: "telemetry_5",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS erasures (
+						id				TEXT		PRIMARY KEY,
+						subject			TEXT		NOT NULL,
+						records_removed	BIGINT		NOT NULL,
+						blocklisted		BOOLEAN		NOT NULL,
+						reason			TEXT		NOT NULL DEFAULT '',
+						erased_at		TIMESTAMPTZ	NOT NULL
+					);
+					CREATE TABLE IF NOT EXISTS blocklist (
+						identifier		TEXT		PRIMARY KEY,
+						erasure_id		TEXT		NOT NULL REFERENCES erasures (id),
+						created_at		TIMESTAMPTZ	NOT NULL
+					);
+					CREATE INDEX IF NOT EXISTS telemetry_ip_address_idx ON telemetry (ip_address, time DESC);`,
+				},
+				Down: []string{
+					`DROP INDEX IF EXISTS telemetry_ip_address_idx;
+					DROP TABLE IF EXISTS blocklist;
+					DROP TABLE IF EXISTS erasures;`,
+				},
+			},
+			{
+				// Continuous aggregates can't be created or refreshed inside a transaction.
+				Id: "telemetry_6",
+				Up: []string{
+					`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_daily
+					WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+					SELECT time_bucket(INTERVAL '1 day', time) AS bucket, ip_address, country, city,
+						mg_version, service, provider, network_type, COUNT(*) AS reports, MAX(time) AS last_seen
+					FROM telemetry
+					GROUP BY bucket, ip_address, country, city, mg_version, service, provider, network_type
+					WITH NO DATA;`,
+					`SELECT add_continuous_aggregate_policy('telemetry_daily',
+						start_offset => INTERVAL '3 days',
+						end_offset => INTERVAL '1 hour',
+						schedule_interval => INTERVAL '1 hour');`,
+					`SELECT add_retention_policy('telemetry_daily', INTERVAL '90 days');`,
+					`CALL refresh_continuous_aggregate('telemetry_daily', NULL, NULL);`,
+				},
+				Down:                   []string{`DROP MATERIALIZED VIEW IF EXISTS telemetry_daily;`},
+				DisableTransactionUp:   true,
+				DisableTransactionDown: true,
+			},
+			{
+				// telemetry_history keeps daily distinct deployment counts for every
+				// combination of version, country and service, '*' standing for all
+				// values. It isn't subject to the raw retention policy.
+				Id: "telemetry_7",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS telemetry_history (
+						day				DATE	NOT NULL,
+						mg_version		TEXT	NOT NULL,
+						country			TEXT	NOT NULL,
+						service			TEXT	NOT NULL,
+						deployments		BIGINT	NOT NULL,
+						PRIMARY KEY (day, mg_version, country, service)
+					);`,
+					`CREATE OR REPLACE PROCEDURE downsample_telemetry(job_id INT, config JSONB)
+					LANGUAGE SQL AS $$
+						INSERT INTO telemetry_history (day, mg_version, country, service, deployments)
+						SELECT (bucket AT TIME ZONE 'UTC')::date,
+							CASE WHEN GROUPING(mg_version) = 1 THEN '*' ELSE COALESCE(mg_version, '') END,
+							CASE WHEN GROUPING(country) = 1 THEN '*' ELSE COALESCE(country, '') END,
+							CASE WHEN GROUPING(service) = 1 THEN '*' ELSE COALESCE(service, '') END,
+							COUNT(DISTINCT ip_address)
+						FROM telemetry_daily
+						WHERE bucket >= time_bucket(INTERVAL '1 day', now()) - COALESCE((config->>'lookback')::interval, INTERVAL '3 days')
+							AND bucket < time_bucket(INTERVAL '1 day', now())
+						GROUP BY bucket, CUBE (mg_version, country, service)
+						ON CONFLICT (day, mg_version, country, service) DO UPDATE SET deployments = EXCLUDED.deployments;
+					$$;`,
+					`CALL downsample_telemetry(0, '{"lookback": "100 years"}');`,
+					`SELECT add_job('downsample_telemetry', INTERVAL '1 hour', config => '{"lookback": "3 days"}');`,
+				},
+				Down: []string{
+					`SELECT delete_job(job_id) FROM timescaledb_information.jobs WHERE proc_name = 'downsample_telemetry';`,
+					`DROP PROCEDURE IF EXISTS downsample_telemetry(INT, JSONB);`,
+					`DROP TABLE IF EXISTS telemetry_history;`,
+				},
+			},
+			{
+				// The location column is only added when PostGIS is available,
+				// otherwise the repository keeps using the coordinate columns.
+				Id: "telemetry_8",
+				Up: []string{
+					`DO $$
+					BEGIN
+						IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'postgis') THEN
+							CREATE EXTENSION IF NOT EXISTS postgis;
+							ALTER TABLE telemetry ADD COLUMN IF NOT EXISTS location geography(Point, 4326);
+							UPDATE telemetry SET location = ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography
+								WHERE location IS NULL;
+							CREATE INDEX IF NOT EXISTS telemetry_location_idx ON telemetry USING GIST (location);
+						END IF;
+					END $$;`,
+				},
+				Down: []string{
+					`DROP INDEX IF EXISTS telemetry_location_idx;`,
+					`ALTER TABLE telemetry DROP COLUMN IF EXISTS location;`,
+				},
+			},
 		},
 	}
 }
+
+// SpatialSupport reports whether telemetry has the PostGIS location column,
+// i.e. whether PostGIS was available when the migrations were applied.
+func SpatialSupport(ctx context.Context, db *sqlx.DB) (bool, error) {
+	var ok bool
+	q := `SELECT EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'telemetry' AND column_name = 'location'
+	);`
+	if err := db.QueryRowxContext(ctx, q).Scan(&ok); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
@@ -5,6 +5,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/absmach/callhome"
 	"github.com/stretchr/testify/mock"
@@ -17,7 +18,7 @@ type mockRepo struct {
 }
 
 func (mr *mockRepo) RetrieveAll(ctx context.Context, pm callhome.PageMetadata, filter callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
-	ret := mr.Called(ctx, pm)
+	ret := mr.Called(ctx, pm, filter)
 	return ret.Get(0).(callhome.TelemetryPage), ret.Error(1)
 }
 
@@ -33,10 +34,37 @@ func (mr *mockRepo) Save(ctx context.Context, t callhome.Telemetry) error {
 	return r0
 }
 
-func (*mockRepo) RetrieveSummary(ctx context.Context, filter callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+func (*mockRepo) RetrieveSummary(ctx context.Context, filter callhome.TelemetryFilters, breakdowns callhome.Breakdowns, status callhome.StatusConfig, now time.Time) (callhome.TelemetrySummary, error) {
 	return callhome.TelemetrySummary{}, nil
 }
 
+func (*mockRepo) RetrieveTimeseries(ctx context.Context, filter callhome.TelemetryFilters, interval, split string) ([]callhome.TimeseriesPoint, error) {
+	return nil, nil
+}
+
+func (*mockRepo) RetrieveTransitions(ctx context.Context, filter callhome.TelemetryFilters) (callhome.TransitionReport, error) {
+	return callhome.TransitionReport{}, nil
+}
+
+func (*mockRepo) RetrieveCohorts(ctx context.Context, filter callhome.TelemetryFilters, period string) ([]callhome.Cohort, error) {
+	return nil, nil
+}
+
+func (mr *mockRepo) RetrieveServiceSets(ctx context.Context, filter callhome.TelemetryFilters) ([]callhome.DeploymentServices, error) {
+	ret := mr.Called(ctx)
+	return ret.Get(0).([]callhome.DeploymentServices), ret.Error(1)
+}
+
+func (mr *mockRepo) Erase(ctx context.Context, receipt callhome.ErasureReceipt, identifiers, blocklist []string) (callhome.ErasureReceipt, error) {
+	ret := mr.Called(ctx, receipt, identifiers, blocklist)
+	return ret.Get(0).(callhome.ErasureReceipt), ret.Error(1)
+}
+
+func (mr *mockRepo) Blocked(ctx context.Context, identifiers ...string) (bool, error) {
+	ret := mr.Called(ctx, identifiers)
+	return ret.Bool(0), ret.Error(1)
+}
+
 type mockConstructorTestingTNewTelemetryRepo interface {
 	mock.TestingT
 	Cleanup(func())
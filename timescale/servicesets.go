@@ -0,0 +1,28 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/absmach/callhome"
+)
+
+// retrieveServiceSets aggregates the services of every deployment the way
+// the listing does, reading the daily continuous aggregate when the filters
+// allow it.
+func (r repo) retrieveServiceSets(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.DeploymentServices, error) {
+	src := r.summarySource(filters)
+	filterQuery, params := generateQuery(filters, src)
+	q := fmt.Sprintf(`SELECT ip_address, ARRAY_AGG(DISTINCT service ORDER BY service) AS services
+		FROM %s %s
+		GROUP BY ip_address ORDER BY ip_address;`, src.table, filterQuery)
+
+	var sets []callhome.DeploymentServices
+	if err := selectNamed(ctx, r.reader(), &sets, q, params); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
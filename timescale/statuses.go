@@ -0,0 +1,49 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// retrieveStatuses classifies the deployments matching the filters by the
+// latest of all their events in a single query. Matching deployments are
+// found in the daily continuous aggregate when the filters allow it, while
+// their latest events are always read from the raw telemetry. The query runs
+// within the snapshot of the summary.
+func (r repo) retrieveStatuses(ctx context.Context, tx *sqlx.Tx, filters callhome.TelemetryFilters, cfg callhome.StatusConfig, now time.Time) ([]callhome.StatusSummary, error) {
+	src := r.summarySource(filters)
+	filterQuery, params := generateQuery(filters, src)
+	params["stale"] = now.Add(-cfg.StaleAfter)
+	params["dormant"] = now.Add(-cfg.DormantAfter)
+	params["churned"] = now.Add(-cfg.ChurnedAfter)
+
+	q := fmt.Sprintf(`WITH matching AS (
+			SELECT DISTINCT ip_address FROM %s %s
+		), last_seen AS (
+			SELECT t.ip_address, MAX(t.time) AS time
+			FROM telemetry t JOIN matching m ON m.ip_address = t.ip_address
+			GROUP BY t.ip_address
+		)
+		SELECT CASE
+			WHEN time >= :stale THEN '%s'
+			WHEN time >= :dormant THEN '%s'
+			WHEN time >= :churned THEN '%s'
+			ELSE '%s'
+		END AS status, COUNT(*) AS count
+		FROM last_seen
+		GROUP BY 1 ORDER BY count DESC, status;`, src.table, filterQuery,
+		callhome.StatusActive, callhome.StatusStale, callhome.StatusDormant, callhome.StatusChurned)
+
+	var statuses []callhome.StatusSummary
+	if err := tracedSelect(ctx, tx, summaryStatusesOp, &statuses, q, params); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
@@ -0,0 +1,346 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/absmach/callhome/timescale"
+
+// Spans of the summary queries.
+const (
+	summaryGroupedOp   = "summary_grouped_op"
+	summaryTotalOp     = "summary_total_op"
+	summaryCountriesOp = "summary_countries_op"
+	summaryServicesOp  = "summary_services_op"
+	summaryVersionsOp  = "summary_versions_op"
+	summaryStatusesOp  = "summary_statuses_op"
+)
+
+// summaryColumns are the columns the summary can be grouped by. The columns
+// of the chosen breakdowns are grouped in this order.
+var summaryColumns = []string{"country", "city", "service", "mg_version", "network_type", "provider"}
+
+// summaryGroups maps the breakdowns onto the columns they're grouped by.
+var summaryGroups = []struct {
+	breakdown string
+	columns   []string
+}{
+	{callhome.BreakdownCountries, []string{"country"}},
+	{callhome.BreakdownCities, []string{"country", "city"}},
+	{callhome.BreakdownServices, []string{"service"}},
+	{callhome.BreakdownVersions, []string{"mg_version"}},
+	{callhome.BreakdownProviders, []string{"network_type", "provider"}},
+}
+
+// summaryRow is a row of the grouped summary. Columns its grouping set
+// doesn't group by are NULL.
+type summaryRow struct {
+	Grouping    int            `db:"grouping"`
+	Country     sql.NullString `db:"country"`
+	City        sql.NullString `db:"city"`
+	Service     sql.NullString `db:"service"`
+	Version     sql.NullString `db:"mg_version"`
+	NetworkType sql.NullString `db:"network_type"`
+	Provider    sql.NullString `db:"provider"`
+	Count       int            `db:"count"`
+}
+
+// grouping returns the GROUPING() mask, over the grouped columns, of the
+// grouping set of the set columns. Bits of the grouped columns the set
+// doesn't group by are set, the first column being the highest bit.
+func grouping(grouped []string, set ...string) int {
+	var mask int
+	for i, col := range grouped {
+		if !slices.Contains(set, col) {
+			mask |= 1 << (len(grouped) - 1 - i)
+		}
+	}
+	return mask
+}
+
+func (r repo) retrieveSummary(ctx context.Context, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns, status callhome.StatusConfig, now time.Time) (callhome.TelemetrySummary, error) {
+	// The summary is read from a single snapshot, so that its numbers agree
+	// with each other while telemetry keeps being saved.
+	tx, err := r.reader().BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return callhome.TelemetrySummary{}, err
+	}
+	defer tx.Rollback()
+
+	summary, err := r.retrieveRangeSummary(ctx, tx, filters, breakdowns)
+	if err != nil {
+		return callhome.TelemetrySummary{}, err
+	}
+	if breakdowns.Includes(callhome.BreakdownStatuses) {
+		if summary.Statuses, err = r.retrieveStatuses(ctx, tx, filters, status, now); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+	}
+	return summary, nil
+}
+
+// retrieveRangeSummary computes the total and the breakdowns of the filter
+// window, from the history for the days it reaches past the retention.
+func (r repo) retrieveRangeSummary(ctx context.Context, tx *sqlx.Tx, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns) (callhome.TelemetrySummary, error) {
+	if !r.historic(filters) {
+		return r.retrieveGroupedSummary(ctx, tx, filters, breakdowns)
+	}
+
+	// Days before the retention boundary are only kept in the history, while
+	// the rest of the range, up to today, is summarised from raw data.
+	boundary := r.retentionBoundary(callhome.IntervalDay)
+	summary, err := r.retrieveHistorySummary(ctx, tx, filters, breakdowns, boundary)
+	if err != nil {
+		return callhome.TelemetrySummary{}, err
+	}
+	if !filters.To.IsZero() && filters.To.Before(boundary) {
+		return summary, nil
+	}
+	recentFilters := filters
+	recentFilters.From = boundary
+	recent, err := r.retrieveGroupedSummary(ctx, tx, recentFilters, breakdowns)
+	if err != nil {
+		return callhome.TelemetrySummary{}, err
+	}
+	return mergeSummaries(summary, recent), nil
+}
+
+// mergeSummaries merges the summary of the history with the summary of the
+// raw data of the rest of the range. Neither tells which deployments the
+// other counted, so the number of deployments of a value is the higher of
+// both. Cities and providers are only kept in raw data.
+func mergeSummaries(history, recent callhome.TelemetrySummary) callhome.TelemetrySummary {
+	recent.TotalDeployments = max(history.TotalDeployments, recent.TotalDeployments)
+	recent.Countries = mergeCounts(history.Countries, recent.Countries,
+		func(c callhome.CountrySummary) string { return c.Country },
+		func(c *callhome.CountrySummary) *int { return &c.NoDeployments })
+	recent.Services = mergeCounts(history.Services, recent.Services,
+		func(s callhome.ServiceSummary) string { return s.Service },
+		func(s *callhome.ServiceSummary) *int { return &s.NoDeployments })
+	recent.Versions = mergeCounts(history.Versions, recent.Versions,
+		func(v callhome.VersionSummary) string { return v.Version },
+		func(v *callhome.VersionSummary) *int { return &v.NoDeployments })
+	return recent
+}
+
+// mergeCounts merges two lists of counts by value, keeping the higher count
+// of every value, and orders them by count, most first, then by value.
+func mergeCounts[T any](history, recent []T, value func(T) string, count func(*T) *int) []T {
+	merged := slices.Clone(recent)
+	index := make(map[string]int, len(merged))
+	for i, c := range merged {
+		index[value(c)] = i
+	}
+	for _, h := range history {
+		i, ok := index[value(h)]
+		if !ok {
+			merged = append(merged, h)
+			continue
+		}
+		if n := *count(&h); n > *count(&merged[i]) {
+			*count(&merged[i]) = n
+		}
+	}
+	slices.SortFunc(merged, func(a, b T) int {
+		if c := cmp.Compare(*count(&b), *count(&a)); c != 0 {
+			return c
+		}
+		return cmp.Compare(value(a), value(b))
+	})
+	return merged
+}
+
+// retrieveGroupedSummary computes the total and all the breakdowns in a
+// single scan using grouping sets. The driver runs one query at a time on a
+// connection, so the breakdowns can't be queried concurrently within the
+// snapshot.
+func (r repo) retrieveGroupedSummary(ctx context.Context, tx *sqlx.Tx, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns) (callhome.TelemetrySummary, error) {
+	src := r.summarySource(filters)
+	filterQuery, params := generateQuery(filters, src)
+
+	var selected, chosen []string
+	for _, g := range summaryGroups {
+		if breakdowns.Includes(g.breakdown) {
+			selected = append(selected, g.breakdown)
+			chosen = append(chosen, g.columns...)
+		}
+	}
+	// Only the columns of the chosen breakdowns can be selected, passed to
+	// GROUPING() and ordered by. The rest are selected as NULL.
+	var grouped, selectList []string
+	for _, col := range summaryColumns {
+		if !slices.Contains(chosen, col) {
+			selectList = append(selectList, "NULL AS "+col)
+			continue
+		}
+		grouped = append(grouped, col)
+		selectList = append(selectList, col)
+	}
+
+	sets := []string{"()"}
+	masks := map[int]string{grouping(grouped): ""}
+	for _, g := range summaryGroups {
+		if breakdowns.Includes(g.breakdown) {
+			sets = append(sets, fmt.Sprintf("(%s)", strings.Join(g.columns, ", ")))
+			masks[grouping(grouped, g.columns...)] = g.breakdown
+		}
+	}
+	groupingExpr, order := "0", "count DESC"
+	if len(grouped) > 0 {
+		groupingExpr = fmt.Sprintf("GROUPING(%s)", strings.Join(grouped, ", "))
+		order += ", " + strings.Join(grouped, ", ")
+	}
+	q := fmt.Sprintf(`SELECT %s AS grouping, %s, COUNT(DISTINCT ip_address) AS count
+		FROM %s %s
+		GROUP BY GROUPING SETS (%s)
+		ORDER BY %s;`, groupingExpr, strings.Join(selectList, ", "), src.table, filterQuery, strings.Join(sets, ", "), order)
+
+	ctx, span := tracer(ctx).Start(ctx, summaryGroupedOp, trace.WithAttributes(attribute.StringSlice("breakdowns", selected)))
+	defer span.End()
+
+	var rows []summaryRow
+	if err := selectNamed(ctx, tx, &rows, q, params); err != nil {
+		return callhome.TelemetrySummary{}, err
+	}
+	span.SetAttributes(attribute.Int("rows", len(rows)))
+
+	var summary callhome.TelemetrySummary
+	for _, row := range rows {
+		breakdown, ok := masks[row.Grouping]
+		if !ok {
+			continue
+		}
+		switch breakdown {
+		case "":
+			summary.TotalDeployments = row.Count
+		case callhome.BreakdownCountries:
+			summary.Countries = append(summary.Countries, callhome.CountrySummary{Country: row.Country.String, NoDeployments: row.Count})
+		case callhome.BreakdownCities:
+			summary.Cities = append(summary.Cities, callhome.CitySummary{Country: row.Country.String, City: row.City.String, NoDeployments: row.Count})
+		case callhome.BreakdownServices:
+			summary.Services = append(summary.Services, callhome.ServiceSummary{Service: row.Service.String, NoDeployments: row.Count})
+		case callhome.BreakdownVersions:
+			summary.Versions = append(summary.Versions, callhome.VersionSummary{Version: row.Version.String, NoDeployments: row.Count})
+		case callhome.BreakdownProviders:
+			summary.Providers = append(summary.Providers, callhome.ProviderSummary{NetworkType: row.NetworkType.String, Provider: row.Provider.String, NoDeployments: row.Count})
+		}
+	}
+
+	return summary, nil
+}
+
+// retrieveHistorySummary computes the summary of the days of the range
+// before the given day from telemetry_history. As the history only keeps
+// daily counts, the number of deployments over a range is the highest daily
+// number of distinct deployments within it. Cities and providers are not
+// kept in the history.
+func (r repo) retrieveHistorySummary(ctx context.Context, tx *sqlx.Tx, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns, before time.Time) (callhome.TelemetrySummary, error) {
+	params := map[string]interface{}{
+		"from":    filters.From.UTC().Format(time.DateOnly),
+		"before":  before.UTC().Format(time.DateOnly),
+		"version": orAll(filters.Version),
+		"country": orAll(filters.Country),
+		"service": orAll(filters.Service),
+		"all":     allValues,
+	}
+	window := "day >= CAST(:from AS DATE) AND day < CAST(:before AS DATE)"
+	if !filters.To.IsZero() {
+		window += " AND day <= CAST(:to AS DATE)"
+		params["to"] = filters.To.UTC().Format(time.DateOnly)
+	}
+
+	var summary callhome.TelemetrySummary
+	q := fmt.Sprintf(`SELECT COALESCE(MAX(deployments), 0) FROM telemetry_history
+		WHERE %s AND mg_version = :version AND country = :country AND service = :service;`, window)
+	if err := tracedGet(ctx, tx, summaryTotalOp, &summary.TotalDeployments, q, params); err != nil {
+		return callhome.TelemetrySummary{}, err
+	}
+
+	if breakdowns.Includes(callhome.BreakdownCountries) {
+		q := fmt.Sprintf(`SELECT country, MAX(deployments) AS count FROM telemetry_history
+			WHERE %s AND mg_version = :version AND service = :service AND country <> :all
+			AND (:country = :all OR country = :country)
+			GROUP BY country ORDER BY count DESC, country;`, window)
+		if err := tracedSelect(ctx, tx, summaryCountriesOp, &summary.Countries, q, params); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+	}
+
+	if breakdowns.Includes(callhome.BreakdownServices) {
+		q := fmt.Sprintf(`SELECT service, MAX(deployments) AS count FROM telemetry_history
+			WHERE %s AND mg_version = :version AND country = :country AND service <> :all
+			AND (:service = :all OR service = :service)
+			GROUP BY service ORDER BY count DESC, service;`, window)
+		if err := tracedSelect(ctx, tx, summaryServicesOp, &summary.Services, q, params); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+	}
+
+	if breakdowns.Includes(callhome.BreakdownVersions) {
+		q := fmt.Sprintf(`SELECT mg_version, MAX(deployments) AS count FROM telemetry_history
+			WHERE %s AND country = :country AND service = :service AND mg_version <> :all
+			AND (:version = :all OR mg_version = :version)
+			GROUP BY mg_version ORDER BY count DESC, mg_version;`, window)
+		if err := tracedSelect(ctx, tx, summaryVersionsOp, &summary.Versions, q, params); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+	}
+
+	return summary, nil
+}
+
+// tracer returns the tracer of the span of the context, so that queries are
+// traced as children of the operation running them.
+func tracer(ctx context.Context) trace.Tracer {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+}
+
+func tracedSelect(ctx context.Context, e sqlx.ExtContext, name string, dest interface{}, q string, params map[string]interface{}) error {
+	ctx, span := tracer(ctx).Start(ctx, name)
+	defer span.End()
+	return selectNamed(ctx, e, dest, q, params)
+}
+
+func tracedGet(ctx context.Context, e sqlx.ExtContext, name string, dest interface{}, q string, params map[string]interface{}) error {
+	ctx, span := tracer(ctx).Start(ctx, name)
+	defer span.End()
+	return getNamed(ctx, e, dest, q, params)
+}
+
+// selectNamed runs the named query and scans all rows into dest.
+func selectNamed(ctx context.Context, e sqlx.ExtContext, dest interface{}, q string, params map[string]interface{}) error {
+	rows, err := sqlx.NamedQueryContext(ctx, e, q, params)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return sqlx.StructScan(rows, dest)
+}
+
+// getNamed runs the named query and scans its first row into dest, leaving
+// dest unchanged when there are no rows.
+func getNamed(ctx context.Context, e sqlx.ExtContext, dest interface{}, q string, params map[string]interface{}) error {
+	rows, err := sqlx.NamedQueryContext(ctx, e, q, params)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return rows.Scan(dest)
+	}
+	return rows.Err()
+}
@@ -6,99 +6,319 @@ package timescale
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/absmach/callhome"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
 var _ callhome.TelemetryRepo = (*repo)(nil)
 
+// dailyBucket is the bucket width of the telemetry_daily continuous aggregate.
+const dailyBucket = 24 * time.Hour
+
+// source is a table telemetry can be read from, along with its time column
+// and the conditions used to filter it by time and, if it keeps coordinates,
+// by distance.
+type source struct {
+	table    string
+	time     string
+	from     string
+	to       string
+	distance string
+}
+
+var (
+	rawSource     = source{table: "telemetry", time: "time", from: "time >= :from", to: "time <= :to", distance: haversine("latitude", "longitude") + " <= :distance"}
+	spatialSource = source{table: "telemetry", time: "time", from: "time >= :from", to: "time <= :to", distance: "ST_DWithin(location, " + point + ", CAST(:distance AS DOUBLE PRECISION) * 1000)"}
+	dailySource   = source{table: "telemetry_daily", time: "bucket", from: "bucket >= :from", to: "bucket < :to"}
+)
+
+// allValues marks telemetry_history rows aggregated over all values of a column.
+const allValues = "*"
+
+// point is the PostGIS geography of the point given by :lat and :lon.
+const point = "CAST(ST_SetSRID(ST_MakePoint(:lon, :lat), 4326) AS geography)"
+
+// haversine returns the expression of the distance in kilometres between the
+// given coordinate columns and the point given by :lat and :lon.
+func haversine(lat, lon string) string {
+	return fmt.Sprintf(`2 * 6371 * ASIN(LEAST(1, SQRT(
+		POWER(SIN(RADIANS(%[1]s - :lat) / 2), 2) +
+		COS(RADIANS(:lat)) * COS(RADIANS(%[1]s)) * POWER(SIN(RADIANS(%[2]s - :lon) / 2), 2)
+	)))`, lat, lon)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Config defines the repository options.
+type Config struct {
+	// Retention is how long raw telemetry is kept. Summaries of ranges
+	// starting before it are computed from the downsampled history.
+	Retention time.Duration
+	// Spatial enables the PostGIS location column. It is set when
+	// SpatialSupport reports the column exists.
+	Spatial bool
+	// Reader returns the database listings and summaries are read from,
+	// e.g. a read replica. Reads use the primary database when it's nil.
+	Reader func() *sqlx.DB
+	// SaveTimeout, RetrieveTimeout and SummaryTimeout bound the statements
+	// of saving events, listing deployments and summarising them. Zero
+	// leaves the operation unbounded.
+	SaveTimeout     time.Duration
+	RetrieveTimeout time.Duration
+	SummaryTimeout  time.Duration
+	// Logger logs failures that don't fail the operation. The default
+	// logger is used when it's nil.
+	Logger *slog.Logger
+}
+
 type repo struct {
-	db *sqlx.DB
+	db  *sqlx.DB
+	cfg Config
 }
 
 // New returns new TimescaleSQL writer.
-func New(db *sqlx.DB) callhome.TelemetryRepo {
-	return &repo{db: db}
+func New(db *sqlx.DB, cfg Config) callhome.TelemetryRepo {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &repo{db: db, cfg: cfg}
+}
+
+// reader returns the database to read listings and summaries from.
+func (r repo) reader() *sqlx.DB {
+	if r.cfg.Reader == nil {
+		return r.db
+	}
+	return r.cfg.Reader()
+}
+
+// sortColumn maps a sort order onto the expression it orders by and the
+// type the cursor key is cast to.
+type sortColumn struct {
+	expr string
+	cast string
+}
+
+var sortColumns = map[string]sortColumn{
+	"":                     {expr: "d.ip_address"},
+	callhome.SortLastSeen:  {expr: "t.time", cast: "TIMESTAMPTZ"},
+	callhome.SortFirstSeen: {expr: "d.first_seen", cast: "TIMESTAMPTZ"},
+	callhome.SortCountry:   {expr: "t.country", cast: "TEXT"},
+	callhome.SortCity:      {expr: "t.city", cast: "TEXT"},
+	callhome.SortVersion:   {expr: "t.mg_version", cast: "TEXT"},
+	callhome.SortServices:  {expr: "d.service_count", cast: "INTEGER"},
+}
+
+// sortColumn returns the sort column of the sort order. Distances are computed
+// with PostGIS when it is available.
+func (r repo) sortColumn(sort string) sortColumn {
+	if sort != callhome.SortDistance {
+		return sortColumns[sort]
+	}
+	if r.cfg.Spatial {
+		return sortColumn{expr: "ST_Distance(t.location, " + point + ") / 1000", cast: "DOUBLE PRECISION"}
+	}
+	return sortColumn{expr: haversine("t.latitude", "t.longitude"), cast: "DOUBLE PRECISION"}
+}
+
+// deployment is a row of the telemetry listing together with the columns
+// it can be sorted by.
+type deployment struct {
+	callhome.Telemetry
+	FirstSeen time.Time `db:"first_seen"`
+	Distance  float64   `db:"distance"`
+}
+
+// key returns the value of the sort column of the deployment as stored in a cursor.
+func (d deployment) key(sort string) string {
+	switch sort {
+	case callhome.SortLastSeen:
+		return d.ServiceTime.Format(time.RFC3339Nano)
+	case callhome.SortFirstSeen:
+		return d.FirstSeen.Format(time.RFC3339Nano)
+	case callhome.SortCountry:
+		return d.Country
+	case callhome.SortCity:
+		return d.City
+	case callhome.SortVersion:
+		return d.Version
+	case callhome.SortServices:
+		return strconv.Itoa(len(d.Services))
+	case callhome.SortDistance:
+		return strconv.FormatFloat(d.Distance, 'g', -1, 64)
+	default:
+		return ""
+	}
 }
 
 // RetrieveAll gets all records from repo.
 func (r repo) RetrieveAll(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	ctx, cancel := withTimeout(ctx, r.cfg.RetrieveTimeout)
+	defer cancel()
+
+	page, err := r.retrieveAll(ctx, pm, filters)
+	return page, timedOut(ctx, err)
+}
+
+func (r repo) retrieveAll(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
 	q := `
 	WITH aggregated_data AS (
-		SELECT ip_address, ARRAY_AGG(DISTINCT service) AS services
+		SELECT ip_address, ARRAY_AGG(DISTINCT service) AS services,
+			MIN(time) AS first_seen, COUNT(DISTINCT service) AS service_count
 		FROM telemetry
 		%s
 		GROUP BY ip_address
 	)
-	SELECT ad.ip_address, ad.services, t.time, t.service_time, t.longitude, t.latitude, t.mg_version, t.country, t.city
-	FROM aggregated_data ad
-	INNER JOIN (
-		SELECT DISTINCT ON (ip_address) *
+	SELECT d.ip_address, d.services, d.first_seen, t.time, t.service_time, t.longitude, t.latitude, t.mg_version, t.country, t.country_code, t.region, t.city, t.postal_code, t.timezone,
+		t.asn, t.as_org, t.provider, t.network_type%s
+	FROM aggregated_data d
+	INNER JOIN LATERAL (
+		SELECT *
 		FROM telemetry
-		ORDER BY ip_address, time DESC
-	) t ON ad.ip_address = t.ip_address
+		WHERE ip_address = d.ip_address
+		ORDER BY time DESC
+		LIMIT 1
+	) t ON true
+	%s
+	ORDER BY %s
 	OFFSET :offset LIMIT :limit;
 	`
-	filterQuery, params := generateQuery(filters)
+	if err := callhome.ValidateSort(pm.Sort, pm.Dir); err != nil {
+		return callhome.TelemetryPage{}, err
+	}
+	if pm.Sort == callhome.SortDistance && filters.Radius == nil {
+		return callhome.TelemetryPage{}, callhome.ErrInvalidSort
+	}
+	col := r.sortColumn(pm.Sort)
+	var distance string
+	if pm.Sort == callhome.SortDistance {
+		distance = fmt.Sprintf(", %s AS distance", col.expr)
+	}
+	dir, cmp := "ASC", ">"
+	if pm.Dir == callhome.DirDesc {
+		dir, cmp = "DESC", "<"
+	}
+	// The IP address breaks ties, so that the order is stable.
+	order := fmt.Sprintf("d.ip_address %s", dir)
+	if pm.Sort != "" {
+		order = fmt.Sprintf("%s %s, %s", col.expr, dir, order)
+	}
 
-	q = fmt.Sprintf(q, filterQuery)
+	filterQuery, params := generateQuery(filters, r.rawSource())
 
-	params["limit"] = pm.Limit
+	var cursorQuery string
+	if pm.Cursor != "" {
+		cursor, err := callhome.DecodeCursor(pm.Cursor)
+		if err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+		if !cursor.Matches(pm.Sort, pm.Dir) {
+			return callhome.TelemetryPage{}, callhome.ErrInvalidCursor
+		}
+		cursorQuery = fmt.Sprintf("WHERE d.ip_address %s :cursor", cmp)
+		if pm.Sort != "" {
+			cursorQuery = fmt.Sprintf("WHERE (%s, d.ip_address) %s (CAST(:cursor_key AS %s), :cursor)", col.expr, cmp, col.cast)
+			params["cursor_key"] = cursor.Key
+		}
+		params["cursor"] = cursor.IpAddress
+	}
+
+	q = fmt.Sprintf(q, filterQuery, distance, cursorQuery, order)
+
+	// One extra row tells whether there is a next page.
+	params["limit"] = pm.Limit + 1
 	params["offset"] = pm.Offset
 
-	rows, err := r.db.NamedQuery(q, params)
+	rows, err := r.reader().NamedQueryContext(ctx, q, params)
 	if err != nil {
 		return callhome.TelemetryPage{}, err
 	}
 	defer rows.Close()
 
-	var results callhome.TelemetryPage
+	results := callhome.TelemetryPage{
+		PageMetadata: callhome.PageMetadata{
+			Offset:    pm.Offset,
+			Limit:     pm.Limit,
+			Cursor:    pm.Cursor,
+			SkipTotal: pm.SkipTotal,
+			Sort:      pm.Sort,
+			Dir:       pm.Dir,
+		},
+	}
 
+	var last deployment
 	for rows.Next() {
-		var result callhome.Telemetry
+		var result deployment
 		if err := rows.StructScan(&result); err != nil {
 			return callhome.TelemetryPage{}, err
 		}
-		results.Telemetry = append(results.Telemetry, result)
+		if uint64(len(results.Telemetry)) == pm.Limit {
+			next := callhome.Cursor{Sort: pm.Sort, Dir: pm.Dir, Key: last.key(pm.Sort), IpAddress: last.IpAddress}
+			if pm.Limit > 0 {
+				results.NextCursor = next.Encode()
+			}
+			break
+		}
+		results.Telemetry = append(results.Telemetry, result.Telemetry)
+		last = result
+	}
+	if err := rows.Err(); err != nil {
+		return callhome.TelemetryPage{}, err
 	}
 
-	q = `
-	SELECT COUNT(*)
-	FROM (
-		SELECT ip_address, ARRAY_AGG(DISTINCT service) AS services
-		FROM telemetry
-		GROUP BY ip_address
-		LIMIT :limit OFFSET :offset
-	) AS subquery;
-	`
-	rows, err = r.db.NamedQuery(q, params)
+	if pm.SkipTotal {
+		return results, nil
+	}
+
+	q = fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) FROM telemetry %s;`, filterQuery)
+	rows, err = r.reader().NamedQueryContext(ctx, q, params)
 	if err != nil {
 		return callhome.TelemetryPage{}, err
 	}
 	defer rows.Close()
 
-	total := uint64(0)
 	if rows.Next() {
-		if err := rows.Scan(&total); err != nil {
-			return results, err
+		if err := rows.Scan(&results.Total); err != nil {
+			return callhome.TelemetryPage{}, err
 		}
 	}
-	results.Total = total
 
 	return results, nil
 }
 
 // Save creates record in repo.
 func (r repo) Save(ctx context.Context, t callhome.Telemetry) error {
+	ctx, cancel := withTimeout(ctx, r.cfg.SaveTimeout)
+	defer cancel()
+
+	return timedOut(ctx, r.save(ctx, t))
+}
+
+func (r repo) save(ctx context.Context, t callhome.Telemetry) error {
 	q := `INSERT INTO telemetry (ip_address, longitude, latitude,
-		mg_version, service, time, country, city, service_time)
+		mg_version, service, time, country, country_code, region, city,
+		postal_code, timezone, asn, as_org, provider, network_type, service_time)
+		VALUES (:ip_address, :longitude, :latitude,
+			:mg_version, :service, :time, :country, :country_code, :region, :city,
+			:postal_code, :timezone, :asn, :as_org, :provider, :network_type, :service_time);`
+	if r.cfg.Spatial {
+		q = `INSERT INTO telemetry (ip_address, longitude, latitude, location,
+		mg_version, service, time, country, country_code, region, city,
+		postal_code, timezone, asn, as_org, provider, network_type, service_time)
 		VALUES (:ip_address, :longitude, :latitude,
-			:mg_version, :service, :time, :country, :city, :service_time);`
+			CAST(ST_SetSRID(ST_MakePoint(:longitude, :latitude), 4326) AS geography),
+			:mg_version, :service, :time, :country, :country_code, :region, :city,
+			:postal_code, :timezone, :asn, :as_org, :provider, :network_type, :service_time);`
+	}
 
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
@@ -117,7 +337,7 @@ func (r repo) Save(ctx context.Context, t callhome.Telemetry) error {
 		}
 	}()
 
-	if _, err := tx.NamedExec(q, t); err != nil {
+	if _, err := tx.NamedExecContext(ctx, q, t); err != nil {
 		if pgErr, ok := err.(*pgconn.PgError); ok {
 			if pgErr.Code == pgerrcode.InvalidTextRepresentation {
 				return errors.Wrap(ErrSaveEvent, ErrInvalidEvent.Error())
@@ -128,101 +348,314 @@ func (r repo) Save(ctx context.Context, t callhome.Telemetry) error {
 	return nil
 }
 
-// RetrieveSummary retrieve distinct.
-func (r repo) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
-	filterQuery, params := generateQuery(filters)
-	var summary callhome.TelemetrySummary
-	q := fmt.Sprintf(`select count(distinct ip_address), country from telemetry %s group by country;`, filterQuery)
-	rows, err := r.db.NamedQuery(q, params)
+// Erase removes records stored under the identifiers and records the erasure.
+func (r repo) Erase(ctx context.Context, receipt callhome.ErasureReceipt, identifiers, blocklist []string) (callhome.ErasureReceipt, error) {
+	receipt, err := r.erase(ctx, receipt, identifiers, blocklist)
 	if err != nil {
-		return callhome.TelemetrySummary{}, err
+		return callhome.ErasureReceipt{}, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var val callhome.CountrySummary
-		if err := rows.StructScan(&val); err != nil {
-			return callhome.TelemetrySummary{}, err
+
+	// Continuous aggregates can't be refreshed inside a transaction. Only
+	// buckets invalidated by the delete are recomputed. The erasure is
+	// committed by now, so a failed refresh is left to the refresh policy
+	// rather than failing it, which would have it retried under a new
+	// receipt.
+	if _, err := r.db.ExecContext(ctx, `CALL refresh_continuous_aggregate('telemetry_daily', NULL, NULL);`); err != nil {
+		r.cfg.Logger.Warn(fmt.Sprintf("failed to refresh the daily aggregate after erasure %s : %s", receipt.ID, err))
+	}
+
+	return receipt, nil
+}
+
+func (r repo) erase(ctx context.Context, receipt callhome.ErasureReceipt, identifiers, blocklist []string) (ret callhome.ErasureReceipt, err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
+	}
+	defer func() {
+		if err != nil {
+			if txErr := tx.Rollback(); txErr != nil {
+				err = errors.Wrap(err, errors.Wrap(ErrTransRollback, txErr.Error()).Error())
+			}
+			return
 		}
-		summary.Countries = append(summary.Countries, val)
+
+		if err = tx.Commit(); err != nil {
+			err = errors.Wrap(ErrEraseEvents, err.Error())
+		}
+	}()
+
+	params := map[string]interface{}{
+		"identifiers": pq.StringArray(identifiers),
+		"all":         allValues,
 	}
-	for _, country := range summary.Countries {
-		summary.TotalDeployments += country.NoDeployments
+	// Remove the contribution of the erased deployments from the history
+	// while the daily aggregate still knows where they were counted.
+	q := `WITH erased AS (
+			SELECT DISTINCT CAST(bucket AT TIME ZONE 'UTC' AS DATE) AS day, ip_address,
+				COALESCE(mg_version, '') AS mg_version, COALESCE(country, '') AS country, COALESCE(service, '') AS service
+			FROM telemetry_daily
+			WHERE ip_address = ANY(:identifiers)
+		), counts AS (
+			SELECT day, v, c, s, COUNT(DISTINCT ip_address) AS n
+			FROM erased, LATERAL (VALUES
+				(mg_version, country, service), (:all, country, service), (mg_version, :all, service), (mg_version, country, :all),
+				(:all, :all, service), (:all, country, :all), (mg_version, :all, :all), (:all, :all, :all)
+			) AS x (v, c, s)
+			GROUP BY day, v, c, s
+		)
+		UPDATE telemetry_history h SET deployments = GREATEST(h.deployments - counts.n, 0)
+		FROM counts
+		WHERE h.day = counts.day AND h.mg_version = counts.v AND h.country = counts.c AND h.service = counts.s;`
+	if _, err = tx.NamedExecContext(ctx, q, params); err != nil {
+		return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
 	}
 
-	q1 := fmt.Sprintf(`select distinct city from telemetry %s;`, filterQuery)
-	cityRows, err := r.db.NamedQuery(q1, params)
+	res, err := tx.NamedExecContext(ctx, `DELETE FROM telemetry WHERE ip_address = ANY(:identifiers);`, params)
 	if err != nil {
-		return callhome.TelemetrySummary{}, err
+		return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
 	}
-	defer cityRows.Close()
-	for cityRows.Next() {
-		var val string
-		if err := cityRows.Scan(&val); err != nil {
-			return callhome.TelemetrySummary{}, err
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
+	}
+	receipt.RecordsRemoved = uint64(removed)
+
+	q = `INSERT INTO erasures (id, subject, records_removed, blocklisted, reason, erased_at)
+		VALUES (:id, :subject, :records_removed, :blocklisted, :reason, :erased_at);`
+	if _, err = tx.NamedExecContext(ctx, q, receipt); err != nil {
+		return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
+	}
+
+	q = `INSERT INTO blocklist (identifier, erasure_id, created_at)
+		VALUES (:identifier, :erasure_id, :created_at)
+		ON CONFLICT (identifier) DO NOTHING;`
+	for _, id := range blocklist {
+		entry := map[string]interface{}{
+			"identifier": id,
+			"erasure_id": receipt.ID,
+			"created_at": receipt.ErasedAt,
+		}
+		if _, err = tx.NamedExecContext(ctx, q, entry); err != nil {
+			return callhome.ErasureReceipt{}, errors.Wrap(ErrEraseEvents, err.Error())
 		}
-		summary.Cities = append(summary.Cities, val)
 	}
 
-	q2 := fmt.Sprintf(`select distinct service from telemetry %s;`, filterQuery)
-	serviceRows, err := r.db.NamedQuery(q2, params)
+	return receipt, nil
+}
+
+// Blocked reports whether any of the identifiers is blocklisted. It's
+// bounded by the save timeout since it's checked before saving events.
+func (r repo) Blocked(ctx context.Context, identifiers ...string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, r.cfg.SaveTimeout)
+	defer cancel()
+
+	blocked, err := r.blocked(ctx, identifiers)
+	return blocked, timedOut(ctx, err)
+}
+
+func (r repo) blocked(ctx context.Context, identifiers []string) (bool, error) {
+	q := `SELECT EXISTS (SELECT 1 FROM blocklist WHERE identifier = ANY(:identifiers));`
+	params := map[string]interface{}{
+		"identifiers": pq.StringArray(identifiers),
+	}
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
 	if err != nil {
-		return callhome.TelemetrySummary{}, err
+		return false, err
 	}
-	defer serviceRows.Close()
-	for serviceRows.Next() {
-		var val string
-		if err := serviceRows.Scan(&val); err != nil {
-			return callhome.TelemetrySummary{}, err
+	defer rows.Close()
+
+	var blocked bool
+	if rows.Next() {
+		if err := rows.Scan(&blocked); err != nil {
+			return false, err
 		}
-		summary.Services = append(summary.Services, val)
 	}
+	return blocked, nil
+}
 
-	q3 := fmt.Sprintf(`select distinct mg_version from telemetry %s;`, filterQuery)
-	versionRows, err := r.db.NamedQuery(q3, params)
-	if err != nil {
-		return callhome.TelemetrySummary{}, err
+// RetrieveSummary retrieve distinct.
+func (r repo) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns, status callhome.StatusConfig, now time.Time) (callhome.TelemetrySummary, error) {
+	ctx, cancel := withTimeout(ctx, r.cfg.SummaryTimeout)
+	defer cancel()
+
+	summary, err := r.retrieveSummary(ctx, filters, breakdowns, status, now)
+	return summary, timedOut(ctx, err)
+}
+
+// RetrieveTimeseries counts distinct deployments per time bucket.
+func (r repo) RetrieveTimeseries(ctx context.Context, filters callhome.TelemetryFilters, interval, split string) ([]callhome.TimeseriesPoint, error) {
+	ctx, cancel := withTimeout(ctx, r.cfg.SummaryTimeout)
+	defer cancel()
+
+	points, err := r.retrieveTimeseries(ctx, filters, interval, split)
+	return points, timedOut(ctx, err)
+}
+
+// RetrieveTransitions reports version transitions of deployments.
+func (r repo) RetrieveTransitions(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TransitionReport, error) {
+	ctx, cancel := withTimeout(ctx, r.cfg.SummaryTimeout)
+	defer cancel()
+
+	report, err := r.retrieveTransitions(ctx, filters)
+	return report, timedOut(ctx, err)
+}
+
+// RetrieveCohorts reports the retention of cohorts of deployments.
+func (r repo) RetrieveCohorts(ctx context.Context, filters callhome.TelemetryFilters, period string) ([]callhome.Cohort, error) {
+	ctx, cancel := withTimeout(ctx, r.cfg.SummaryTimeout)
+	defer cancel()
+
+	cohorts, err := r.retrieveCohorts(ctx, filters, period)
+	return cohorts, timedOut(ctx, err)
+}
+
+// RetrieveServiceSets lists the services of every deployment.
+func (r repo) RetrieveServiceSets(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.DeploymentServices, error) {
+	ctx, cancel := withTimeout(ctx, r.cfg.SummaryTimeout)
+	defer cancel()
+
+	sets, err := r.retrieveServiceSets(ctx, filters)
+	return sets, timedOut(ctx, err)
+}
+
+// withTimeout bounds the context by the timeout of an operation, if any.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-	defer versionRows.Close()
-	for versionRows.Next() {
-		var val string
-		if err := versionRows.Scan(&val); err != nil {
-			return callhome.TelemetrySummary{}, err
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timedOut returns ErrQueryTimeout in place of the error of an operation that
+// ran out of time. Cancelled requests keep their error.
+func timedOut(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return ErrQueryTimeout
+	}
+	return err
+}
+
+// historic reports whether the filters reach past the raw retention period
+// and can be answered from the downsampled history.
+func (r repo) historic(filters callhome.TelemetryFilters) bool {
+	if r.cfg.Retention <= 0 || filters.From.IsZero() || !filters.From.Before(time.Now().Add(-r.cfg.Retention)) {
+		return false
+	}
+	if !filters.City.IsZero() || !filters.Provider.IsZero() || !filters.NetworkType.IsZero() ||
+		filters.BoundingBox != nil || filters.Radius != nil {
+		return false
+	}
+	// The history doesn't keep when deployments were last seen.
+	if filters.LastSeen != nil {
+		return false
+	}
+	// The history keeps one row per value, so only a single exact value
+	// per column can be looked up.
+	for _, f := range []callhome.Filter{filters.Country, filters.Version, filters.Service} {
+		if _, ok := exact(f); !ok {
+			return false
 		}
-		summary.Versions = append(summary.Versions, val)
 	}
-	return summary, nil
+	return true
 }
 
-func generateQuery(filters callhome.TelemetryFilters) (string, map[string]interface{}) {
+// retentionBoundary returns the start of the first bucket of the interval
+// that lies wholly within the raw retention period. Ranges reaching past the
+// retention are read from the history before it and from raw data after it.
+func (r repo) retentionBoundary(interval string) time.Time {
+	start := time.Now().Add(-r.cfg.Retention)
+	boundary := callhome.BucketStart(start, interval)
+	if boundary.Before(start) {
+		boundary = callhome.NextBucket(boundary, interval)
+	}
+	return boundary
+}
+
+func orAll(f callhome.Filter) string {
+	if val, _ := exact(f); val != "" {
+		return val
+	}
+	return allValues
+}
+
+// exact returns the value of a filter matching a single exact value. It
+// reports false for filters matching several values, prefixes or exclusions.
+func exact(f callhome.Filter) (string, bool) {
+	switch {
+	case f.IsZero():
+		return "", true
+	case len(f.Values) == 1 && len(f.Excluded) == 0 && !strings.HasSuffix(f.Values[0], callhome.Wildcard):
+		return f.Values[0], true
+	default:
+		return "", false
+	}
+}
+
+// rawSource returns the source of raw telemetry.
+func (r repo) rawSource() source {
+	if r.cfg.Spatial {
+		return spatialSource
+	}
+	return rawSource
+}
+
+// summarySource returns the source summaries are computed from. The daily
+// continuous aggregate is used when the filter window is aligned to its
+// buckets, and there are no area filters as it doesn't keep coordinates.
+func (r repo) summarySource(filters callhome.TelemetryFilters) source {
+	if aligned(filters.From) && aligned(filters.To) && filters.BoundingBox == nil && filters.Radius == nil {
+		return dailySource
+	}
+	return r.rawSource()
+}
+
+func aligned(t time.Time) bool {
+	return t.IsZero() || t.Equal(t.Truncate(dailyBucket))
+}
+
+func generateQuery(filters callhome.TelemetryFilters, src source) (string, map[string]interface{}) {
 	var queries []string
 	params := make(map[string]interface{})
 
 	if !filters.From.IsZero() {
-		queries = append(queries, "time >= :from")
+		queries = append(queries, src.from)
 		params["from"] = filters.From
 	}
 	if !filters.To.IsZero() {
-		queries = append(queries, "time <= :to")
+		queries = append(queries, src.to)
 		params["to"] = filters.To
 	}
-	if filters.Country != "" {
-		queries = append(queries, "country = :country")
-		params["country"] = filters.Country
-	}
+	queries = appendFilter(queries, params, "country", "country", filters.Country, false)
+	queries = appendFilter(queries, params, "city", "city", filters.City, false)
+	queries = appendFilter(queries, params, "mg_version", "version", filters.Version, true)
+	queries = appendFilter(queries, params, "service", "service", filters.Service, false)
+	queries = appendFilter(queries, params, "provider", "provider", filters.Provider, false)
+	queries = appendFilter(queries, params, "network_type", "network_type", filters.NetworkType, false)
 
-	if filters.City != "" {
-		queries = append(queries, "city = :city")
-		params["city"] = filters.City
+	// The bounding box is compared on the coordinate columns even with
+	// PostGIS, as the edges of a geography box are great circles rather
+	// than parallels.
+	if bb := filters.BoundingBox; bb != nil {
+		queries = append(queries, "latitude BETWEEN :min_lat AND :max_lat")
+		lon := "longitude BETWEEN :min_lon AND :max_lon"
+		if bb.MinLon > bb.MaxLon {
+			lon = "(longitude >= :min_lon OR longitude <= :max_lon)"
+		}
+		queries = append(queries, lon)
+		params["min_lat"] = bb.MinLat
+		params["max_lat"] = bb.MaxLat
+		params["min_lon"] = bb.MinLon
+		params["max_lon"] = bb.MaxLon
 	}
-
-	if filters.Version != "" {
-		queries = append(queries, "mg_version = :version")
-		params["version"] = filters.Version
+	if rd := filters.Radius; rd != nil {
+		queries = append(queries, src.distance)
+		params["lat"] = rd.Lat
+		params["lon"] = rd.Lon
+		params["distance"] = rd.Distance
 	}
-
-	if filters.Service != "" {
-		queries = append(queries, "service = :service")
-		params["service"] = filters.Service
+	if ls := filters.LastSeen; ls != nil {
+		queries = appendLastSeen(queries, params, *ls)
 	}
 
 	switch len(queries) {
@@ -232,3 +665,77 @@ func generateQuery(filters callhome.TelemetryFilters) (string, map[string]interf
 		return fmt.Sprintf("WHERE %s", strings.Join(queries, " AND ")), params
 	}
 }
+
+// appendLastSeen appends the condition on the latest events of deployments to
+// queries. They're found in the raw telemetry, whatever the source.
+func appendLastSeen(queries []string, params map[string]interface{}, ls callhome.TimeRange) []string {
+	var conds []string
+	if !ls.From.IsZero() {
+		conds = append(conds, "MAX(time) >= :last_seen_from")
+		params["last_seen_from"] = ls.From
+	}
+	if !ls.To.IsZero() {
+		conds = append(conds, "MAX(time) < :last_seen_to")
+		params["last_seen_to"] = ls.To
+	}
+	if len(conds) == 0 {
+		return queries
+	}
+	return append(queries, fmt.Sprintf("ip_address IN (SELECT ip_address FROM telemetry GROUP BY ip_address HAVING %s)", strings.Join(conds, " AND ")))
+}
+
+// appendFilter appends the conditions of the filter on the column to queries.
+// Values are always passed as named parameters, prefixed with name. Values
+// ending in the wildcard are matched by prefix when prefix is set.
+func appendFilter(queries []string, params map[string]interface{}, col, name string, f callhome.Filter, prefix bool) []string {
+	values, patterns := splitPatterns(f.Values, prefix)
+	var matches []string
+	if len(values) > 0 {
+		matches = append(matches, fmt.Sprintf("%s = ANY(:%s)", col, name))
+		params[name] = pq.StringArray(values)
+	}
+	if len(patterns) > 0 {
+		matches = append(matches, fmt.Sprintf("%s LIKE ANY(:%s_prefix)", col, name))
+		params[name+"_prefix"] = pq.StringArray(patterns)
+	}
+	switch len(matches) {
+	case 0:
+	case 1:
+		queries = append(queries, matches[0])
+	default:
+		queries = append(queries, fmt.Sprintf("(%s)", strings.Join(matches, " OR ")))
+	}
+
+	values, patterns = splitPatterns(f.Excluded, prefix)
+	if len(values) > 0 {
+		queries = append(queries, fmt.Sprintf("%s <> ALL(:not_%s)", col, name))
+		params["not_"+name] = pq.StringArray(values)
+	}
+	if len(patterns) > 0 {
+		queries = append(queries, fmt.Sprintf("NOT %s LIKE ANY(:not_%s_prefix)", col, name))
+		params["not_"+name+"_prefix"] = pq.StringArray(patterns)
+	}
+	return queries
+}
+
+// splitPatterns separates exact values from prefixes, which are returned as
+// LIKE patterns.
+func splitPatterns(vals []string, prefix bool) ([]string, []string) {
+	var values, patterns []string
+	for _, val := range vals {
+		if prefix && strings.HasSuffix(val, callhome.Wildcard) {
+			patterns = append(patterns, likeEscaper.Replace(strings.TrimSuffix(val, callhome.Wildcard))+"%")
+			continue
+		}
+		values = append(values, val)
+	}
+	return values, patterns
+}
+
+// appendCondition adds a condition to the WHERE clause returned by generateQuery.
+func appendCondition(where, cond string) string {
+	if where == "" {
+		return "WHERE " + cond
+	}
+	return where + " AND " + cond
+}
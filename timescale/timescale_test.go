@@ -14,7 +14,10 @@ import (
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestSave(t *testing.T) {
@@ -41,7 +44,7 @@ func TestSave(t *testing.T) {
 		defer sqlDB.Close()
 		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
 
-		repo := New(sqlxDB)
+		repo := New(sqlxDB, Config{})
 
 		err = repo.Save(ctx, mockTelemetry)
 		assert.NotNil(t, err)
@@ -57,7 +60,7 @@ func TestSave(t *testing.T) {
 		defer sqlDB.Close()
 		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
 
-		repo := New(sqlxDB)
+		repo := New(sqlxDB, Config{})
 
 		err = repo.Save(ctx, mockTelemetry)
 		assert.NotNil(t, err)
@@ -77,7 +80,7 @@ func TestSave(t *testing.T) {
 		defer sqlDB.Close()
 		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
 
-		repo := New(sqlxDB)
+		repo := New(sqlxDB, Config{})
 
 		err = repo.Save(ctx, mockTelemetry)
 		assert.NotNil(t, err)
@@ -93,11 +96,29 @@ func TestSave(t *testing.T) {
 		defer sqlDB.Close()
 		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
 
-		repo := New(sqlxDB)
+		repo := New(sqlxDB, Config{})
 
 		err = repo.Save(ctx, mockTelemetry)
 		assert.Nil(t, err)
 	})
+	t.Run("successful save with location", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO telemetry \(ip_address, longitude, latitude, location,(.*)ST_MakePoint`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{Spatial: true})
+
+		err = repo.Save(ctx, mockTelemetry)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
 }
 
 func TestRetrieveAll(t *testing.T) {
@@ -121,7 +142,7 @@ func TestRetrieveAll(t *testing.T) {
 		defer sqlDB.Close()
 		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
 
-		repo := New(sqlxDB)
+		repo := New(sqlxDB, Config{})
 
 		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
 
@@ -135,7 +156,7 @@ func TestRetrieveAll(t *testing.T) {
 		defer sqlDB.Close()
 		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
 
-		repo := New(sqlxDB)
+		repo := New(sqlxDB, Config{})
 
 		rows := sqlmock.NewRows(
 			[]string{"ip_address", "longitude", "latitude", "mg_version", "service", "time", "country", "city", "service_time"},
@@ -152,4 +173,847 @@ func TestRetrieveAll(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, mTel, tp.Telemetry[0])
 	})
+	t.Run("next cursor", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		rows := sqlmock.NewRows([]string{"ip_address"}).
+			AddRow("192.168.0.2").
+			AddRow("192.168.0.3")
+
+		cursor := callhome.Cursor{Dir: callhome.DirAsc, IpAddress: "192.168.0.1"}.Encode()
+		mock.ExpectQuery(`WHERE d.ip_address > \? ORDER BY d.ip_address ASC`).
+			WithArgs("192.168.0.1", 0, 2).
+			WillReturnRows(rows)
+
+		tp, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 1, Cursor: cursor, SkipTotal: true}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Len(t, tp.Telemetry, 1)
+		assert.Equal(t, callhome.Cursor{IpAddress: "192.168.0.2"}.Encode(), tp.NextCursor)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("sorted by last seen", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		rows := sqlmock.NewRows([]string{"ip_address", "time"}).
+			AddRow("192.168.0.2", now).
+			AddRow("192.168.0.3", now.Add(-time.Hour))
+
+		prev := now.Add(time.Hour).Format(time.RFC3339Nano)
+		pm := callhome.PageMetadata{
+			Limit:     1,
+			SkipTotal: true,
+			Sort:      callhome.SortLastSeen,
+			Dir:       callhome.DirDesc,
+			Cursor:    callhome.Cursor{Sort: callhome.SortLastSeen, Dir: callhome.DirDesc, Key: prev, IpAddress: "192.168.0.1"}.Encode(),
+		}
+		mock.ExpectQuery(`WHERE \(t.time, d.ip_address\) < \(CAST\(\? AS TIMESTAMPTZ\), \?\) ORDER BY t.time DESC, d.ip_address DESC`).
+			WithArgs(prev, "192.168.0.1", 0, 2).
+			WillReturnRows(rows)
+
+		tp, err := repo.RetrieveAll(ctx, pm, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Len(t, tp.Telemetry, 1)
+		next := callhome.Cursor{Sort: callhome.SortLastSeen, Dir: callhome.DirDesc, Key: now.Format(time.RFC3339Nano), IpAddress: "192.168.0.2"}
+		assert.Equal(t, next.Encode(), tp.NextCursor)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("cursor of another sort order", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		cursor := callhome.Cursor{Dir: callhome.DirAsc, IpAddress: "192.168.0.1"}.Encode()
+		_, err = repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10, Cursor: cursor, Sort: callhome.SortCity}, callhome.TelemetryFilters{})
+		assert.Equal(t, callhome.ErrInvalidCursor, err)
+	})
+	t.Run("invalid sort", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		_, err = repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10, Sort: "ip_address; DROP TABLE telemetry"}, callhome.TelemetryFilters{})
+		assert.Equal(t, callhome.ErrInvalidSort, err)
+	})
+	t.Run("sorted by distance", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{Spatial: true})
+
+		rows := sqlmock.NewRows([]string{"ip_address", "distance"}).
+			AddRow("192.168.0.2", 12.5).
+			AddRow("192.168.0.3", 40.0)
+
+		mock.ExpectQuery(`(?s)FROM telemetry\s+WHERE ST_DWithin\(location, (.*)GROUP BY ip_address(.*)ST_Distance\(t.location, (.*)\) / 1000 AS distance\s+FROM aggregated_data(.*)ORDER BY ST_Distance`).
+			WillReturnRows(rows)
+
+		pm := callhome.PageMetadata{Limit: 1, SkipTotal: true, Sort: callhome.SortDistance}
+		filters := callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.86, Lon: 2.35, Distance: 200}}
+		tp, err := repo.RetrieveAll(ctx, pm, filters)
+		assert.Nil(t, err)
+		assert.Len(t, tp.Telemetry, 1)
+		next := callhome.Cursor{Sort: callhome.SortDistance, Key: "12.5", IpAddress: "192.168.0.2"}
+		assert.Equal(t, next.Encode(), tp.NextCursor)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("filtered query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		distance := func(lat, lon string) string {
+			return fmt.Sprintf(`2 * 6371 * ASIN(LEAST(1, SQRT(
+				POWER(SIN(RADIANS(%[1]s - ?) / 2), 2) +
+				COS(RADIANS(?)) * COS(RADIANS(%[1]s)) * POWER(SIN(RADIANS(%[2]s - ?) / 2), 2)
+			)))`, lat, lon)
+		}
+		q := `
+		WITH aggregated_data AS (
+			SELECT ip_address, ARRAY_AGG(DISTINCT service) AS services,
+				MIN(time) AS first_seen, COUNT(DISTINCT service) AS service_count
+			FROM telemetry
+			WHERE time >= ? AND country = ANY(?) AND mg_version LIKE ANY(?) AND ` + distance("latitude", "longitude") + ` <= ?
+				AND ip_address IN (SELECT ip_address FROM telemetry GROUP BY ip_address HAVING MAX(time) >= ?)
+			GROUP BY ip_address
+		)
+		SELECT d.ip_address, d.services, d.first_seen, t.time, t.service_time, t.longitude, t.latitude, t.mg_version, t.country, t.country_code, t.region, t.city, t.postal_code, t.timezone,
+			t.asn, t.as_org, t.provider, t.network_type, ` + distance("t.latitude", "t.longitude") + ` AS distance
+		FROM aggregated_data d
+		INNER JOIN LATERAL (
+			SELECT *
+			FROM telemetry
+			WHERE ip_address = d.ip_address
+			ORDER BY time DESC
+			LIMIT 1
+		) t ON true
+		WHERE (` + distance("t.latitude", "t.longitude") + `, d.ip_address) > (CAST(? AS DOUBLE PRECISION), ?)
+		ORDER BY ` + distance("t.latitude", "t.longitude") + ` ASC, d.ip_address ASC
+		OFFSET ? LIMIT ?;`
+		mock.ExpectQuery(q).WillReturnRows(sqlmock.NewRows([]string{"ip_address"}))
+
+		from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		pm := callhome.PageMetadata{
+			Limit:     10,
+			SkipTotal: true,
+			Sort:      callhome.SortDistance,
+			Cursor:    callhome.Cursor{Sort: callhome.SortDistance, Key: "12.5", IpAddress: "192.168.0.1"}.Encode(),
+		}
+		filters := callhome.TelemetryFilters{
+			From:     from,
+			Country:  callhome.Filter{Values: []string{"France"}},
+			Version:  callhome.Filter{Values: []string{"0.14.*"}},
+			Radius:   &callhome.Radius{Lat: 48.86, Lon: 2.35, Distance: 200},
+			LastSeen: &callhome.TimeRange{From: from},
+		}
+		_, err = repo.RetrieveAll(ctx, pm, filters)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("sorted by distance without radius", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		_, err = repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10, Sort: callhome.SortDistance}, callhome.TelemetryFilters{})
+		assert.Equal(t, callhome.ErrInvalidSort, err)
+	})
+	t.Run("invalid cursor", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		_, err = repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10, Cursor: "invalid"}, callhome.TelemetryFilters{})
+		assert.Equal(t, callhome.ErrInvalidCursor, err)
+	})
+}
+
+func TestErase(t *testing.T) {
+	ctx := context.TODO()
+	receipt := callhome.ErasureReceipt{
+		ID:          "123e4567-e89b-12d3-a456-000000000001",
+		Subject:     callhome.SubjectIPAddress,
+		Blocklisted: true,
+		ErasedAt:    time.Now(),
+	}
+	t.Run("failed delete", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE telemetry_history").WillReturnResult(sqlmock.NewResult(0, 8))
+		mock.ExpectExec("DELETE FROM telemetry").WillReturnError(fmt.Errorf("failed delete"))
+		mock.ExpectRollback()
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		_, err = repo.Erase(ctx, receipt, []string{"192.168.0.1"}, []string{"hmac:01"})
+		assert.NotNil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("successful erase", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE telemetry_history").WillReturnResult(sqlmock.NewResult(0, 8))
+		mock.ExpectExec("DELETE FROM telemetry").WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("INSERT INTO erasures").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO blocklist").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec("CALL refresh_continuous_aggregate").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		res, err := repo.Erase(ctx, receipt, []string{"192.168.0.1"}, []string{"hmac:01"})
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(3), res.RecordsRemoved)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("failed refresh", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE telemetry_history").WillReturnResult(sqlmock.NewResult(0, 8))
+		mock.ExpectExec("DELETE FROM telemetry").WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("INSERT INTO erasures").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO blocklist").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec("CALL refresh_continuous_aggregate").WillReturnError(fmt.Errorf("failed refresh"))
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB, Config{})
+
+		// The erasure is committed, so its receipt is returned.
+		res, err := repo.Erase(ctx, receipt, []string{"192.168.0.1"}, []string{"hmac:01"})
+		assert.Nil(t, err)
+		assert.Equal(t, receipt.ID, res.ID)
+		assert.Equal(t, uint64(3), res.RecordsRemoved)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrieveSummary(t *testing.T) {
+	ctx := context.TODO()
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		table   string
+	}{
+		{"no time filter", callhome.TelemetryFilters{Country: callhome.Match("Kenya")}, "telemetry_daily"},
+		{"bounding box", callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: -5, MaxLat: 5, MinLon: 30, MaxLon: 40}}, "telemetry "},
+		{"aligned window", callhome.TelemetryFilters{From: day, To: day.Add(48 * time.Hour)}, "telemetry_daily"},
+		{"unaligned from", callhome.TelemetryFilters{From: day.Add(time.Hour)}, "telemetry "},
+		{"unaligned to", callhome.TelemetryFilters{From: day, To: day.Add(time.Minute)}, "telemetry "},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			assert.Nil(t, err)
+
+			defer sqlDB.Close()
+			sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+			repo := New(sqlxDB, Config{})
+
+			cols := []string{"grouping", "country", "city", "service", "mg_version", "network_type", "provider", "count"}
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM " + c.table + " .*GROUP BY GROUPING SETS \\(\\(\\), \\(country\\), \\(country, city\\), \\(service\\), \\(mg_version\\), \\(network_type, provider\\)\\)").
+				WillReturnRows(sqlmock.NewRows(cols).
+					AddRow(grouping(summaryColumns), nil, nil, nil, nil, nil, nil, 2).
+					AddRow(grouping(summaryColumns, "country"), "Kenya", nil, nil, nil, nil, nil, 2).
+					AddRow(grouping(summaryColumns, "country", "city"), "Kenya", "Nairobi", nil, nil, nil, nil, 2).
+					AddRow(grouping(summaryColumns, "network_type", "provider"), nil, nil, nil, nil, "cloud", "AWS", 2).
+					AddRow(grouping(summaryColumns, "service"), nil, nil, "things", nil, nil, nil, 1).
+					AddRow(grouping(summaryColumns, "mg_version"), nil, nil, nil, "0.14", nil, nil, 1))
+			mock.ExpectQuery("WITH matching AS").WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).AddRow("active", 2))
+			mock.ExpectRollback()
+
+			summary, err := repo.RetrieveSummary(ctx, c.filters, nil, statusCfg, time.Now())
+			assert.Nil(t, err)
+			assert.Equal(t, 2, summary.TotalDeployments)
+			assert.Equal(t, []callhome.CountrySummary{{Country: "Kenya", NoDeployments: 2}}, summary.Countries)
+			assert.Equal(t, []callhome.CitySummary{{Country: "Kenya", City: "Nairobi", NoDeployments: 2}}, summary.Cities)
+			assert.Equal(t, []callhome.ServiceSummary{{Service: "things", NoDeployments: 1}}, summary.Services)
+			assert.Equal(t, []callhome.VersionSummary{{Version: "0.14", NoDeployments: 1}}, summary.Versions)
+			assert.Equal(t, []callhome.ProviderSummary{{NetworkType: "cloud", Provider: "AWS", NoDeployments: 2}}, summary.Providers)
+			assert.Equal(t, []callhome.StatusSummary{{Status: callhome.StatusActive, NoDeployments: 2}}, summary.Statuses)
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+	// Postgres only accepts the columns of the grouping sets in the select
+	// list, GROUPING() and ORDER BY, so the full queries are asserted.
+	selected := []struct {
+		desc       string
+		breakdowns callhome.Breakdowns
+		query      string
+		rows       *sqlmock.Rows
+		summary    callhome.TelemetrySummary
+	}{
+		{
+			desc:       "selected breakdowns",
+			breakdowns: callhome.Breakdowns{callhome.BreakdownServices, callhome.BreakdownVersions},
+			query: `SELECT GROUPING(service, mg_version) AS grouping, NULL AS country, NULL AS city, service, mg_version, NULL AS network_type, NULL AS provider, COUNT(DISTINCT ip_address) AS count
+				FROM telemetry_daily
+				GROUP BY GROUPING SETS ((), (service), (mg_version))
+				ORDER BY count DESC, service, mg_version;`,
+			rows: sqlmock.NewRows([]string{"grouping", "service", "mg_version", "count"}).
+				AddRow(3, nil, nil, 3).
+				AddRow(1, "users", nil, 3).
+				AddRow(2, nil, "0.14", 2).
+				AddRow(2, nil, "0.13", 1),
+			summary: callhome.TelemetrySummary{
+				TotalDeployments: 3,
+				Services:         []callhome.ServiceSummary{{Service: "users", NoDeployments: 3}},
+				Versions:         []callhome.VersionSummary{{Version: "0.14", NoDeployments: 2}, {Version: "0.13", NoDeployments: 1}},
+			},
+		},
+		{
+			desc:       "countries",
+			breakdowns: callhome.Breakdowns{callhome.BreakdownCountries},
+			query: `SELECT GROUPING(country) AS grouping, country, NULL AS city, NULL AS service, NULL AS mg_version, NULL AS network_type, NULL AS provider, COUNT(DISTINCT ip_address) AS count
+				FROM telemetry_daily
+				GROUP BY GROUPING SETS ((), (country))
+				ORDER BY count DESC, country;`,
+			rows: sqlmock.NewRows([]string{"grouping", "country", "count"}).
+				AddRow(1, nil, 4).
+				AddRow(0, "Serbia", 3).
+				AddRow(0, "Kenya", 1),
+			summary: callhome.TelemetrySummary{
+				TotalDeployments: 4,
+				Countries:        []callhome.CountrySummary{{Country: "Serbia", NoDeployments: 3}, {Country: "Kenya", NoDeployments: 1}},
+			},
+		},
+	}
+	for _, c := range selected {
+		t.Run(c.desc, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			assert.Nil(t, err)
+
+			defer sqlDB.Close()
+			repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{})
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(c.query).WillReturnRows(c.rows)
+			mock.ExpectRollback()
+
+			summary, err := repo.RetrieveSummary(ctx, callhome.TelemetryFilters{}, c.breakdowns, statusCfg, time.Now())
+			assert.Nil(t, err)
+			assert.Equal(t, c.summary, summary)
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRetrieveHistorySummary(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.TODO(), "test")
+	defer span.End()
+
+	sqlDB, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	defer sqlDB.Close()
+	sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+	repo := New(sqlxDB, Config{Retention: 90 * 24 * time.Hour})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COALESCE(.*) FROM telemetry_history").WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(6))
+	mock.ExpectQuery("GROUP BY country").
+		WillReturnRows(sqlmock.NewRows([]string{"country", "count"}).AddRow("Kenya", 4).AddRow("France", 3))
+	mock.ExpectQuery("GROUP BY service").WillReturnRows(sqlmock.NewRows([]string{"service", "count"}).AddRow("things", 5))
+	mock.ExpectQuery("GROUP BY mg_version").WillReturnRows(sqlmock.NewRows([]string{"mg_version", "count"}).AddRow("0.13", 6))
+	// Days from the retention boundary on are summarised from the daily aggregate.
+	boundary := time.Now().Add(-90 * 24 * time.Hour).UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	mock.ExpectQuery(`(?s)FROM telemetry_daily WHERE bucket >= \?(.*)GROUP BY GROUPING SETS`).
+		WithArgs(boundary, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"grouping", "country", "count"}).
+			AddRow(grouping(summaryColumns), nil, 7).
+			AddRow(grouping(summaryColumns, "country"), "Serbia", 5).
+			AddRow(grouping(summaryColumns, "country"), "Kenya", 2))
+	// Statuses only depend on the latest events, which are never past the
+	// retention.
+	mock.ExpectQuery("WITH matching AS").WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).AddRow("dormant", 7))
+	mock.ExpectRollback()
+
+	filters := callhome.TelemetryFilters{From: time.Now().AddDate(-1, 0, 0), Version: callhome.Match("0.13")}
+	summary, err := repo.RetrieveSummary(ctx, filters, nil, statusCfg, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 7, summary.TotalDeployments)
+	assert.Equal(t, []callhome.CountrySummary{
+		{Country: "Serbia", NoDeployments: 5},
+		{Country: "Kenya", NoDeployments: 4},
+		{Country: "France", NoDeployments: 3},
+	}, summary.Countries)
+	assert.Equal(t, []callhome.VersionSummary{{Version: "0.13", NoDeployments: 6}}, summary.Versions)
+	assert.Equal(t, []callhome.StatusSummary{{Status: callhome.StatusDormant, NoDeployments: 7}}, summary.Statuses)
+	assert.Empty(t, summary.Cities)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var spans []string
+	for _, s := range recorder.Ended() {
+		spans = append(spans, s.Name())
+	}
+	assert.Equal(t, []string{summaryTotalOp, summaryCountriesOp, summaryServicesOp, summaryVersionsOp, summaryGroupedOp, summaryStatusesOp}, spans)
+}
+
+func TestRetrieveTimeseries(t *testing.T) {
+	// The series of the last week are within the retention period.
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -7)
+	cases := []struct {
+		desc     string
+		filters  callhome.TelemetryFilters
+		interval string
+		split    string
+		query    string
+	}{
+		{
+			desc:     "hourly from raw telemetry",
+			filters:  callhome.TelemetryFilters{From: day},
+			interval: callhome.IntervalHour,
+			query:    `(?s)time_bucket\(INTERVAL '1 hour', time\) AS bucket, '' AS value(.*)FROM telemetry WHERE time >= \?`,
+		},
+		{
+			desc:     "daily from the daily aggregate",
+			filters:  callhome.TelemetryFilters{From: day},
+			interval: callhome.IntervalDay,
+			split:    callhome.SplitVersion,
+			query:    `(?s)time_bucket\(INTERVAL '1 day', bucket\) AS bucket, mg_version AS value(.*)FROM telemetry_daily WHERE bucket >= \?(.*)GROUP BY 1, 2`,
+		},
+		{
+			desc:     "weekly from raw telemetry of an unaligned window",
+			filters:  callhome.TelemetryFilters{From: day.Add(time.Hour)},
+			interval: callhome.IntervalWeek,
+			split:    callhome.SplitCountry,
+			query:    `(?s)time_bucket\(INTERVAL '1 week', time\) AS bucket, country AS value(.*)FROM telemetry WHERE`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			assert.Nil(t, err)
+			defer sqlDB.Close()
+			repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{Retention: 90 * 24 * time.Hour})
+
+			mock.ExpectQuery(c.query).
+				WillReturnRows(sqlmock.NewRows([]string{"bucket", "value", "count"}).AddRow(day, "0.13", 3))
+			points, err := repo.RetrieveTimeseries(context.TODO(), c.filters, c.interval, c.split)
+			assert.Nil(t, err)
+			assert.Equal(t, []callhome.TimeseriesPoint{{Time: day, Value: "0.13", NoDeployments: 3}}, points)
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("monthly from the history and the daily aggregate", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+		repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{Retention: 90 * 24 * time.Hour})
+
+		// The first month wholly within the retention period is read from raw data.
+		boundary := callhome.NextBucket(callhome.BucketStart(time.Now().Add(-90*24*time.Hour), callhome.IntervalMonth), callhome.IntervalMonth)
+		old := boundary.AddDate(0, -1, 0)
+		mock.ExpectQuery(`(?s)time_bucket\(INTERVAL '1 month', day\) AS bucket, service AS value, MAX\(deployments\)(.*)FROM telemetry_history WHERE day >= CAST\(\? AS DATE\) AND day < CAST\(\? AS DATE\)(.*)mg_version = \?(.*)service <> \?`).
+			WillReturnRows(sqlmock.NewRows([]string{"bucket", "value", "count"}).AddRow(old, "things", 4))
+		mock.ExpectQuery(`(?s)time_bucket\(INTERVAL '1 month', bucket\) AS bucket, service AS value, COUNT\(DISTINCT ip_address\)(.*)FROM telemetry_daily WHERE bucket >= \?`).
+			WithArgs(boundary, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"bucket", "value", "count"}).AddRow(boundary, "things", 3))
+
+		filters := callhome.TelemetryFilters{From: time.Now().AddDate(-1, 0, 0), Version: callhome.Match("0.13")}
+		points, err := repo.RetrieveTimeseries(context.TODO(), filters, callhome.IntervalMonth, callhome.SplitService)
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.TimeseriesPoint{
+			{Time: old, Value: "things", NoDeployments: 4},
+			{Time: boundary, Value: "things", NoDeployments: 3},
+		}, points)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid interval", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+		repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{})
+
+		_, err = repo.RetrieveTimeseries(context.TODO(), callhome.TelemetryFilters{}, "fortnight", "")
+		assert.Equal(t, callhome.ErrInvalidInterval, err)
+	})
+}
+
+func TestRetrieveTransitions(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer sqlDB.Close()
+	repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{})
+
+	cols := []string{"grouping", "from_version", "to_version", "count", "median"}
+	mock.ExpectQuery(`(?s)LAG\(mg_version\) OVER \(PARTITION BY ip_address, service ORDER BY time\)(.*)FROM telemetry WHERE country = ANY\(\?\)` +
+		`(.*)MIN\(day\) AS day FROM telemetry_history(.*)CAST\(d.day AS TIMESTAMP\)` +
+		`(.*)WHERE CAST\(string_to_array\(substring\(e.previous (.*) < CAST\(string_to_array\(substring\(e.mg_version (.*)e.time >= \?` +
+		`(.*)GROUP BY GROUPING SETS \(\(previous, mg_version\), \(\)\)`).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(3, nil, nil, 3, 12600.0).
+			AddRow(0, "0.14.1", "0.15.0", 2, 9000.0).
+			AddRow(0, "0.13.1", "0.14.1", 1, 25200.0))
+
+	filters := callhome.TelemetryFilters{From: time.Now().Add(-time.Hour), Country: callhome.Match("Serbia")}
+	report, err := repo.RetrieveTransitions(context.TODO(), filters)
+	assert.Nil(t, err)
+	assert.Equal(t, callhome.TransitionReport{
+		Transitions: []callhome.VersionTransition{
+			{From: "0.14.1", To: "0.15.0", NoDeployments: 2, MedianAdoption: 150 * time.Minute},
+			{From: "0.13.1", To: "0.14.1", NoDeployments: 1, MedianAdoption: 7 * time.Hour},
+		},
+		NoDeployments:  3,
+		MedianAdoption: 210 * time.Minute,
+	}, report)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetrieveCohorts(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer sqlDB.Close()
+	repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{})
+
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 0, 7)
+	mock.ExpectQuery(`(?s)time_bucket\(INTERVAL '1 week', time\) AS period(.*)FROM telemetry WHERE time <= \? AND country = ANY\(\?\)(.*)HAVING MIN\(first_time\) >= \?`).
+		WillReturnRows(sqlmock.NewRows([]string{"cohort", "period", "count"}).
+			AddRow(first, first, 2).
+			AddRow(first, second, 1).
+			AddRow(second, second, 1))
+
+	filters := callhome.TelemetryFilters{From: first, To: second.Add(time.Hour), Country: callhome.Match("Serbia")}
+	cohorts, err := repo.RetrieveCohorts(context.TODO(), filters, callhome.IntervalWeek)
+	assert.Nil(t, err)
+	assert.Equal(t, []callhome.Cohort{
+		{Start: first, NoDeployments: 2, Retention: []float64{1, 0.5}},
+		{Start: second, NoDeployments: 1, Retention: []float64{1}},
+	}, cohorts)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetrieveCohortsRetention(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer sqlDB.Close()
+	repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{Retention: 90 * 24 * time.Hour})
+
+	// The first month partly outside the retention period is left out.
+	start := time.Now().Add(-90 * 24 * time.Hour)
+	boundary := callhome.NextBucket(callhome.BucketStart(start, callhome.IntervalMonth), callhome.IntervalMonth)
+	mock.ExpectQuery(`(?s)time_bucket\(INTERVAL '1 month', bucket\) AS period(.*)FROM telemetry_daily(.*)HAVING MIN\(first_time\) >= \?`).
+		WithArgs(boundary).
+		WillReturnRows(sqlmock.NewRows([]string{"cohort", "period", "count"}))
+
+	_, err = repo.RetrieveCohorts(context.TODO(), callhome.TelemetryFilters{}, callhome.IntervalMonth)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetrieveServiceSets(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer sqlDB.Close()
+	repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{})
+
+	mock.ExpectQuery(`(?s)ARRAY_AGG\(DISTINCT service ORDER BY service\) AS services(.*)FROM telemetry_daily WHERE country = ANY\(\?\)(.*)GROUP BY ip_address`).
+		WillReturnRows(sqlmock.NewRows([]string{"ip_address", "services"}).
+			AddRow("10.0.0.1", "{things,users}").
+			AddRow("10.0.0.2", "{users}"))
+
+	sets, err := repo.RetrieveServiceSets(context.TODO(), callhome.TelemetryFilters{Country: callhome.Match("Serbia")})
+	assert.Nil(t, err)
+	assert.Equal(t, []callhome.DeploymentServices{
+		{IpAddress: "10.0.0.1", Services: []string{"things", "users"}},
+		{IpAddress: "10.0.0.2", Services: []string{"users"}},
+	}, sets)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+// statusCfg classifies deployments in the summaries.
+var statusCfg = callhome.StatusConfig{StaleAfter: 24 * time.Hour, DormantAfter: 48 * time.Hour, ChurnedAfter: 72 * time.Hour}
+
+func TestRetrieveStatuses(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer sqlDB.Close()
+	repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{})
+
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	// Statuses are classified within the snapshot of the summary.
+	mock.ExpectBegin()
+	mock.ExpectQuery("GROUP BY GROUPING SETS \\(\\(\\)\\)").WillReturnRows(sqlmock.NewRows([]string{"grouping", "count"}).AddRow(0, 4))
+	mock.ExpectQuery(`(?s)SELECT DISTINCT ip_address FROM telemetry_daily WHERE country = ANY\(\?\)(.*)FROM telemetry t JOIN matching m(.*)WHEN time >= \? THEN 'active'(.*)GROUP BY 1`).
+		WithArgs(sqlmock.AnyArg(), now.Add(-24*time.Hour), now.Add(-48*time.Hour), now.Add(-72*time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).
+			AddRow("active", 3).
+			AddRow("churned", 1))
+	mock.ExpectRollback()
+
+	filters := callhome.TelemetryFilters{Country: callhome.Match("Serbia")}
+	summary, err := repo.RetrieveSummary(context.TODO(), filters, callhome.Breakdowns{callhome.BreakdownStatuses}, statusCfg, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, summary.TotalDeployments)
+	assert.Equal(t, []callhome.StatusSummary{
+		{Status: callhome.StatusActive, NoDeployments: 3},
+		{Status: callhome.StatusChurned, NoDeployments: 1},
+	}, summary.Statuses)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestLastSeenFilter(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer sqlDB.Close()
+	repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{})
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`(?s)ip_address IN \(SELECT ip_address FROM telemetry GROUP BY ip_address HAVING MAX\(time\) >= \?\)`).
+		WithArgs(from, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"ip_address"}))
+
+	_, err = repo.RetrieveAll(context.TODO(), callhome.PageMetadata{Limit: 10, SkipTotal: true}, callhome.TelemetryFilters{LastSeen: &callhome.TimeRange{From: from}})
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestReader(t *testing.T) {
+	ctx := context.TODO()
+	primaryDB, primaryMock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer primaryDB.Close()
+	replicaDB, replicaMock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer replicaDB.Close()
+
+	replica := sqlx.NewDb(replicaDB, "sqlmock")
+	repo := New(sqlx.NewDb(primaryDB, "sqlmock"), Config{Reader: func() *sqlx.DB { return replica }})
+
+	replicaMock.ExpectQuery("SELECT d.ip_address").
+		WillReturnRows(sqlmock.NewRows([]string{"ip_address"}).AddRow("192.168.0.1"))
+	_, err = repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10, SkipTotal: true}, callhome.TelemetryFilters{})
+	assert.Nil(t, err)
+
+	replicaMock.ExpectBegin()
+	replicaMock.ExpectQuery("GROUPING SETS").WillReturnRows(sqlmock.NewRows([]string{"grouping", "count"}).AddRow(grouping(summaryColumns), 1))
+	replicaMock.ExpectQuery("WITH matching AS").WillReturnRows(sqlmock.NewRows([]string{"status", "count"}))
+	replicaMock.ExpectRollback()
+	_, err = repo.RetrieveSummary(ctx, callhome.TelemetryFilters{}, nil, statusCfg, time.Now())
+	assert.Nil(t, err)
+
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectExec("INSERT INTO telemetry").WillReturnResult(sqlmock.NewResult(0, 1))
+	primaryMock.ExpectCommit()
+	assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "192.168.0.1"}))
+
+	assert.Nil(t, replicaMock.ExpectationsWereMet())
+	assert.Nil(t, primaryMock.ExpectationsWereMet())
+}
+
+func TestTimeout(t *testing.T) {
+	cfg := Config{SaveTimeout: 10 * time.Millisecond, RetrieveTimeout: 10 * time.Millisecond, SummaryTimeout: 10 * time.Millisecond}
+	t.Run("retrieve timed out", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+		repo := New(sqlx.NewDb(sqlDB, "sqlmock"), cfg)
+
+		mock.ExpectQuery("SELECT d.ip_address").WillDelayFor(time.Second).
+			WillReturnRows(sqlmock.NewRows([]string{"ip_address"}))
+		_, err = repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+		assert.Equal(t, ErrQueryTimeout, err)
+	})
+	t.Run("summary timed out", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+		repo := New(sqlx.NewDb(sqlDB, "sqlmock"), cfg)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("GROUPING SETS").WillDelayFor(time.Second).
+			WillReturnRows(sqlmock.NewRows([]string{"grouping", "count"}))
+		_, err = repo.RetrieveSummary(context.Background(), callhome.TelemetryFilters{}, nil, statusCfg, time.Now())
+		assert.Equal(t, ErrQueryTimeout, err)
+	})
+	t.Run("save timed out", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+		repo := New(sqlx.NewDb(sqlDB, "sqlmock"), cfg)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO telemetry").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectRollback()
+		err = repo.Save(context.Background(), callhome.Telemetry{IpAddress: "192.168.0.1"})
+		assert.Equal(t, ErrQueryTimeout, err)
+	})
+	t.Run("request cancelled", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+		repo := New(sqlx.NewDb(sqlDB, "sqlmock"), Config{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = repo.RetrieveSummary(ctx, callhome.TelemetryFilters{}, nil, statusCfg, time.Now())
+		assert.NotNil(t, err)
+		assert.NotEqual(t, ErrQueryTimeout, err)
+	})
+}
+
+func TestGenerateQuery(t *testing.T) {
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		query   string
+		params  map[string]interface{}
+	}{
+		{
+			desc:    "no filters",
+			filters: callhome.TelemetryFilters{},
+			query:   "",
+			params:  map[string]interface{}{},
+		},
+		{
+			desc:    "multiple values",
+			filters: callhome.TelemetryFilters{Country: callhome.Match("Kenya", "France")},
+			query:   "WHERE country = ANY(:country)",
+			params:  map[string]interface{}{"country": pq.StringArray{"Kenya", "France"}},
+		},
+		{
+			desc:    "version prefix",
+			filters: callhome.TelemetryFilters{Version: callhome.Match("0.14.*", "0.13.2")},
+			query:   "WHERE (mg_version = ANY(:version) OR mg_version LIKE ANY(:version_prefix))",
+			params: map[string]interface{}{
+				"version":        pq.StringArray{"0.13.2"},
+				"version_prefix": pq.StringArray{"0.14.%"},
+			},
+		},
+		{
+			desc:    "prefix with LIKE wildcards",
+			filters: callhome.TelemetryFilters{Version: callhome.Match("0_1%*")},
+			query:   "WHERE mg_version LIKE ANY(:version_prefix)",
+			params:  map[string]interface{}{"version_prefix": pq.StringArray{`0\_1\%%`}},
+		},
+		{
+			desc:    "prefix only on version",
+			filters: callhome.TelemetryFilters{City: callhome.Match("Nai*")},
+			query:   "WHERE city = ANY(:city)",
+			params:  map[string]interface{}{"city": pq.StringArray{"Nai*"}},
+		},
+		{
+			desc: "negation",
+			filters: callhome.TelemetryFilters{
+				Country: callhome.Filter{Excluded: []string{"Kenya"}},
+				Version: callhome.Filter{Excluded: []string{"0.13.*"}},
+			},
+			query: "WHERE country <> ALL(:not_country) AND NOT mg_version LIKE ANY(:not_version_prefix)",
+			params: map[string]interface{}{
+				"not_country":        pq.StringArray{"Kenya"},
+				"not_version_prefix": pq.StringArray{"0.13.%"},
+			},
+		},
+		{
+			desc:    "bounding box",
+			filters: callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: 40, MinLon: -5, MaxLat: 52, MaxLon: 10}},
+			query:   "WHERE latitude BETWEEN :min_lat AND :max_lat AND longitude BETWEEN :min_lon AND :max_lon",
+			params:  map[string]interface{}{"min_lat": 40.0, "min_lon": -5.0, "max_lat": 52.0, "max_lon": 10.0},
+		},
+		{
+			desc:    "bounding box across the antimeridian",
+			filters: callhome.TelemetryFilters{BoundingBox: &callhome.BoundingBox{MinLat: -50, MinLon: 170, MaxLat: -30, MaxLon: -170}},
+			query:   "WHERE latitude BETWEEN :min_lat AND :max_lat AND (longitude >= :min_lon OR longitude <= :max_lon)",
+			params:  map[string]interface{}{"min_lat": -50.0, "min_lon": 170.0, "max_lat": -30.0, "max_lon": -170.0},
+		},
+		{
+			desc:    "radius",
+			filters: callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.86, Lon: 2.35, Distance: 200}},
+			query:   "WHERE " + rawSource.distance,
+			params:  map[string]interface{}{"lat": 48.86, "lon": 2.35, "distance": 200.0},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			query, params := generateQuery(c.filters, rawSource)
+			assert.Equal(t, c.query, query)
+			assert.Equal(t, c.params, params)
+		})
+	}
+
+	t.Run("radius with PostGIS", func(t *testing.T) {
+		filters := callhome.TelemetryFilters{Radius: &callhome.Radius{Lat: 48.86, Lon: 2.35, Distance: 200}}
+		query, _ := generateQuery(filters, spatialSource)
+		assert.Equal(t, "WHERE ST_DWithin(location, CAST(ST_SetSRID(ST_MakePoint(:lon, :lat), 4326) AS geography), CAST(:distance AS DOUBLE PRECISION) * 1000)", query)
+	})
+}
+
+func TestHistoric(t *testing.T) {
+	r := repo{cfg: Config{Retention: 24 * time.Hour}}
+	old := time.Now().AddDate(0, 0, -7)
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		want    bool
+	}{
+		{"recent", callhome.TelemetryFilters{From: time.Now()}, false},
+		{"single value", callhome.TelemetryFilters{From: old, Version: callhome.Match("0.14")}, true},
+		{"multiple values", callhome.TelemetryFilters{From: old, Country: callhome.Match("Kenya", "France")}, false},
+		{"prefix", callhome.TelemetryFilters{From: old, Version: callhome.Match("0.14.*")}, false},
+		{"negation", callhome.TelemetryFilters{From: old, Service: callhome.Filter{Excluded: []string{"bootstrap"}}}, false},
+		{"city", callhome.TelemetryFilters{From: old, City: callhome.Match("Nairobi")}, false},
+		{"last seen", callhome.TelemetryFilters{From: old, LastSeen: &callhome.TimeRange{To: time.Now()}}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.Equal(t, c.want, r.historic(c.filters))
+		})
+	}
 }
@@ -0,0 +1,122 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/absmach/callhome"
+)
+
+// bucketWidths map the intervals of a time series onto time_bucket widths.
+// Buckets are aligned in UTC, weeks start on Monday.
+var bucketWidths = map[string]string{
+	callhome.IntervalHour:  "1 hour",
+	callhome.IntervalDay:   "1 day",
+	callhome.IntervalWeek:  "1 week",
+	callhome.IntervalMonth: "1 month",
+}
+
+// splitColumns map the dimensions of a time series split onto their columns.
+var splitColumns = map[string]string{
+	callhome.SplitCountry: "country",
+	callhome.SplitVersion: "mg_version",
+	callhome.SplitService: "service",
+}
+
+// retrieveTimeseries counts the deployments of every bucket in a single
+// query. Series of daily or coarser buckets are read from the daily
+// continuous aggregate whenever the filters allow it, and from the history
+// when they reach past the raw retention period.
+func (r repo) retrieveTimeseries(ctx context.Context, filters callhome.TelemetryFilters, interval, split string) ([]callhome.TimeseriesPoint, error) {
+	if err := callhome.ValidateTimeseries(interval, split); err != nil {
+		return nil, err
+	}
+	if interval != callhome.IntervalHour && r.historic(filters) {
+		// Buckets starting before the retention boundary are read from the
+		// history, and the rest, up to today, from raw data.
+		boundary := r.retentionBoundary(interval)
+		points, err := r.retrieveHistoryTimeseries(ctx, filters, interval, split, boundary)
+		if err != nil {
+			return nil, err
+		}
+		if !filters.To.IsZero() && filters.To.Before(boundary) {
+			return points, nil
+		}
+		recent := filters
+		recent.From = boundary
+		recentPoints, err := r.retrieveTimeseries(ctx, recent, interval, split)
+		if err != nil {
+			return nil, err
+		}
+		return append(points, recentPoints...), nil
+	}
+
+	src := r.rawSource()
+	if interval != callhome.IntervalHour {
+		src = r.summarySource(filters)
+	}
+	filterQuery, params := generateQuery(filters, src)
+
+	value := "''"
+	if split != "" {
+		value = splitColumns[split]
+	}
+	// Columns are grouped by position, as the daily aggregate has a bucket
+	// column of its own.
+	q := fmt.Sprintf(`SELECT time_bucket(INTERVAL '%s', %s) AS bucket, %s AS value, COUNT(DISTINCT ip_address) AS count
+		FROM %s %s
+		GROUP BY 1, 2 ORDER BY 1, 2;`, bucketWidths[interval], src.time, value, src.table, filterQuery)
+
+	var points []callhome.TimeseriesPoint
+	if err := selectNamed(ctx, r.reader(), &points, q, params); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// retrieveHistoryTimeseries computes the buckets of the series starting
+// before the given bucket from telemetry_history. As the history only keeps
+// daily counts, the number of deployments of a bucket longer than a day is
+// the highest daily number of distinct deployments within it.
+func (r repo) retrieveHistoryTimeseries(ctx context.Context, filters callhome.TelemetryFilters, interval, split string, before time.Time) ([]callhome.TimeseriesPoint, error) {
+	params := map[string]interface{}{
+		"from":    filters.From.UTC().Format(time.DateOnly),
+		"before":  before.UTC().Format(time.DateOnly),
+		"version": orAll(filters.Version),
+		"country": orAll(filters.Country),
+		"service": orAll(filters.Service),
+		"all":     allValues,
+	}
+	conds := []string{"day >= CAST(:from AS DATE)", "day < CAST(:before AS DATE)"}
+	if !filters.To.IsZero() {
+		conds = append(conds, "day <= CAST(:to AS DATE)")
+		params["to"] = filters.To.UTC().Format(time.DateOnly)
+	}
+	value := "''"
+	for _, col := range []struct{ column, param string }{
+		{"mg_version", "version"},
+		{"country", "country"},
+		{"service", "service"},
+	} {
+		if col.column != splitColumns[split] {
+			conds = append(conds, fmt.Sprintf("%s = :%s", col.column, col.param))
+			continue
+		}
+		value = col.column
+		conds = append(conds, fmt.Sprintf("%[1]s <> :all AND (:%[2]s = :all OR %[1]s = :%[2]s)", col.column, col.param))
+	}
+	q := fmt.Sprintf(`SELECT time_bucket(INTERVAL '%s', day) AS bucket, %s AS value, MAX(deployments) AS count
+		FROM telemetry_history WHERE %s
+		GROUP BY 1, 2 ORDER BY 1, 2;`, bucketWidths[interval], value, strings.Join(conds, " AND "))
+
+	var points []callhome.TimeseriesPoint
+	if err := selectNamed(ctx, r.reader(), &points, q, params); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
@@ -5,15 +5,23 @@ package tracing
 
 import (
 	"context"
+	"time"
 
 	"github.com/absmach/callhome"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	retrieveAllOp     = "retrieve_all_op"
 	retrieveSummaryOp = "retrieve_summary_op"
+	retrieveSeriesOp  = "retrieve_timeseries_op"
+	retrieveTransOp   = "retrieve_transitions_op"
+	retrieveCohortsOp = "retrieve_cohorts_op"
+	retrieveSetsOp    = "retrieve_service_sets_op"
 	saveOp            = "save_op"
+	eraseOp           = "erase_op"
+	blockedOp         = "blocked_op"
 )
 
 var _ callhome.TelemetryRepo = (*repoTracer)(nil)
@@ -39,10 +47,38 @@ func (rt *repoTracer) RetrieveAll(ctx context.Context, pm callhome.PageMetadata,
 }
 
 // RetrieveSummary adds tracing middleware to retrieve summary method.
-func (rt *repoTracer) RetrieveSummary(ctx context.Context, filter callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
-	ctx, span := rt.tracer.Start(ctx, retrieveSummaryOp)
+func (rt *repoTracer) RetrieveSummary(ctx context.Context, filter callhome.TelemetryFilters, breakdowns callhome.Breakdowns, status callhome.StatusConfig, now time.Time) (callhome.TelemetrySummary, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveSummaryOp, trace.WithAttributes(attribute.StringSlice("breakdowns", breakdowns)))
 	defer span.End()
-	return rt.repo.RetrieveSummary(ctx, filter)
+	return rt.repo.RetrieveSummary(ctx, filter, breakdowns, status, now)
+}
+
+// RetrieveTimeseries adds tracing middleware to retrieve timeseries method.
+func (rt *repoTracer) RetrieveTimeseries(ctx context.Context, filter callhome.TelemetryFilters, interval, split string) ([]callhome.TimeseriesPoint, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveSeriesOp, trace.WithAttributes(attribute.String("interval", interval), attribute.String("split", split)))
+	defer span.End()
+	return rt.repo.RetrieveTimeseries(ctx, filter, interval, split)
+}
+
+// RetrieveTransitions adds tracing middleware to retrieve transitions method.
+func (rt *repoTracer) RetrieveTransitions(ctx context.Context, filter callhome.TelemetryFilters) (callhome.TransitionReport, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveTransOp)
+	defer span.End()
+	return rt.repo.RetrieveTransitions(ctx, filter)
+}
+
+// RetrieveCohorts adds tracing middleware to retrieve cohorts method.
+func (rt *repoTracer) RetrieveCohorts(ctx context.Context, filter callhome.TelemetryFilters, period string) ([]callhome.Cohort, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveCohortsOp, trace.WithAttributes(attribute.String("period", period)))
+	defer span.End()
+	return rt.repo.RetrieveCohorts(ctx, filter, period)
+}
+
+// RetrieveServiceSets adds tracing middleware to retrieve service sets method.
+func (rt *repoTracer) RetrieveServiceSets(ctx context.Context, filter callhome.TelemetryFilters) ([]callhome.DeploymentServices, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveSetsOp)
+	defer span.End()
+	return rt.repo.RetrieveServiceSets(ctx, filter)
 }
 
 // Save adds tracing middleware to save method.
@@ -51,3 +87,17 @@ func (rt *repoTracer) Save(ctx context.Context, t callhome.Telemetry) error {
 	defer span.End()
 	return rt.repo.Save(ctx, t)
 }
+
+// Erase adds tracing middleware to erase method.
+func (rt *repoTracer) Erase(ctx context.Context, receipt callhome.ErasureReceipt, identifiers, blocklist []string) (callhome.ErasureReceipt, error) {
+	ctx, span := rt.tracer.Start(ctx, eraseOp)
+	defer span.End()
+	return rt.repo.Erase(ctx, receipt, identifiers, blocklist)
+}
+
+// Blocked adds tracing middleware to blocked method.
+func (rt *repoTracer) Blocked(ctx context.Context, identifiers ...string) (bool, error) {
+	ctx, span := rt.tracer.Start(ctx, blockedOp)
+	defer span.End()
+	return rt.repo.Blocked(ctx, identifiers...)
+}
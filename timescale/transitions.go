@@ -0,0 +1,96 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/absmach/callhome"
+)
+
+// transitionRow is a row of the grouped transitions. The row of the empty
+// grouping set sums up all transitions and has no versions.
+type transitionRow struct {
+	Grouping int             `db:"grouping"`
+	From     sql.NullString  `db:"from_version"`
+	To       sql.NullString  `db:"to_version"`
+	Count    int             `db:"count"`
+	Median   sql.NullFloat64 `db:"median"`
+}
+
+// versionNumbers returns the expression of the leading dot-separated numbers
+// of the version column, ordered the way callhome.IsUpgrade orders them. It
+// is NULL for versions that don't start with a number.
+func versionNumbers(col string) string {
+	return fmt.Sprintf(`CAST(string_to_array(substring(%s FROM '^v?([0-9]+(\.[0-9]+)*)'), '.') AS NUMERIC[])`, col)
+}
+
+// retrieveTransitions finds the upgrades of the services of every deployment
+// by comparing consecutive events, and aggregates them in a single query. A
+// version is released when any deployment first reported it, on the first
+// day of the history when that's earlier than its first raw event.
+func (r repo) retrieveTransitions(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TransitionReport, error) {
+	// Earlier versions are looked up before the window.
+	events := filters
+	events.From = time.Time{}
+	filterQuery, params := generateQuery(events, r.rawSource())
+
+	window := ""
+	if !filters.From.IsZero() {
+		window = "AND e.time >= :from"
+		params["from"] = filters.From
+	}
+	q := fmt.Sprintf(`WITH events AS (
+			SELECT ip_address, time, mg_version,
+				LAG(mg_version) OVER (PARTITION BY ip_address, service ORDER BY time) AS previous
+			FROM telemetry %[1]s
+		), first_events AS (
+			SELECT mg_version, MIN(time) AS released FROM telemetry GROUP BY mg_version
+		), first_days AS (
+			SELECT mg_version, MIN(day) AS day FROM telemetry_history
+			WHERE mg_version <> '%[3]s' AND country = '%[3]s' AND service = '%[3]s'
+			GROUP BY mg_version
+		), releases AS (
+			SELECT f.mg_version,
+				CASE WHEN d.day < CAST(f.released AT TIME ZONE 'UTC' AS DATE)
+					THEN CAST(d.day AS TIMESTAMP) AT TIME ZONE 'UTC' ELSE f.released END AS released
+			FROM first_events f LEFT JOIN first_days d ON d.mg_version = f.mg_version
+		), upgrades AS (
+			SELECT e.ip_address, e.previous, e.mg_version, MIN(e.time) - r.released AS adoption
+			FROM events e JOIN releases r ON r.mg_version = e.mg_version
+			WHERE %[4]s < %[5]s %[2]s
+			GROUP BY e.ip_address, e.previous, e.mg_version, r.released
+		)
+		SELECT GROUPING(previous, mg_version) AS grouping, previous AS from_version, mg_version AS to_version,
+			COUNT(DISTINCT ip_address) AS count,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY CAST(EXTRACT(EPOCH FROM adoption) AS DOUBLE PRECISION)) AS median
+		FROM upgrades
+		GROUP BY GROUPING SETS ((previous, mg_version), ())
+		ORDER BY count DESC, from_version, to_version;`, filterQuery, window, allValues, versionNumbers("e.previous"), versionNumbers("e.mg_version"))
+
+	var rows []transitionRow
+	if err := selectNamed(ctx, r.reader(), &rows, q, params); err != nil {
+		return callhome.TransitionReport{}, err
+	}
+
+	var report callhome.TransitionReport
+	for _, row := range rows {
+		adoption := time.Duration(row.Median.Float64 * float64(time.Second))
+		if row.Grouping != 0 {
+			report.NoDeployments = row.Count
+			report.MedianAdoption = adoption
+			continue
+		}
+		report.Transitions = append(report.Transitions, callhome.VersionTransition{
+			From:           row.From.String,
+			To:             row.To.String,
+			NoDeployments:  row.Count,
+			MedianAdoption: adoption,
+		})
+	}
+	return report, nil
+}
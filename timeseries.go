@@ -0,0 +1,103 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"time"
+)
+
+// Intervals of the buckets of a time series.
+const (
+	IntervalHour  = "hour"
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// Dimensions a time series can be split by.
+const (
+	SplitCountry = "country"
+	SplitVersion = "version"
+	SplitService = "service"
+)
+
+var (
+	// ErrInvalidInterval indicates an unsupported time series interval.
+	ErrInvalidInterval = errors.New("invalid time series interval")
+	// ErrInvalidSplit indicates an unsupported time series split.
+	ErrInvalidSplit = errors.New("invalid time series split")
+)
+
+// TimeseriesPoint counts the distinct deployments active within the bucket
+// starting at Time. Value is the value of the split dimension the
+// deployments reported, empty when the series isn't split.
+type TimeseriesPoint struct {
+	Time          time.Time `json:"time" db:"bucket"`
+	Value         string    `json:"value,omitempty" db:"value"`
+	NoDeployments int       `json:"number_of_deployments" db:"count"`
+}
+
+// ValidateTimeseries checks the interval and the split against the allowed
+// values. An empty split leaves the series unsplit.
+func ValidateTimeseries(interval, split string) error {
+	switch interval {
+	case IntervalHour, IntervalDay, IntervalWeek, IntervalMonth:
+	default:
+		return ErrInvalidInterval
+	}
+	switch split {
+	case "", SplitCountry, SplitVersion, SplitService:
+	default:
+		return ErrInvalidSplit
+	}
+	return nil
+}
+
+// BucketStart returns the start of the bucket of the interval containing t.
+// Buckets are aligned in UTC and weeks start on Monday, the way TimescaleDB
+// aligns them.
+func BucketStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	switch interval {
+	case IntervalHour:
+		return t.Truncate(time.Hour)
+	case IntervalWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// NextBucket returns the start of the bucket of the interval following the
+// one starting at start.
+func NextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalHour:
+		return start.Add(time.Hour)
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// SplitValue returns the value of the split dimension of the event.
+func SplitValue(t Telemetry, split string) string {
+	switch split {
+	case SplitCountry:
+		return t.Country
+	case SplitVersion:
+		return t.Version
+	case SplitService:
+		return t.Service
+	default:
+		return ""
+	}
+}
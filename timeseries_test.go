@@ -0,0 +1,40 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketStart(t *testing.T) {
+	// Thursday, 15 February 2024 in UTC.
+	at := time.Date(2024, 2, 15, 21, 42, 7, 0, time.FixedZone("UTC-5", -5*60*60))
+	cases := []struct {
+		interval string
+		want     time.Time
+	}{
+		{callhome.IntervalHour, time.Date(2024, 2, 16, 2, 0, 0, 0, time.UTC)},
+		{callhome.IntervalDay, time.Date(2024, 2, 16, 0, 0, 0, 0, time.UTC)},
+		{callhome.IntervalWeek, time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC)},
+		{callhome.IntervalMonth, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, callhome.BucketStart(at, c.interval), c.interval)
+	}
+
+	// Weeks start on Monday, so a Sunday belongs to the week before.
+	sunday := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC), callhome.BucketStart(sunday, callhome.IntervalWeek))
+}
+
+func TestValidateTimeseries(t *testing.T) {
+	assert.Nil(t, callhome.ValidateTimeseries(callhome.IntervalHour, ""))
+	assert.Nil(t, callhome.ValidateTimeseries(callhome.IntervalMonth, callhome.SplitService))
+	assert.Equal(t, callhome.ErrInvalidInterval, callhome.ValidateTimeseries("", ""))
+	assert.Equal(t, callhome.ErrInvalidSplit, callhome.ValidateTimeseries(callhome.IntervalDay, "city"))
+}
@@ -0,0 +1,36 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/absmach/callhome"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const asnOpName = "get_asn_op"
+
+var _ callhome.ASNService = (*asnServiceTracer)(nil)
+
+type asnServiceTracer struct {
+	svc    callhome.ASNService
+	tracer trace.Tracer
+}
+
+// NewASNService adds tracing middlware to callhome.ASNService.
+func NewASNService(tracer trace.Tracer, svc callhome.ASNService) callhome.ASNService {
+	return &asnServiceTracer{
+		tracer: tracer,
+		svc:    svc,
+	}
+}
+
+// GetASN adds tracing middleware to asn service.
+func (ast *asnServiceTracer) GetASN(ctx context.Context, ip string) (callhome.ASN, error) {
+	ctx, span := ast.tracer.Start(ctx, asnOpName, trace.WithAttributes([]attribute.KeyValue{attribute.String("ip_address", ip)}...))
+	defer span.End()
+	return ast.svc.GetASN(ctx, ip)
+}
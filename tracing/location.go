@@ -7,7 +7,6 @@ import (
 	"context"
 
 	"github.com/absmach/callhome"
-	"github.com/ip2location/ip2location-go/v9"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -30,7 +29,7 @@ func NewLocationService(tracer trace.Tracer, svc callhome.LocationService) callh
 }
 
 // GetLocation adds tracing middleware to location service.
-func (lst *locationServiceTracer) GetLocation(ctx context.Context, ip string) (ip2location.IP2Locationrecord, error) {
+func (lst *locationServiceTracer) GetLocation(ctx context.Context, ip string) (callhome.Location, error) {
 	ctx, span := lst.tracer.Start(ctx, locOpName, trace.WithAttributes([]attribute.KeyValue{attribute.String("ip_address", ip)}...))
 	defer span.End()
 	return lst.svc.GetLocation(ctx, ip)
@@ -13,9 +13,16 @@ import (
 
 const (
 	retrieveOp        = "retrieve_op"
+	retrieveChurnOp   = "retrieve_churn_op"
 	retrieveSummaryOp = "retrieve_summary_op"
+	retrieveSeriesOp  = "retrieve_timeseries_op"
+	retrieveAdoptOp   = "retrieve_adoption_op"
+	retrieveTransOp   = "retrieve_transitions_op"
+	retrieveCohortsOp = "retrieve_cohorts_op"
+	retrieveCoOp      = "retrieve_cooccurrence_op"
 	saveOp            = "save_op"
 	serveUIOp         = "serve_UI_op"
+	eraseOp           = "erase_op"
 )
 
 var _ callhome.Service = (*telemetryServiceTracer)(nil)
@@ -34,17 +41,62 @@ func NewService(tracer trace.Tracer, svc callhome.Service) callhome.Service {
 }
 
 // Retrieve adds tracing middleware to retrieve method.
-func (tst *telemetryServiceTracer) Retrieve(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+func (tst *telemetryServiceTracer) Retrieve(ctx context.Context, token string, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
 	ctx, span := tst.tracer.Start(ctx, retrieveOp)
 	defer span.End()
-	return tst.svc.Retrieve(ctx, pm, filters)
+	return tst.svc.Retrieve(ctx, token, pm, filters)
+}
+
+// RetrieveChurn adds tracing middleware to RetrieveChurn.
+func (tst *telemetryServiceTracer) RetrieveChurn(ctx context.Context, token string, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveChurnOp)
+	defer span.End()
+	return tst.svc.RetrieveChurn(ctx, token, pm, filters)
 }
 
 // RetrieveSummary adds tracing middleware to RetrieveSummary.
-func (tst *telemetryServiceTracer) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+func (tst *telemetryServiceTracer) RetrieveSummary(ctx context.Context, token string, filters callhome.TelemetryFilters, breakdowns callhome.Breakdowns) (callhome.TelemetrySummary, error) {
 	ctx, span := tst.tracer.Start(ctx, retrieveSummaryOp)
 	defer span.End()
-	return tst.svc.RetrieveSummary(ctx, filters)
+	return tst.svc.RetrieveSummary(ctx, token, filters, breakdowns)
+}
+
+// RetrieveTimeseries adds tracing middleware to RetrieveTimeseries.
+func (tst *telemetryServiceTracer) RetrieveTimeseries(ctx context.Context, filters callhome.TelemetryFilters, interval, split string) ([]callhome.TimeseriesPoint, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveSeriesOp, trace.WithAttributes(attribute.String("interval", interval), attribute.String("split", split)))
+	defer span.End()
+	return tst.svc.RetrieveTimeseries(ctx, filters, interval, split)
+}
+
+// RetrieveAdoption adds tracing middleware to RetrieveAdoption.
+func (tst *telemetryServiceTracer) RetrieveAdoption(ctx context.Context, filters callhome.TelemetryFilters, interval string) ([]callhome.VersionShare, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveAdoptOp, trace.WithAttributes(attribute.String("interval", interval)))
+	defer span.End()
+	return tst.svc.RetrieveAdoption(ctx, filters, interval)
+}
+
+// RetrieveTransitions adds tracing middleware to RetrieveTransitions.
+func (tst *telemetryServiceTracer) RetrieveTransitions(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TransitionReport, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveTransOp)
+	defer span.End()
+	return tst.svc.RetrieveTransitions(ctx, filters)
+}
+
+// RetrieveCohorts adds tracing middleware to RetrieveCohorts.
+func (tst *telemetryServiceTracer) RetrieveCohorts(ctx context.Context, filters callhome.TelemetryFilters, period string) ([]callhome.Cohort, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveCohortsOp, trace.WithAttributes(attribute.String("period", period)))
+	defer span.End()
+	return tst.svc.RetrieveCohorts(ctx, filters, period)
+}
+
+// RetrieveCooccurrence adds tracing middleware to RetrieveCooccurrence.
+func (tst *telemetryServiceTracer) RetrieveCooccurrence(ctx context.Context, token string, filters callhome.TelemetryFilters, service string, limit uint64) (callhome.CooccurrenceReport, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveCoOp, trace.WithAttributes(
+		attribute.String("service", service),
+		attribute.Int64("limit", int64(limit)),
+	))
+	defer span.End()
+	return tst.svc.RetrieveCooccurrence(ctx, token, filters, service, limit)
 }
 
 // Save adds tracing middleware to Save.
@@ -60,3 +112,10 @@ func (tst *telemetryServiceTracer) ServeUI(ctx context.Context, filters callhome
 	defer span.End()
 	return tst.svc.ServeUI(ctx, filters)
 }
+
+// Erase adds tracing middleware to Erase.
+func (tst *telemetryServiceTracer) Erase(ctx context.Context, token string, req callhome.ErasureRequest) (callhome.ErasureReceipt, error) {
+	ctx, span := tst.tracer.Start(ctx, eraseOp)
+	defer span.End()
+	return tst.svc.Erase(ctx, token, req)
+}